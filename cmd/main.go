@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -9,16 +10,35 @@ import (
 )
 
 func main() {
+	canonicalizeLinks := flag.Bool("canonicalize-links", false, "canonicalize the urls of links stored before urls were canonicalized, then exit")
+	flag.Parse()
+
 	dir, err := os.Getwd()
 	if err != nil {
 		panic(err)
 	}
-	cfg, err := config.NewService(fmt.Sprintf("%s/config.yml", dir))
+	path := fmt.Sprintf("%s/config.yml", dir)
+	cfg, err := config.NewService(path)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := boot.NewStorage(path)
+	if err != nil {
+		panic(err)
+	}
+	srvcCfg, err := boot.NewServiceConfig(path)
 	if err != nil {
 		panic(err)
 	}
 
-	strap, err := boot.New(cfg)
+	if *canonicalizeLinks {
+		if err := boot.CanonicalizeLinks(cfg, storage); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	strap, err := boot.New(cfg, storage, srvcCfg)
 	if err != nil {
 		panic(err)
 	}
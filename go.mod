@@ -2,15 +2,16 @@ module github.com/srcabl/posts
 
 go 1.15
 
-replace github.com/srcabl/services => /home/kero/automata/srcabl/services
-
-replace github.com/srcabl/protos => /home/kero/automata/srcabl/protos
-
 require (
 	github.com/gofrs/uuid v4.0.0+incompatible
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/pkg/errors v0.9.1
 	github.com/srcabl/protos v0.1.0
 	github.com/srcabl/services v0.1.1
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
+	golang.org/x/text v0.3.2
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.32.0
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,91 @@
+package boot
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/service"
+	"gopkg.in/yaml.v2"
+)
+
+// NewServiceConfig reads the service section of the service's config file,
+// the settings it leaves out keep their defaults and durations are written like 720h or 15s
+func NewServiceConfig(path string) (*service.Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read config %s", path)
+	}
+	file := struct {
+		Service *service.Config `yaml:"service"`
+	}{
+		Service: service.DefaultConfig(),
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config %s", path)
+	}
+	if file.Service == nil {
+		file.Service = service.DefaultConfig()
+	}
+	if err := validateServiceConfig(file.Service); err != nil {
+		return nil, errors.Wrapf(err, "invalid service config %s", path)
+	}
+	return file.Service, nil
+}
+
+// validateServiceConfig checks the settings the service cannot run without are set
+func validateServiceConfig(cfg *service.Config) error {
+	if cfg.RestoreGracePeriod < 0 {
+		return errors.New("restore_grace_period must not be negative")
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"trending_tags_window", cfg.TrendingTagsWindow},
+		{"unfurl_timeout", cfg.UnfurlTimeout},
+		{"redirect_timeout", cfg.RedirectTimeout},
+		{"link_check_interval", cfg.LinkCheckInterval},
+		{"link_recheck_age", cfg.LinkRecheckAge},
+		{"link_check_timeout", cfg.LinkCheckTimeout},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			return errors.Errorf("%s must be positive but is %s", d.name, d.value)
+		}
+	}
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"max_feed_follows", cfg.MaxFeedFollows},
+		{"max_trending_tags", cfg.MaxTrendingTags},
+		{"default_page_size", cfg.DefaultPageSize},
+		{"max_page_size", cfg.MaxPageSize},
+		{"max_batch_size", cfg.MaxBatchSize},
+		{"max_title_length", cfg.MaxTitleLength},
+		{"max_comment_length", cfg.MaxCommentLength},
+		{"max_url_length", cfg.MaxURLLength},
+		{"link_check_batch_size", cfg.LinkCheckBatchSize},
+		{"link_check_concurrency", cfg.LinkCheckConcurrency},
+		{"link_dead_after_failures", cfg.LinkDeadAfterFailures},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			return errors.Errorf("%s must be positive but is %d", p.name, p.value)
+		}
+	}
+	if len(cfg.ReactionKinds) == 0 {
+		return errors.New("reaction_kinds must list at least one kind")
+	}
+	if len(cfg.AllowedURLSchemes) == 0 {
+		return errors.New("allowed_url_schemes must list at least one scheme")
+	}
+	for _, moderatorUUID := range cfg.ModeratorUUIDs {
+		if _, err := uuid.FromString(moderatorUUID); err != nil {
+			return errors.Wrapf(err, "moderator_uuids must list uuids but has %q", moderatorUUID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package boot_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/srcabl/posts/internal/boot"
+	"github.com/srcabl/posts/internal/service"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write config: %+v", err)
+	}
+	return path
+}
+
+func TestNewServiceConfig(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: 8080
+storage:
+  driver: sqlite
+service:
+  restore_grace_period: 48h
+  reaction_kinds: [like, dislike]
+  max_title_length: 100
+  allowed_url_schemes: [https]
+`)
+	got, err := boot.NewServiceConfig(path)
+	if err != nil {
+		t.Fatalf("failed to read service config: %+v", err)
+	}
+	want := service.DefaultConfig()
+	want.RestoreGracePeriod = 48 * time.Hour
+	want.ReactionKinds = []string{"like", "dislike"}
+	want.MaxTitleLength = 100
+	want.AllowedURLSchemes = []string{"https"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("service config = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewServiceConfigDefaults(t *testing.T) {
+	for name, contents := range map[string]string{
+		"no service section":    "storage:\n  driver: mysql\n",
+		"empty service section": "service:\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := boot.NewServiceConfig(writeConfig(t, contents))
+			if err != nil {
+				t.Fatalf("failed to read service config: %+v", err)
+			}
+			if !reflect.DeepEqual(got, service.DefaultConfig()) {
+				t.Errorf("service config = %+v, want the defaults", got)
+			}
+		})
+	}
+}
+
+func TestNewServiceConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"negative grace period", "service:\n  restore_grace_period: -1h\n"},
+		{"zero page size", "service:\n  max_page_size: 0\n"},
+		{"no reaction kinds", "service:\n  reaction_kinds: []\n"},
+		{"no url schemes", "service:\n  allowed_url_schemes: []\n"},
+		{"moderator that is not a uuid", "service:\n  moderator_uuids: [admin]\n"},
+		{"zero check interval", "service:\n  link_check_interval: 0s\n"},
+		{"malformed duration", "service:\n  link_check_timeout: soon\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := boot.NewServiceConfig(writeConfig(t, tt.contents)); err == nil {
+				t.Errorf("read invalid service config %q", tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package boot
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/service"
+	"github.com/srcabl/posts/internal/sqlite"
+	"github.com/srcabl/services/pkg/config"
+	"github.com/srcabl/services/pkg/db/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// StorageMySQL stores posts in MySQL, it is the default
+	StorageMySQL = "mysql"
+	// StorageSQLite stores posts in a SQLite database file, e.g. for single node deployments and offline development
+	StorageSQLite = "sqlite"
+)
+
+// Storage is which database the posts are stored in
+type Storage struct {
+	// Driver is mysql or sqlite, posts are stored in mysql when it is empty
+	Driver string `yaml:"driver"`
+	// SQLitePath is the database file posts are stored in by the sqlite driver
+	SQLitePath string `yaml:"sqlite_path"`
+}
+
+// NewStorage reads the storage section of the service's config file, the rest of the file configures the service
+func NewStorage(path string) (*Storage, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read config %s", path)
+	}
+	var file struct {
+		Storage Storage `yaml:"storage"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config %s", path)
+	}
+	return &file.Storage, nil
+}
+
+// newDataRepository news up the data repository for the storage driver along with how to connect to its database,
+// the mysql driver also searches with the MySQL FULLTEXT indexes unless the service config says otherwise; the sqlite
+// driver searches an in-memory index rebuilt from the database at start, which suits the small single node
+// deployments sqlite is for since the index holds every searchable post and the rebuild reads each of them
+func newDataRepository(cfg *config.Service, storage *Storage, srvcCfg *service.Config) (service.DataRepository, func() (func() error, error), error) {
+	switch storage.Driver {
+	case "", StorageMySQL:
+		db, err := mysql.New(cfg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed new db client")
+		}
+		if srvcCfg.SearchIndex == nil {
+			srvcCfg.SearchIndex = service.NewMySQLSearchIndex(db)
+		}
+		dataRepo, err := service.NewDataRepository(db)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create data repo")
+		}
+		return dataRepo, db.Connect, nil
+	case StorageSQLite:
+		db, err := sqlite.New(storage.SQLitePath)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed new sqlite client")
+		}
+		dataRepo, err := service.NewSQLiteDataRepository(db)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to create data repo")
+		}
+		return dataRepo, db.Connect, nil
+	default:
+		return nil, nil, errors.Errorf("unknown storage driver %s", storage.Driver)
+	}
+}
+
+// CanonicalizeLinks canonicalizes the urls of the links stored before urls were canonicalized, merging the links
+// that turn out to be duplicates, it is run once after migrating a database with such links
+func CanonicalizeLinks(cfg *config.Service, storage *Storage) error {
+	dataRepo, connectDB, err := newDataRepository(cfg, storage, service.DefaultConfig())
+	if err != nil {
+		return err
+	}
+	canonicalizer, ok := dataRepo.(service.LinkCanonicalizer)
+	if !ok {
+		return errors.Errorf("storage driver %s cannot canonicalize links", storage.Driver)
+	}
+	disconnect, err := connectDB()
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to database")
+	}
+	defer disconnect()
+	canonicalized, merged, err := canonicalizer.CanonicalizeLinks(context.Background())
+	if err != nil {
+		return errors.Wrapf(err, "failed after canonicalizing %d links and merging %d", canonicalized, merged)
+	}
+	log.Printf("Canonicalized %d links and merged %d duplicate links\n", canonicalized, merged)
+	return nil
+}
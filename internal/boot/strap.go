@@ -1,78 +1,119 @@
 package boot
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	"github.com/srcabl/posts/internal/server"
 	"github.com/srcabl/posts/internal/service"
 	pb "github.com/srcabl/protos/posts"
 	"github.com/srcabl/services/pkg/config"
-	"github.com/srcabl/services/pkg/db/mysql"
 	"google.golang.org/grpc"
 )
 
 // Strap initializes the user service
 type Strap struct {
-	Config     *config.Service
-	Middleware grpc.ServerOption
-	Service    pb.PostsServiceServer
-	Server     server.GRPC
+	Config           *config.Service
+	Middleware       grpc.ServerOption
+	Service          pb.PostsServiceServer
+	Server           server.GRPC
+	LinkHealthWorker *service.LinkHealthWorker
+
+	onconnect  []connector
+	onshutdown []shutdowner
+}
+
+// connector connects an application service, returning how to shut it down
+type connector struct {
+	name    string
+	connect func() (func() error, error)
+}
 
-	onconnect  map[string](func() (func() error, error))
-	onshutdown map[string](func() error)
+// shutdowner shuts down a connected application service
+type shutdowner struct {
+	name     string
+	shutdown func() error
 }
 
-// New news up boot and all application services
-func New(cfg *config.Service) (*Strap, error) {
-	db, err := mysql.New(cfg)
+// New news up boot and all application services, storing posts in the database storage says
+// and configuring the posts service with srvcCfg
+func New(cfg *config.Service, storage *Storage, srvcCfg *service.Config) (*Strap, error) {
+	dataRepo, connectDB, err := newDataRepository(cfg, storage, srvcCfg)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed new db client")
+		return nil, err
 	}
 
 	middleware := grpc.EmptyServerOption{}
 
-	srvc, err := service.New(db)
+	srvc, err := service.New(dataRepo, srvcCfg)
 	if err != nil {
 		return nil, err
 	}
 
+	linkHealthWorker, err := service.NewLinkHealthWorker(dataRepo, srvcCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to new link health worker")
+	}
+
 	srv, err := server.New(cfg, middleware, srvc)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to new server")
 	}
 
 	return &Strap{
-		Config:     cfg,
-		Middleware: middleware,
-		Service:    srvc,
-		Server:     srv,
-
-		onconnect: map[string](func() (func() error, error)){
-			"database connection": db.Connect,
-			"service run":         srv.Run,
+		Config:           cfg,
+		Middleware:       middleware,
+		Service:          srvc,
+		Server:           srv,
+		LinkHealthWorker: linkHealthWorker,
+
+		// connected in order and shut down in reverse, the service run blocks while serving so it must be last
+		onconnect: []connector{
+			{name: "database connection", connect: connectDB},
+			{name: "link unfurls", connect: stopUnfurls(srvc)},
+			{name: "search index", connect: rebuildSearchIndex(srvc)},
+			{name: "link health worker", connect: linkHealthWorker.Run},
+			{name: "service run", connect: srv.Run},
 		},
-		onshutdown: map[string](func() error){},
 	}, nil
 }
 
+// stopUnfurls has the service's background link unfurls finish before the database they store metadata in is closed
+func stopUnfurls(srvc *service.Handler) func() (func() error, error) {
+	return func() (func() error, error) {
+		return srvc.StopUnfurls, nil
+	}
+}
+
+// rebuildSearchIndex fills the service's search index from storage once the database is connected
+func rebuildSearchIndex(srvc *service.Handler) func() (func() error, error) {
+	return func() (func() error, error) {
+		if err := srvc.RebuildSearchIndex(context.Background()); err != nil {
+			return nil, err
+		}
+		return func() error { return nil }, nil
+	}
+}
+
 // Connect connects all application services
 func (s *Strap) Connect() error {
-	for name, connect := range s.onconnect {
-		os, err := connect()
+	for _, c := range s.onconnect {
+		os, err := c.connect()
 		if err != nil {
-			return errors.Wrapf(err, "%s failed", name)
+			return errors.Wrapf(err, "%s failed", c.name)
 		}
-		s.onshutdown[name] = os
+		s.onshutdown = append(s.onshutdown, shutdowner{name: c.name, shutdown: os})
 	}
 	return nil
 }
 
-// Shutdown shuts down all application srvices
+// Shutdown shuts down all application srvices, in the reverse of the order they connected
 func (s *Strap) Shutdown() []error {
 	var errs []error
-	for name, shutdown := range s.onshutdown {
-		err := shutdown()
+	for i := len(s.onshutdown) - 1; i >= 0; i-- {
+		err := s.onshutdown[i].shutdown()
 		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "%s failed", name))
+			errs = append(errs, errors.Wrapf(err, "%s failed", s.onshutdown[i].name))
 		}
 	}
 	return errs
@@ -0,0 +1,122 @@
+package canonical
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+)
+
+// trackingParams are query params that only identify where a visitor came from
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+}
+
+// trackingParamPrefixes are prefixes of families of tracking query params
+var trackingParamPrefixes = []string{
+	"utm_",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URL canonicalizes a url so that urls pointing at the same resource compare equal
+// it lower cases the scheme and host, converts internationalized hosts to their ascii form,
+// strips default ports, fragments, tracking params and trailing slashes and sorts the query
+func URL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse url %s", raw)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", errors.Errorf("url %s must be absolute", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to canonicalize host of url %s", raw)
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host = joinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.RawQuery = canonicalQuery(u.Query())
+	u.ForceQuery = false
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+
+	return u.String(), nil
+}
+
+// Host canonicalizes a bare host the same way URL canonicalizes the host of a url
+func Host(raw string) (string, error) {
+	host, err := canonicalHost(strings.TrimSpace(raw))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to canonicalize host %s", raw)
+	}
+	return host, nil
+}
+
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if strings.Contains(host, ":") {
+		// ipv6 literals are not idna encoded
+		return strings.ToLower(host), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(ascii), nil
+}
+
+func joinHostPort(host string, port string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]:" + port
+	}
+	return host + ":" + port
+}
+
+func canonicalQuery(query url.Values) string {
+	for key := range query {
+		if isTrackingParam(key) {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key, giving a stable order
+	return query.Encode()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, prefix := range trackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
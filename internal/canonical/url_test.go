@@ -0,0 +1,91 @@
+package canonical_test
+
+import (
+	"testing"
+
+	"github.com/srcabl/posts/internal/canonical"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"already canonical", "https://example.com/a", "https://example.com/a"},
+		{"scheme and host are lower cased", "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"surrounding space", "  https://example.com/a\n", "https://example.com/a"},
+		{"idna host", "https://bücher.example/a", "https://xn--bcher-kva.example/a"},
+		{"idna host is lower cased", "https://BÜCHER.example/a", "https://xn--bcher-kva.example/a"},
+		{"trailing dot on host", "https://example.com./a", "https://example.com/a"},
+		{"default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"other port", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"http port on https", "https://example.com:80/a", "https://example.com:80/a"},
+		{"ipv6 host", "https://[2001:DB8::1]/a", "https://[2001:db8::1]/a"},
+		{"ipv6 host with default port", "https://[2001:db8::1]:443/a", "https://[2001:db8::1]/a"},
+		{"ipv6 host with port", "https://[2001:db8::1]:8443/a", "https://[2001:db8::1]:8443/a"},
+		{"fragment", "https://example.com/a#section", "https://example.com/a"},
+		{"utm params", "https://example.com/a?utm_source=x&UTM_Medium=y", "https://example.com/a"},
+		{"click ids", "https://example.com/a?fbclid=1&gclid=2&id=3", "https://example.com/a?id=3"},
+		{"query is sorted", "https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"empty query", "https://example.com/a?", "https://example.com/a"},
+		{"trailing slash", "https://example.com/a/", "https://example.com/a"},
+		{"trailing slashes", "https://example.com/a///", "https://example.com/a"},
+		{"root slash", "https://example.com/", "https://example.com"},
+		{"escaped path keeps its escaping", "https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonical.URL(tt.raw)
+			if err != nil {
+				t.Fatalf("failed to canonicalize %q: %+v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("URL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"relative", "/a/b"},
+		{"no host", "mailto:someone@example.com"},
+		{"unparseable", "https://example.com/%zz"},
+		{"invalid idna host", "https://exa mple.com/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := canonical.URL(tt.raw); err == nil {
+				t.Errorf("URL(%q) = %q, want an error", tt.raw, got)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"2001:DB8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := canonical.Host(tt.raw)
+			if err != nil {
+				t.Fatalf("failed to canonicalize %q: %+v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Host(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
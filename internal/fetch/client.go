@@ -0,0 +1,89 @@
+package fetch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UserAgent is sent with every request made on behalf of the posts service
+const UserAgent = "srcabl-posts/1.0 (+https://srcabl.com)"
+
+// nonPublicNetworks are networks links are never fetched from
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+// NewClient creates an http client for fetching user submitted links,
+// it refuses to connect to loopback, private and link local addresses; it never uses a proxy,
+// since a proxy dials the link's address itself where the refusal cannot see it
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: refuseNonPublic,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// NewRequest creates a request for a link with the service's user agent
+func NewRequest(ctx context.Context, method string, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s request for %s", method, url)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	return req, nil
+}
+
+func refuseNonPublic(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to split address %s", address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("refusing to dial unresolved address %s", address)
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return errors.Errorf("refusing to dial non public address %s", address)
+		}
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,37 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/srcabl/posts/internal/fetch"
+)
+
+func TestClientRefusesNonPublicAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	client := fetch.NewClient(time.Second)
+
+	req, err := fetch.NewRequest(context.Background(), http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatalf("failed to new up request: %+v", err)
+	}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+		t.Errorf("fetched loopback address %s", srv.URL)
+	}
+}
+
+func TestClientDoesNotProxy(t *testing.T) {
+	transport, ok := fetch.NewClient(time.Second).Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("client transport is %T, want *http.Transport", fetch.NewClient(time.Second).Transport)
+	}
+	// a proxy would dial links itself, getting around the refusal to dial non public addresses
+	if transport.Proxy != nil {
+		t.Errorf("client uses a proxy")
+	}
+}
@@ -0,0 +1,74 @@
+package hashtag
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the most runes a tag can have, longer tags are ignored
+const MaxLength = 64
+
+// folder case folds tags so that tags differing only by case compare equal
+var folder = cases.Fold()
+
+// Extract finds the #hashtags in text and returns them normalized, in the order they first appear
+func Extract(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	runes := []rune(norm.NFKC.String(text))
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && !isBoundary(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+		tag := Normalize(string(runes[i+1 : end]))
+		i = end - 1
+		if !Valid(tag) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Normalize puts a tag in the form it is stored and looked up in, with or without its leading #
+func Normalize(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	return norm.NFC.String(folder.String(norm.NFKC.String(tag)))
+}
+
+// Valid is whether a normalized tag can be stored, it must be made of tag runes,
+// have a letter so that e.g. #1 is not a tag, and be no longer than MaxLength
+func Valid(tag string) bool {
+	runes := []rune(tag)
+	if len(runes) == 0 || len(runes) > MaxLength {
+		return false
+	}
+	hasLetter := false
+	for _, r := range runes {
+		if !isTagRune(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		}
+	}
+	return hasLetter
+}
+
+// isTagRune is whether a rune can be part of a tag
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isBoundary is whether a rune can come right before a tag's #, so that e.g. url fragments are not tags
+func isBoundary(r rune) bool {
+	return !isTagRune(r) && r != '/' && r != '&' && r != '#'
+}
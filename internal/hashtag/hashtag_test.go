@@ -0,0 +1,86 @@
+package hashtag_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/srcabl/posts/internal/hashtag"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "no tags here", nil},
+		{"tags", "#go and #rust", []string{"go", "rust"}},
+		{"in the order they first appear", "#rust #go #rust", []string{"rust", "go"}},
+		{"case folded", "#Go #GO #go", []string{"go"}},
+		{"folded beyond lower casing", "#Straße #STRASSE", []string{"strasse"}},
+		{"trailing punctuation", "#go, #rust. (#zig)", []string{"go", "rust", "zig"}},
+		{"underscores", "#snake_case", []string{"snake_case"}},
+		{"unicode letters", "#café #日本語", []string{"café", "日本語"}},
+		{"combining marks are composed", "#cafe\u0301 #café", []string{"café"}},
+		{"fullwidth forms", "＃ｇｏ", []string{"go"}},
+		{"digits only", "#1 #2021", nil},
+		{"digits and letters", "#2021goals", []string{"2021goals"}},
+		{"mid word", "c#sharp", nil},
+		{"url fragment", "https://example.com/page#section https://example.com/#top", nil},
+		{"html entity", "it&#39;s", nil},
+		{"doubled", "##go", nil},
+		{"bare", "# go #", nil},
+		{"at the max length", "#" + strings.Repeat("a", hashtag.MaxLength), []string{strings.Repeat("a", hashtag.MaxLength)}},
+		{"over the max length", "#" + strings.Repeat("a", hashtag.MaxLength+1), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashtag.Extract(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"go", "go"},
+		{"#Go", "go"},
+		{" #GoLang ", "golang"},
+		{"cafe\u0301", "café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := hashtag.Normalize(tt.tag); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"go", true},
+		{"go_1", true},
+		{"", false},
+		{"123", false},
+		{"go-lang", false},
+		{"go lang", false},
+		{strings.Repeat("é", hashtag.MaxLength), true},
+		{strings.Repeat("é", hashtag.MaxLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := hashtag.Valid(tt.tag); got != tt.want {
+				t.Errorf("Valid(%q) = %t, want %t", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package keyset
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is returned when a page token cannot be decoded
+var ErrInvalidToken = errors.New("invalid page token")
+
+// ErrOrderMismatch is returned when a page token is for a list in another order
+var ErrOrderMismatch = errors.New("page token is for another order")
+
+// Direction is which way a page moves through a list from its cursor
+type Direction int
+
+const (
+	// Forward pages move towards the end of a list
+	Forward Direction = iota
+	// Backward pages move towards the start of a list
+	Backward
+)
+
+// Key is the position of a row in a list, ordered by a sort value and broken by uuid
+type Key struct {
+	Value int64
+	UUID  string
+}
+
+// cursor is what a page token encodes
+type cursor struct {
+	Value     int64     `json:"v"`
+	UUID      string    `json:"u"`
+	Direction Direction `json:"d"`
+	Order     string    `json:"o"`
+}
+
+// encode encodes the cursor as an opaque page token
+func (c *cursor) encode() (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Request is a list request that pages
+type Request interface {
+	GetPageToken() string
+	GetPageSize() int32
+}
+
+// Page is a page of a list sorted by a sort value then uuid, e.g. (created_at, uuid) for newest first
+type Page struct {
+	Size int
+	// Ascending sorts the list ascending rather than descending, e.g. for oldest first
+	Ascending bool
+	order     string
+	cursor    *cursor
+}
+
+// PageInfo is how to get the pages either side of a page
+type PageInfo struct {
+	// NextToken gets the page after this one, it is empty when this is the last page
+	NextToken string
+	// PrevToken gets the page before this one, it is empty when this is the first page
+	PrevToken string
+	// HasMore is whether there are more rows in the direction the page moved
+	HasMore bool
+}
+
+// NewPage creates the page a request asks for, a size of 0 is the default size and sizes over the max are capped;
+// order names the order the list is sorted in, since a cursor's value means nothing in another order
+func NewPage(req Request, order string, defaultSize int, maxSize int) (*Page, error) {
+	page := &Page{Size: Size(req.GetPageSize(), defaultSize, maxSize), order: order}
+	if req.GetPageToken() == "" {
+		return page, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(req.GetPageToken())
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+	c := cursor{}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+	if c.Direction != Forward && c.Direction != Backward {
+		return nil, errors.Wrapf(ErrInvalidToken, "unknown direction %d", c.Direction)
+	}
+	if c.Order != order {
+		return nil, errors.Wrapf(ErrOrderMismatch, "token is for order %q not %q", c.Order, order)
+	}
+	page.cursor = &c
+	return page, nil
+}
+
+// Size is the page size to use for a requested size, a size of 0 is the default size and sizes over the max are capped
+func Size(requested int32, defaultSize int, maxSize int) int {
+	size := int(requested)
+	if size <= 0 {
+		size = defaultSize
+	}
+	if size > maxSize {
+		size = maxSize
+	}
+	return size
+}
+
+// Apply appends the page's condition, order and limit to a query that ends in a condition
+// and returns the params the appended sql needs
+func (p *Page) Apply(query string, valueCol string, uuidCol string) (string, []interface{}) {
+	// a backward page walks the list in reverse and is put back in list order by Finish
+	order := "DESC"
+	cmp := "<"
+	if p.Ascending != p.backward() {
+		order = "ASC"
+		cmp = ">"
+	}
+	var params []interface{}
+	if p.cursor != nil {
+		query = fmt.Sprintf("%s AND (%s %s ? OR (%s = ? AND %s %s ?))", query, valueCol, cmp, valueCol, uuidCol, cmp)
+		params = append(params, p.cursor.Value, p.cursor.Value, p.cursor.UUID)
+	}
+	// one row past the page is fetched to know if there are more
+	query = fmt.Sprintf("%s ORDER BY %s %s, %s %s LIMIT %d", query, valueCol, order, uuidCol, order, p.Size+1)
+	return query, params
+}
+
+// Select picks the rows of a list that is not stored in sql the way a query built by Apply would, it takes
+// the keys of every row in the list and returns the indexes of the picked rows in the order Apply sorts them
+func (p *Page) Select(keys []Key) []int {
+	ascending := p.Ascending != p.backward()
+	var picked []int
+	for i, key := range keys {
+		if p.cursor != nil && !keyBefore(Key{Value: p.cursor.Value, UUID: p.cursor.UUID}, key, ascending) {
+			continue
+		}
+		picked = append(picked, i)
+	}
+	sort.Slice(picked, func(i, j int) bool {
+		return keyBefore(keys[picked[i]], keys[picked[j]], ascending)
+	})
+	// one row past the page is picked to know if there are more
+	if len(picked) > p.Size+1 {
+		picked = picked[:p.Size+1]
+	}
+	return picked
+}
+
+// keyBefore is whether key a comes before key b in a list sorted ascending or descending
+func keyBefore(a Key, b Key, ascending bool) bool {
+	if a.Value != b.Value {
+		return (a.Value < b.Value) == ascending
+	}
+	if a.UUID != b.UUID {
+		return (a.UUID < b.UUID) == ascending
+	}
+	return false
+}
+
+// Finish takes the keys of the rows a query built by Apply returned and works out the page they make up,
+// swap swaps two rows so a backward page can be put back in list order; it returns how many of the
+// rows, from the start, are in the page
+func (p *Page) Finish(keys []Key, swap func(i, j int)) (int, *PageInfo, error) {
+	n := len(keys)
+	hasMore := n > p.Size
+	if hasMore {
+		n = p.Size
+	}
+	keys = keys[:n]
+	if p.backward() {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	info := &PageInfo{HasMore: hasMore}
+	if n == 0 {
+		return 0, info, nil
+	}
+	moreAfter := p.cursor != nil && p.backward() || !p.backward() && hasMore
+	moreBefore := p.cursor != nil && !p.backward() || p.backward() && hasMore
+	var err error
+	if moreAfter {
+		last := keys[n-1]
+		info.NextToken, err = (&cursor{Value: last.Value, UUID: last.UUID, Direction: Forward, Order: p.order}).encode()
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "failed to encode next token")
+		}
+	}
+	if moreBefore {
+		first := keys[0]
+		info.PrevToken, err = (&cursor{Value: first.Value, UUID: first.UUID, Direction: Backward, Order: p.order}).encode()
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "failed to encode prev token")
+		}
+	}
+	return n, info, nil
+}
+
+// backward is whether the page moves towards the start of the list
+func (p *Page) backward() bool {
+	return p.cursor != nil && p.cursor.Direction == Backward
+}
@@ -0,0 +1,123 @@
+package keyset_test
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/keyset"
+)
+
+type request struct {
+	token string
+	size  int32
+}
+
+func (r request) GetPageToken() string { return r.token }
+func (r request) GetPageSize() int32   { return r.size }
+
+// keys are a list sorted by value then uuid, descending
+var keys = []keyset.Key{
+	{Value: 50, UUID: "e"},
+	{Value: 40, UUID: "d"},
+	{Value: 30, UUID: "c2"},
+	{Value: 30, UUID: "c1"},
+	{Value: 20, UUID: "b"},
+	{Value: 10, UUID: "a"},
+}
+
+// list pages through keys with a token the way a repository would, returning the uuids of the page
+func list(t *testing.T, token string, size int32, order string) ([]string, *keyset.PageInfo) {
+	t.Helper()
+	page, err := keyset.NewPage(request{token: token, size: size}, order, 2, 10)
+	if err != nil {
+		t.Fatalf("failed to new up page for token %q: %+v", token, err)
+	}
+	picked := page.Select(keys)
+	rows := make([]keyset.Key, len(picked))
+	uuids := make([]string, len(picked))
+	for i, p := range picked {
+		rows[i], uuids[i] = keys[p], keys[p].UUID
+	}
+	n, info, err := page.Finish(rows, func(i, j int) { uuids[i], uuids[j] = uuids[j], uuids[i] })
+	if err != nil {
+		t.Fatalf("failed to finish page: %+v", err)
+	}
+	return uuids[:n], info
+}
+
+func TestPageRoundTrip(t *testing.T) {
+	var pages [][]string
+	var prevTokens []string
+	token := ""
+	for {
+		uuids, info := list(t, token, 2, "newest")
+		pages = append(pages, uuids)
+		prevTokens = append(prevTokens, info.PrevToken)
+		if info.NextToken == "" {
+			break
+		}
+		token = info.NextToken
+	}
+	want := [][]string{{"e", "d"}, {"c2", "c1"}, {"b", "a"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("pages = %v, want %v", pages, want)
+	}
+	if prevTokens[0] != "" {
+		t.Errorf("first page has a prev token %q", prevTokens[0])
+	}
+	for i := len(pages) - 1; i > 0; i-- {
+		uuids, _ := list(t, prevTokens[i], 2, "newest")
+		if !reflect.DeepEqual(uuids, pages[i-1]) {
+			t.Errorf("page before %v = %v, want %v", pages[i], uuids, pages[i-1])
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int32
+		want      int
+	}{
+		{"default", 0, 2},
+		{"negative is the default", -1, 2},
+		{"requested", 5, 5},
+		{"capped at the max", 11, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyset.Size(tt.requested, 2, 10); got != tt.want {
+				t.Errorf("Size(%d) = %d, want %d", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPageRejectsTokens(t *testing.T) {
+	_, info := list(t, "", 2, "newest")
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name  string
+		token string
+		order string
+		want  error
+	}{
+		{"not base64", "!!!", "newest", keyset.ErrInvalidToken},
+		{"truncated", info.NextToken[:len(info.NextToken)/2], "newest", keyset.ErrInvalidToken},
+		{"not json", encode("not json"), "newest", keyset.ErrInvalidToken},
+		{"wrong value type", encode(`{"v":"30","u":"c1","d":0,"o":"newest"}`), "newest", keyset.ErrInvalidToken},
+		{"unknown direction", encode(`{"v":30,"u":"c1","d":7,"o":"newest"}`), "newest", keyset.ErrInvalidToken},
+		{"another order", info.NextToken, "engagement", keyset.ErrOrderMismatch},
+		{"no order", encode(`{"v":30,"u":"c1","d":0}`), "newest", keyset.ErrOrderMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keyset.NewPage(request{token: tt.token}, tt.order, 2, 10)
+			if errors.Cause(err) != tt.want {
+				t.Errorf("NewPage(%q) = %v, want %v", tt.token, err, tt.want)
+			}
+		})
+	}
+}
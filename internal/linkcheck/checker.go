@@ -0,0 +1,194 @@
+package linkcheck
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+	"github.com/srcabl/posts/internal/fetch"
+)
+
+// Status is the health of a link
+type Status int32
+
+const (
+	// StatusUnknown links have not been checked yet
+	StatusUnknown Status = 0
+	// StatusAlive links respond successfully at their url
+	StatusAlive Status = 1
+	// StatusRedirected links respond successfully after redirecting to another url
+	StatusRedirected Status = 2
+	// StatusDead links have failed enough consecutive checks to be considered gone
+	StatusDead Status = 3
+)
+
+const (
+	maxRedirects = 10
+	// maxDrainBytes is how much of a GET body is read so the connection can be reused
+	maxDrainBytes = 64 << 10
+)
+
+// Result is the outcome of a single check of a link
+type Result struct {
+	// OK is whether the link responded successfully
+	OK bool
+	// Redirected is whether the link responded successfully at another url
+	Redirected bool
+	HTTPStatus int
+	FinalURL   string
+	Err        error
+}
+
+// Checker checks that links still respond, limiting how many requests are made to a host at once
+type Checker struct {
+	client       *http.Client
+	perHostLimit int
+	timeout      time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots are the slots to request a host, users is how many checks hold or wait for one
+type hostSlots struct {
+	slots chan struct{}
+	users int
+}
+
+// New news up a checker, it follows redirects with a copy of the client and bounds each check by timeout,
+// which starts once the check has a slot to request the link's host
+func New(client *http.Client, perHostLimit int, timeout time.Duration) *Checker {
+	redirectClient := *client
+	redirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	if perHostLimit < 1 {
+		perHostLimit = 1
+	}
+	return &Checker{
+		client:       &redirectClient,
+		perHostLimit: perHostLimit,
+		timeout:      timeout,
+		hosts:        map[string]*hostSlots{},
+	}
+}
+
+// Check requests a link with HEAD, falling back to GET for servers that do not support HEAD;
+// the wait for a slot to request the link's host is only bounded by ctx, so a busy host does not fail the check
+func (c *Checker) Check(ctx context.Context, linkURL string) *Result {
+	u, err := url.Parse(linkURL)
+	if err != nil {
+		return &Result{Err: errors.Wrapf(err, "failed to parse url %s", linkURL)}
+	}
+	release, err := c.acquire(ctx, u.Host)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	defer release()
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	result := c.request(checkCtx, http.MethodHead, linkURL)
+	if !result.OK {
+		result = c.request(checkCtx, http.MethodGet, linkURL)
+	}
+	if result.OK {
+		result.Redirected = isRedirect(linkURL, result.FinalURL)
+	}
+	return result
+}
+
+func (c *Checker) request(ctx context.Context, method string, linkURL string) *Result {
+	req, err := fetch.NewRequest(ctx, method, linkURL)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &Result{Err: errors.Wrapf(err, "failed to %s %s", method, linkURL)}
+	}
+	defer resp.Body.Close()
+	if method == http.MethodGet {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	}
+	result := &Result{
+		OK:         resp.StatusCode >= 200 && resp.StatusCode <= 299,
+		HTTPStatus: resp.StatusCode,
+		FinalURL:   resp.Request.URL.String(),
+	}
+	if !result.OK {
+		result.Err = errors.Errorf("%s %s responded %d", method, linkURL, resp.StatusCode)
+	}
+	return result
+}
+
+// acquire waits for a slot to request the host, the returned func releases it
+func (c *Checker) acquire(ctx context.Context, host string) (func(), error) {
+	c.mu.Lock()
+	hs, ok := c.hosts[host]
+	if !ok {
+		hs = &hostSlots{slots: make(chan struct{}, c.perHostLimit)}
+		c.hosts[host] = hs
+	}
+	hs.users++
+	c.mu.Unlock()
+	select {
+	case hs.slots <- struct{}{}:
+		return func() {
+			<-hs.slots
+			c.leave(host, hs)
+		}, nil
+	case <-ctx.Done():
+		c.leave(host, hs)
+		return nil, errors.Wrapf(ctx.Err(), "stopped waiting to check host %s", host)
+	}
+}
+
+// leave stops using a host's slots, forgetting the host once no check holds or waits for one
+func (c *Checker) leave(host string, hs *hostSlots) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hs.users--
+	if hs.users == 0 {
+		delete(c.hosts, host)
+	}
+}
+
+// isRedirect compares urls by their canonical form so trivial redirects like adding a trailing slash do not count
+func isRedirect(from string, to string) bool {
+	if to == "" {
+		return false
+	}
+	canonicalFrom, err := canonical.URL(from)
+	if err != nil {
+		return from != to
+	}
+	canonicalTo, err := canonical.URL(to)
+	if err != nil {
+		return from != to
+	}
+	return canonicalFrom != canonicalTo
+}
+
+// NextStatus decides a link's status from its latest check and how many checks in a row have failed
+func NextStatus(previous Status, ok bool, redirected bool, consecutiveFailures int, deadAfter int) Status {
+	switch {
+	case ok && redirected:
+		return StatusRedirected
+	case ok:
+		return StatusAlive
+	case consecutiveFailures >= deadAfter:
+		return StatusDead
+	default:
+		return previous
+	}
+}
@@ -0,0 +1,70 @@
+package linkcheck_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srcabl/posts/internal/linkcheck"
+)
+
+func TestCheckWaitsForBusyHosts(t *testing.T) {
+	const respondAfter = 60 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(respondAfter)
+	}))
+	defer srv.Close()
+	// each check fits in the timeout but not after waiting for the other to finish with the host
+	checker := linkcheck.New(srv.Client(), 1, 2*respondAfter)
+
+	var wg sync.WaitGroup
+	results := make([]*linkcheck.Result, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = checker.Check(context.Background(), srv.URL)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if !result.OK {
+			t.Errorf("check %d of a busy host = %+v, want it to wait for the host and succeed", i, result)
+		}
+	}
+}
+
+func TestCheckTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	checker := linkcheck.New(srv.Client(), 1, 20*time.Millisecond)
+
+	if result := checker.Check(context.Background(), srv.URL); result.OK || result.Err == nil {
+		t.Errorf("check of a host that does not respond = %+v, want it to time out", result)
+	}
+}
+
+func TestCheckStopsWaitingWhenCanceled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	checker := linkcheck.New(srv.Client(), 1, time.Minute)
+
+	go checker.Check(context.Background(), srv.URL)
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if result := checker.Check(ctx, srv.URL); result.OK || result.Err == nil {
+		t.Errorf("check canceled while waiting for a host = %+v, want an error", result)
+	}
+}
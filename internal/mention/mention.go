@@ -0,0 +1,74 @@
+package mention
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// MaxUsernameLength is the most runes a mentioned username can have, longer mentions are ignored
+const MaxUsernameLength = 64
+
+// Mention is an @mention in text, Start and End are the byte offsets of the mention including its @
+type Mention struct {
+	Start int
+	End   int
+	// Username is set when the mention is of a username
+	Username string
+	// UserUUID is set when the mention is of a user uuid
+	UserUUID string
+}
+
+// Extract finds the @username and @uuid mentions in text, in the order they appear
+func Extract(text string) []*Mention {
+	var mentions []*Mention
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != '@' || !atBoundary(text, i) {
+			i += size
+			continue
+		}
+		end := i + size
+		for end < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[end:])
+			if !isNameRune(next) {
+				break
+			}
+			end += nextSize
+		}
+		// names can contain dots and dashes but a mention at the end of a sentence should not
+		name := strings.TrimRight(text[i+size:end], ".-")
+		end = i + size + len(name)
+		if m := newMention(i, end, name); m != nil {
+			mentions = append(mentions, m)
+		}
+		i = end
+	}
+	return mentions
+}
+
+func newMention(start int, end int, name string) *Mention {
+	if name == "" || utf8.RuneCountInString(name) > MaxUsernameLength {
+		return nil
+	}
+	if id, err := uuid.FromString(name); err == nil && len(name) == 36 {
+		return &Mention{Start: start, End: end, UserUUID: id.String()}
+	}
+	return &Mention{Start: start, End: end, Username: name}
+}
+
+// atBoundary is whether the @ at i starts a mention rather than e.g. being part of an email address
+func atBoundary(text string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	return !isNameRune(prev) && prev != '@'
+}
+
+// isNameRune is whether a rune can be part of a mentioned name
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
@@ -0,0 +1,50 @@
+package mention_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/srcabl/posts/internal/mention"
+)
+
+func TestExtract(t *testing.T) {
+	const id = "3f1c9a7e-5b2d-4c8e-9f0a-1b2c3d4e5f60"
+	tests := []struct {
+		name string
+		text string
+		want []*mention.Mention
+	}{
+		{"none", "no mentions here", nil},
+		{"username", "hi @alice", []*mention.Mention{{Start: 3, End: 9, Username: "alice"}}},
+		{"at the start", "@alice hi", []*mention.Mention{{Start: 0, End: 6, Username: "alice"}}},
+		{"in the order they appear", "@bob and @alice", []*mention.Mention{
+			{Start: 0, End: 4, Username: "bob"},
+			{Start: 9, End: 15, Username: "alice"},
+		}},
+		{"dots and dashes", "@first.last-name", []*mention.Mention{{Start: 0, End: 16, Username: "first.last-name"}}},
+		{"end of a sentence", "thanks @alice.", []*mention.Mention{{Start: 7, End: 13, Username: "alice"}}},
+		{"trailing dashes", "@alice--", []*mention.Mention{{Start: 0, End: 6, Username: "alice"}}},
+		{"in punctuation", "(@alice)", []*mention.Mention{{Start: 1, End: 7, Username: "alice"}}},
+		{"offsets are bytes", "héllo @zoë", []*mention.Mention{{Start: 7, End: 12, Username: "zoë"}}},
+		{"email address", "mail bob@example.com", nil},
+		{"doubled", "@@alice", nil},
+		{"bare", "@ alice @.", nil},
+		{"uuid", "cc @" + id, []*mention.Mention{{Start: 3, End: 40, UserUUID: id}}},
+		{"upper case uuid", "@" + strings.ToUpper(id), []*mention.Mention{{Start: 0, End: 37, UserUUID: id}}},
+		{"uuid without dashes is a username", "@" + strings.ReplaceAll(id, "-", ""), []*mention.Mention{
+			{Start: 0, End: 33, Username: strings.ReplaceAll(id, "-", "")},
+		}},
+		{"at the max length", "@" + strings.Repeat("a", mention.MaxUsernameLength), []*mention.Mention{
+			{Start: 0, End: mention.MaxUsernameLength + 1, Username: strings.Repeat("a", mention.MaxUsernameLength)},
+		}},
+		{"over the max length", "@" + strings.Repeat("a", mention.MaxUsernameLength+1), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mention.Extract(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
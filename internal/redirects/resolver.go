@@ -0,0 +1,122 @@
+package redirects
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/fetch"
+)
+
+var (
+	// ErrTooManyHops is returned when a link redirects more times than the resolver follows
+	ErrTooManyHops = errors.New("too many redirects")
+	// ErrLoop is returned when a link redirects back to a url already in its chain
+	ErrLoop = errors.New("redirect loop")
+)
+
+// Chain is the urls a link redirected through, starting with the link itself
+type Chain struct {
+	URLs []string
+}
+
+// Final is the url the chain ends at
+func (c *Chain) Final() string {
+	return c.URLs[len(c.URLs)-1]
+}
+
+// Resolver follows a link's redirects one hop at a time to find where it finally points
+type Resolver struct {
+	client  *http.Client
+	maxHops int
+}
+
+// New news up a resolver, it makes requests with a copy of the client that does not follow redirects itself
+func New(client *http.Client, maxHops int) *Resolver {
+	hopClient := *client
+	hopClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Resolver{
+		client:  &hopClient,
+		maxHops: maxHops,
+	}
+}
+
+// Resolve follows the redirects of a link, stopping after the max hops or when it loops
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (*Chain, error) {
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse url %s", rawURL)
+	}
+	chain := &Chain{URLs: []string{current.String()}}
+	seen := map[string]bool{current.String(): true}
+	for hop := 0; ; hop++ {
+		next, err := r.next(ctx, current)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve hop %d of %s", hop, rawURL)
+		}
+		if next == nil {
+			return chain, nil
+		}
+		if hop >= r.maxHops {
+			return nil, errors.Wrapf(ErrTooManyHops, "%s redirected more than %d times", rawURL, r.maxHops)
+		}
+		if seen[next.String()] {
+			return nil, errors.Wrapf(ErrLoop, "%s redirected back to %s", rawURL, next)
+		}
+		seen[next.String()] = true
+		chain.URLs = append(chain.URLs, next.String())
+		current = next
+	}
+}
+
+// next requests a url and returns where it redirects to, or nil when it does not redirect
+func (r *Resolver) next(ctx context.Context, current *url.URL) (*url.URL, error) {
+	resp, err := r.request(ctx, http.MethodHead, current)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		// some shorteners only answer GET
+		resp, err = r.request(ctx, http.MethodGet, current)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !isRedirect(resp.StatusCode) {
+		return nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse location %s", location)
+	}
+	return current.ResolveReference(locationURL), nil
+}
+
+func (r *Resolver) request(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := fetch.NewRequest(ctx, method, u.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %s %s", method, u)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
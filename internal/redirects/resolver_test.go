@@ -0,0 +1,126 @@
+package redirects_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/redirects"
+)
+
+// redirectServer serves each path with a location as a redirect to it and every other path as a page
+func redirectServer(t *testing.T, locations map[string]string, getOnly bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getOnly && r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if location, ok := locations[r.URL.Path]; ok {
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations map[string]string
+		getOnly   bool
+		want      []string
+	}{
+		{
+			name: "no redirect",
+			want: []string{"/a"},
+		},
+		{
+			name:      "chain",
+			locations: map[string]string{"/a": "/b", "/b": "/c"},
+			want:      []string{"/a", "/b", "/c"},
+		},
+		{
+			name:      "relative location",
+			locations: map[string]string{"/a": "b/c", "/b/c": "../d"},
+			want:      []string{"/a", "/b/c", "/d"},
+		},
+		{
+			name:      "redirect without a location",
+			locations: map[string]string{"/a": ""},
+			want:      []string{"/a"},
+		},
+		{
+			name:      "as many hops as the max",
+			locations: map[string]string{"/a": "/b", "/b": "/c", "/c": "/d"},
+			want:      []string{"/a", "/b", "/c", "/d"},
+		},
+		{
+			name:      "shortener that only answers get",
+			locations: map[string]string{"/a": "/b"},
+			getOnly:   true,
+			want:      []string{"/a", "/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := redirectServer(t, tt.locations, tt.getOnly)
+			chain, err := redirects.New(srv.Client(), 3).Resolve(context.Background(), srv.URL+"/a")
+			if err != nil {
+				t.Fatalf("failed to resolve: %+v", err)
+			}
+			var want []string
+			for _, path := range tt.want {
+				want = append(want, srv.URL+path)
+			}
+			if !reflect.DeepEqual(chain.URLs, want) {
+				t.Errorf("chain = %v, want %v", chain.URLs, want)
+			}
+			if chain.Final() != want[len(want)-1] {
+				t.Errorf("final = %s, want %s", chain.Final(), want[len(want)-1])
+			}
+		})
+	}
+}
+
+func TestResolveFails(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations map[string]string
+		want      error
+	}{
+		{
+			name:      "one hop past the max",
+			locations: map[string]string{"/a": "/b", "/b": "/c", "/c": "/d", "/d": "/e"},
+			want:      redirects.ErrTooManyHops,
+		},
+		{
+			name:      "redirects to itself",
+			locations: map[string]string{"/a": "/a"},
+			want:      redirects.ErrLoop,
+		},
+		{
+			name:      "redirects back to the start",
+			locations: map[string]string{"/a": "/b", "/b": "/c", "/c": "/a"},
+			want:      redirects.ErrLoop,
+		},
+		{
+			name:      "loops past the max",
+			locations: map[string]string{"/a": "/b", "/b": "/c", "/c": "/d", "/d": "/b"},
+			want:      redirects.ErrTooManyHops,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := redirectServer(t, tt.locations, false)
+			chain, err := redirects.New(srv.Client(), 3).Resolve(context.Background(), srv.URL+"/a")
+			if errors.Cause(err) != tt.want {
+				t.Errorf("resolve = %v, %v, want %v", chain, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryIndex is an in-process inverted index of posts, for tests and local development
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]*indexedDocument
+	postings map[string]map[string]int
+}
+
+// indexedDocument is a document along with the words in it
+type indexedDocument struct {
+	doc    Document
+	tokens []string
+}
+
+// fieldBreak separates the words of each field so phrases do not match across fields
+const fieldBreak = ""
+
+// NewMemoryIndex news up an empty in-process index
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     map[string]*indexedDocument{},
+		postings: map[string]map[string]int{},
+	}
+}
+
+// Index adds a post to the index, replacing what was indexed for it before
+func (m *MemoryIndex) Index(ctx context.Context, doc *Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(doc.PostUUID)
+	var tokens []string
+	for _, field := range []string{doc.Title, doc.Comment, doc.LinkTitle, doc.LinkDescription} {
+		tokens = append(tokens, Tokenize(field)...)
+		tokens = append(tokens, fieldBreak)
+	}
+	m.docs[doc.PostUUID] = &indexedDocument{doc: *doc, tokens: tokens}
+	for _, token := range tokens {
+		if token == fieldBreak {
+			continue
+		}
+		if m.postings[token] == nil {
+			m.postings[token] = map[string]int{}
+		}
+		m.postings[token][doc.PostUUID]++
+	}
+	return nil
+}
+
+// Remove takes a post out of the index
+func (m *MemoryIndex) Remove(ctx context.Context, postUUID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(postUUID)
+	return nil
+}
+
+func (m *MemoryIndex) remove(postUUID string) {
+	indexed, ok := m.docs[postUUID]
+	if !ok {
+		return
+	}
+	for _, token := range indexed.tokens {
+		if postings, ok := m.postings[token]; ok {
+			delete(postings, postUUID)
+			if len(postings) == 0 {
+				delete(m.postings, token)
+			}
+		}
+	}
+	delete(m.docs, postUUID)
+}
+
+// scoredDocument is a matching document and how well it matches
+type scoredDocument struct {
+	doc   *Document
+	score float64
+}
+
+// Search finds the page of posts matching a query
+func (m *MemoryIndex) Search(ctx context.Context, q *Query) (*Result, error) {
+	if q.Empty() {
+		return &Result{}, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	words := append([]string{}, q.Terms...)
+	var phrases [][]string
+	for _, phrase := range q.Phrases {
+		phraseTokens := strings.Split(phrase, " ")
+		phrases = append(phrases, phraseTokens)
+		words = append(words, phraseTokens...)
+	}
+	var matches []scoredDocument
+	for postUUID := range m.postings[words[0]] {
+		indexed := m.docs[postUUID]
+		if !m.matches(indexed, q, words, phrases) {
+			continue
+		}
+		matches = append(matches, scoredDocument{doc: &indexed.doc, score: m.score(postUUID, words)})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if q.Order == OrderRelevance && a.score != b.score {
+			return a.score > b.score
+		}
+		if a.doc.CreatedAt != b.doc.CreatedAt {
+			return a.doc.CreatedAt > b.doc.CreatedAt
+		}
+		return a.doc.PostUUID > b.doc.PostUUID
+	})
+	result := &Result{}
+	for i := q.Offset; i < len(matches) && i < q.Offset+q.Limit; i++ {
+		result.PostUUIDs = append(result.PostUUIDs, matches[i].doc.PostUUID)
+	}
+	result.HasMore = len(matches) > q.Offset+q.Limit
+	return result, nil
+}
+
+// matches is whether a document has every word and phrase and passes the query's filters
+func (m *MemoryIndex) matches(indexed *indexedDocument, q *Query, words []string, phrases [][]string) bool {
+	doc := indexed.doc
+	if q.UserUUID != "" && doc.UserUUID != q.UserUUID {
+		return false
+	}
+	if q.SourceUUID != "" && !contains(doc.SourceUUIDs, q.SourceUUID) {
+		return false
+	}
+	if q.Domain != "" && doc.Domain != q.Domain {
+		return false
+	}
+	if q.CreatedAfter != 0 && doc.CreatedAt < q.CreatedAfter {
+		return false
+	}
+	if q.CreatedBefore != 0 && doc.CreatedAt >= q.CreatedBefore {
+		return false
+	}
+	for _, word := range words {
+		if m.postings[word][doc.PostUUID] == 0 {
+			return false
+		}
+	}
+	for _, phrase := range phrases {
+		if !containsPhrase(indexed.tokens, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// score sums how often each word is in a post, weighted by how rare the word is across all posts
+func (m *MemoryIndex) score(postUUID string, words []string) float64 {
+	var score float64
+	for _, word := range words {
+		postings := m.postings[word]
+		idf := math.Log(1 + float64(len(m.docs))/float64(len(postings)))
+		score += float64(postings[postUUID]) * idf
+	}
+	return score
+}
+
+func containsPhrase(tokens []string, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		found := true
+		for j, word := range phrase {
+			if tokens[i+j] != word {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package search_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/srcabl/posts/internal/search"
+)
+
+func newTestIndex(t *testing.T) *search.MemoryIndex {
+	index := search.NewMemoryIndex()
+	docs := []*search.Document{
+		{PostUUID: "a", UserUUID: "u1", SourceUUIDs: []string{"s1"}, Domain: "example.com", CreatedAt: 100, Title: "Go generics", Comment: "finally generics land in go"},
+		{PostUUID: "b", UserUUID: "u2", Domain: "news.example", CreatedAt: 200, Title: "Rust and Go", Comment: "comparing generics"},
+		{PostUUID: "c", UserUUID: "u1", Domain: "example.com", CreatedAt: 300, Title: "Cooking", Comment: "nothing about code", LinkTitle: "Go generics explained"},
+	}
+	for _, doc := range docs {
+		if err := index.Index(context.Background(), doc); err != nil {
+			t.Fatalf("failed to index %s: %+v", doc.PostUUID, err)
+		}
+	}
+	return index
+}
+
+func TestParseQuery(t *testing.T) {
+	q := search.ParseQuery(`Go "Generics Land" rust "unclosed`)
+	if want := []string{"go", "rust", "unclosed"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("terms = %v, want %v", q.Terms, want)
+	}
+	if want := []string{"generics land"}; !reflect.DeepEqual(q.Phrases, want) {
+		t.Errorf("phrases = %v, want %v", q.Phrases, want)
+	}
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	index := newTestIndex(t)
+	tests := []struct {
+		name  string
+		query *search.Query
+		want  []string
+	}{
+		{
+			name:  "terms by relevance",
+			query: &search.Query{Terms: []string{"generics"}, Limit: 10},
+			want:  []string{"a", "c", "b"},
+		},
+		{
+			name:  "terms by recency",
+			query: &search.Query{Terms: []string{"generics"}, Order: search.OrderRecency, Limit: 10},
+			want:  []string{"c", "b", "a"},
+		},
+		{
+			name:  "every term must match",
+			query: &search.Query{Terms: []string{"generics", "rust"}, Limit: 10},
+			want:  []string{"b"},
+		},
+		{
+			name:  "phrase",
+			query: &search.Query{Phrases: []string{"generics land"}, Limit: 10},
+			want:  []string{"a"},
+		},
+		{
+			name:  "phrase does not span fields",
+			query: &search.Query{Phrases: []string{"generics finally"}, Limit: 10},
+			want:  nil,
+		},
+		{
+			name:  "user filter",
+			query: &search.Query{Terms: []string{"generics"}, UserUUID: "u1", Order: search.OrderRecency, Limit: 10},
+			want:  []string{"c", "a"},
+		},
+		{
+			name:  "source filter",
+			query: &search.Query{Terms: []string{"generics"}, SourceUUID: "s1", Limit: 10},
+			want:  []string{"a"},
+		},
+		{
+			name:  "domain filter",
+			query: &search.Query{Terms: []string{"go"}, Domain: "news.example", Limit: 10},
+			want:  []string{"b"},
+		},
+		{
+			name:  "date range",
+			query: &search.Query{Terms: []string{"generics"}, CreatedAfter: 150, CreatedBefore: 300, Limit: 10},
+			want:  []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := index.Search(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("failed to search: %+v", err)
+			}
+			if !reflect.DeepEqual(result.PostUUIDs, tt.want) {
+				t.Errorf("got %v, want %v", result.PostUUIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexPaging(t *testing.T) {
+	index := newTestIndex(t)
+	q := &search.Query{Terms: []string{"generics"}, Order: search.OrderRecency, Limit: 2}
+	first, err := index.Search(context.Background(), q)
+	if err != nil {
+		t.Fatalf("failed to search: %+v", err)
+	}
+	if !first.HasMore || !reflect.DeepEqual(first.PostUUIDs, []string{"c", "b"}) {
+		t.Errorf("first page = %v has more %v", first.PostUUIDs, first.HasMore)
+	}
+	q.Offset = 2
+	second, err := index.Search(context.Background(), q)
+	if err != nil {
+		t.Fatalf("failed to search: %+v", err)
+	}
+	if second.HasMore || !reflect.DeepEqual(second.PostUUIDs, []string{"a"}) {
+		t.Errorf("second page = %v has more %v", second.PostUUIDs, second.HasMore)
+	}
+}
+
+func TestMemoryIndexRemove(t *testing.T) {
+	index := newTestIndex(t)
+	if err := index.Remove(context.Background(), "a"); err != nil {
+		t.Fatalf("failed to remove: %+v", err)
+	}
+	result, err := index.Search(context.Background(), &search.Query{Terms: []string{"land"}, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to search: %+v", err)
+	}
+	if len(result.PostUUIDs) != 0 {
+		t.Errorf("removed post still matches: %v", result.PostUUIDs)
+	}
+}
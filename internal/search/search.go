@@ -0,0 +1,114 @@
+package search
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is returned when a search page token cannot be decoded
+var ErrInvalidToken = errors.New("invalid search page token")
+
+// Order is the order search results are listed in
+type Order int
+
+const (
+	// OrderRelevance lists the best matches first
+	OrderRelevance Order = iota
+	// OrderRecency lists the most recently created matches first
+	OrderRecency
+)
+
+// Query is a parsed search along with its filters and the page of results wanted
+type Query struct {
+	// Terms must each appear in a match
+	Terms []string
+	// Phrases must each appear in a match as consecutive words, they are tokenized and joined by spaces
+	Phrases []string
+	// UserUUID only matches posts by the user when set
+	UserUUID string
+	// SourceUUID only matches posts about links the source is a source head of when set
+	SourceUUID string
+	// Domain only matches posts about links on the canonical host when set
+	Domain string
+	// CreatedAfter only matches posts created at or after the unix time when set
+	CreatedAfter int64
+	// CreatedBefore only matches posts created before the unix time when set
+	CreatedBefore int64
+	Order         Order
+	Offset        int
+	Limit         int
+}
+
+// Empty is whether the query has nothing to match on
+func (q *Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+// Document is what is indexed about a post
+type Document struct {
+	PostUUID        string
+	UserUUID        string
+	SourceUUIDs     []string
+	Domain          string
+	CreatedAt       int64
+	Title           string
+	Comment         string
+	LinkTitle       string
+	LinkDescription string
+}
+
+// Result is a page of the uuids of the posts matching a query
+type Result struct {
+	PostUUIDs []string
+	HasMore   bool
+}
+
+// ParseQuery parses search text, "quoted text" is matched as a phrase and everything else as terms
+func ParseQuery(raw string) *Query {
+	q := &Query{}
+	parts := strings.Split(raw, `"`)
+	for i, part := range parts {
+		tokens := Tokenize(part)
+		// odd parts are between quotes, an unclosed quote leaves its text as terms
+		if i%2 == 1 && i < len(parts)-1 {
+			if len(tokens) > 1 {
+				q.Phrases = append(q.Phrases, strings.Join(tokens, " "))
+				continue
+			}
+		}
+		q.Terms = append(q.Terms, tokens...)
+	}
+	return q
+}
+
+// Tokenize splits text into lower cased words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// EncodePageToken encodes the offset of the next page of results
+func EncodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// DecodePageToken decodes the offset of a page of results, an empty token is the first page
+func DecodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.Wrapf(ErrInvalidToken, "bad offset %s", raw)
+	}
+	return offset, nil
+}
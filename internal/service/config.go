@@ -0,0 +1,99 @@
+package service
+
+import "time"
+
+// Config configures the behavior of the posts service, its settings are read from the service section of config.yml
+// and its dependencies are set by boot
+type Config struct {
+	// RestoreGracePeriod is how long after being deleted a post can still be restored
+	RestoreGracePeriod time.Duration `yaml:"restore_grace_period"`
+	// ModeratorUUIDs are the users who can delete and restore other users' posts
+	ModeratorUUIDs []string `yaml:"moderator_uuids"`
+	// FollowGraph looks up who a user follows, which followers only posts need; nil builds home feeds from the
+	// follows in the request and shows followers only posts to their authors alone
+	FollowGraph FollowGraph `yaml:"-"`
+	// MaxFeedFollows is the most users and sources a home feed can be built from
+	MaxFeedFollows int `yaml:"max_feed_follows"`
+	// MaxThreadDepth is the deepest replies are listed under a post
+	MaxThreadDepth int `yaml:"max_thread_depth"`
+	// ReactionKinds are the kinds of reaction users can react to posts with
+	ReactionKinds []string `yaml:"reaction_kinds"`
+	// UserResolver looks up mentioned usernames, nil only resolves mentions of user uuids
+	UserResolver UserResolver `yaml:"-"`
+	// Notifier is told about mentions, nil disables mention notifications
+	Notifier Notifier `yaml:"-"`
+	// SearchIndex finds the posts matching a search, nil searches an in-memory index that RebuildSearchIndex fills
+	// from storage when the service starts, so it holds every searchable post in memory
+	SearchIndex SearchIndex `yaml:"-"`
+	// TrendingTagsWindow is how far back posts count towards trending tags when a request does not say
+	TrendingTagsWindow time.Duration `yaml:"trending_tags_window"`
+	// MaxTrendingTags is the most trending tags that can be listed
+	MaxTrendingTags int `yaml:"max_trending_tags"`
+	// DefaultPageSize is the size of a page of a list when a request does not say
+	DefaultPageSize int `yaml:"default_page_size"`
+	// MaxPageSize is the largest page of a list a request can ask for
+	MaxPageSize int `yaml:"max_page_size"`
+	// MaxBatchSize is the most posts or links that can be fetched in a single batch request
+	MaxBatchSize int `yaml:"max_batch_size"`
+	// MaxTitleLength is the most characters in the title of a post
+	MaxTitleLength int `yaml:"max_title_length"`
+	// MaxCommentLength is the most characters in the comment of a post
+	MaxCommentLength int `yaml:"max_comment_length"`
+	// MaxURLLength is the most bytes in the url of a link
+	MaxURLLength int `yaml:"max_url_length"`
+	// AllowedURLSchemes are the schemes links can have, e.g. so javascript: urls cannot be posted
+	AllowedURLSchemes []string `yaml:"allowed_url_schemes"`
+	// MaxSourceHeads is the most source heads a link can be created with
+	MaxSourceHeads int `yaml:"max_source_heads"`
+	// UnfurlTimeout bounds fetching a link's page to unfurl its metadata
+	UnfurlTimeout time.Duration `yaml:"unfurl_timeout"`
+	// RedirectMaxHops is the most redirects followed when resolving where a new link points
+	RedirectMaxHops int `yaml:"redirect_max_hops"`
+	// RedirectTimeout bounds resolving where a new link points
+	RedirectTimeout time.Duration `yaml:"redirect_timeout"`
+	// LinkCheckInterval is how often the link health worker looks for links due a check
+	LinkCheckInterval time.Duration `yaml:"link_check_interval"`
+	// LinkRecheckAge is how long after a check a link is due to be checked again
+	LinkRecheckAge time.Duration `yaml:"link_recheck_age"`
+	// LinkCheckBatchSize is the most links checked each interval
+	LinkCheckBatchSize int `yaml:"link_check_batch_size"`
+	// LinkCheckConcurrency is the most links checked at once
+	LinkCheckConcurrency int `yaml:"link_check_concurrency"`
+	// LinkCheckPerHostConcurrency is the most links on the same host checked at once
+	LinkCheckPerHostConcurrency int `yaml:"link_check_per_host_concurrency"`
+	// LinkCheckTimeout bounds a single check of a link, not counting the wait for a slot to request its host
+	LinkCheckTimeout time.Duration `yaml:"link_check_timeout"`
+	// LinkDeadAfterFailures is how many checks in a row must fail before a link is dead
+	LinkDeadAfterFailures int `yaml:"link_dead_after_failures"`
+}
+
+// DefaultConfig returns the default service configuration
+func DefaultConfig() *Config {
+	return &Config{
+		RestoreGracePeriod: 30 * 24 * time.Hour,
+		MaxThreadDepth:     8,
+		ReactionKinds:      []string{"like", "love", "laugh", "wow", "sad", "angry"},
+		TrendingTagsWindow: 24 * time.Hour,
+		MaxTrendingTags:    50,
+		DefaultPageSize:    20,
+		MaxPageSize:        100,
+		MaxBatchSize:       100,
+		MaxTitleLength:     255,
+		MaxCommentLength:   10000,
+		MaxURLLength:       2048,
+		AllowedURLSchemes:  []string{"http", "https"},
+		MaxSourceHeads:     10,
+		MaxFeedFollows:     1000,
+		UnfurlTimeout:      10 * time.Second,
+		RedirectMaxHops:    10,
+		RedirectTimeout:    5 * time.Second,
+
+		LinkCheckInterval:           time.Minute,
+		LinkRecheckAge:              24 * time.Hour,
+		LinkCheckBatchSize:          200,
+		LinkCheckConcurrency:        16,
+		LinkCheckPerHostConcurrency: 2,
+		LinkCheckTimeout:            15 * time.Second,
+		LinkDeadAfterFailures:       3,
+	}
+}
@@ -2,79 +2,311 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+	"github.com/srcabl/posts/internal/keyset"
+	"github.com/srcabl/posts/internal/linkcheck"
+	"github.com/srcabl/posts/internal/sqlite"
 	"github.com/srcabl/services/pkg/db/mysql"
-	"github.com/srcabl/services/pkg/proto"
 )
 
 // DataRepositoryGetter defines the beahvior of a data repo getter
 type DataRepositoryGetter interface {
-	GetPost(context.Context, string) (*DBPost, error)
+	GetPost(context.Context, string, *Viewer) (*DBPost, error)
 	GetLinkByUUID(context.Context, string) (*DBLink, error)
 	GetLinkByURL(context.Context, string) (*DBLink, error)
-	GetUsersPosts(context.Context, string, *proto.PaginationToken) ([]*DBPost, []*DBLink, error)
+	GetPostsByUUIDs(context.Context, []string, *Viewer) ([]*DBPost, error)
+	GetAnyPostsByUUIDs(context.Context, []string, *Viewer) ([]*DBPost, error)
+	GetLinksByUUIDs(context.Context, []string) ([]*DBLink, error)
+	GetUsersPosts(context.Context, string, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	GetLinksPosts(context.Context, string, PostOrder, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	ListPostRevisions(context.Context, string) ([]*DBPostRevision, error)
+	ListLinksToCheck(context.Context, int64, int) ([]*DBLink, error)
+	ListDeadLinks(context.Context, *keyset.Page) ([]*DBLink, *keyset.PageInfo, error)
+	GetSourcesLinks(context.Context, string, *keyset.Page) ([]*DBLink, *keyset.PageInfo, error)
+	GetSourcesPosts(context.Context, string, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	GetFeedPosts(context.Context, []string, []string, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	GetTagsPosts(context.Context, string, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	ListTrendingTags(context.Context, int64, int) ([]*DBTagCount, error)
+	GetMentioningPosts(context.Context, string, *Viewer, *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error)
+	GetReplies(context.Context, string, *Viewer, *keyset.Page) ([]*DBPost, *keyset.PageInfo, error)
+	GetDescendants(context.Context, []string, int, *Viewer) ([]*DBPost, error)
+	GetThread(context.Context, string, int, *Viewer, *keyset.Page) ([]*DBPost, *keyset.PageInfo, error)
+	ListReactions(context.Context, string, string, *keyset.Page) ([]*DBReaction, *keyset.PageInfo, error)
+	ListBookmarks(context.Context, string, *Viewer, *keyset.Page) ([]*DBBookmark, []*DBPost, []*DBLink, *keyset.PageInfo, error)
 }
 
 // DataRepositoryCreator defines the beahvior of a data repo creator
 type DataRepositoryCreator interface {
 	CreateLink(context.Context, *DBLink) error
 	CreatePost(context.Context, *DBPost) error
+	CreatePostWithLink(context.Context, *DBLink, *DBPost) error
+	AddReaction(context.Context, *DBReaction) error
+	CreateBookmark(context.Context, *DBBookmark) error
+}
+
+// DataRepositoryUpdater defines the behavior of a data repo updater
+type DataRepositoryUpdater interface {
+	UpdatePost(context.Context, *DBPost) error
+	PublishDraft(context.Context, string, string, int64) error
+	UpsertLinkMetadata(context.Context, *DBLinkMetadata) error
+	RecordLinkCheck(context.Context, *DBLinkCheck, int) error
+}
+
+// DataRepositoryDeleter defines the behavior of a data repo deleter
+type DataRepositoryDeleter interface {
+	DeletePost(context.Context, string, string, bool, int64) error
+	RestorePost(context.Context, string, string, bool, int64) error
+	RemoveReaction(context.Context, string, string, string) error
+	DeleteBookmark(context.Context, string, string) error
 }
 
 // DataRepository defines the behavior of a data repo
 type DataRepository interface {
 	DataRepositoryGetter
 	DataRepositoryCreator
+	DataRepositoryUpdater
+	DataRepositoryDeleter
+}
+
+// PostOrder is the order posts are listed in
+type PostOrder int
+
+const (
+	// PostOrderNewest lists the most recently created posts first
+	PostOrderNewest PostOrder = iota
+	// PostOrderEngagement lists the posts with the most engagement first
+	PostOrderEngagement
+)
+
+// column is the posts column a PostOrder sorts on
+func (o PostOrder) column() string {
+	if o == PostOrderEngagement {
+		return "p.engagement_count"
+	}
+	return "p.created_at"
+}
+
+// pageOrder names a PostOrder for page tokens
+func (o PostOrder) pageOrder() string {
+	if o == PostOrderEngagement {
+		return pageOrderEngagement
+	}
+	return pageOrderNewest
+}
+
+// key is the position of a post in a list in a PostOrder
+func (o PostOrder) key(post *DBPost) keyset.Key {
+	if o == PostOrderEngagement {
+		return keyset.Key{Value: post.EngagementCount, UUID: post.UUID}
+	}
+	return keyset.Key{Value: post.CreatedAt, UUID: post.UUID}
 }
 
+var (
+	// ErrPostNotFound is returned when a post does not exist or has been deleted
+	ErrPostNotFound = &NotFoundError{Resource: "post", Description: "post not found"}
+	// ErrParentPostNotFound is returned when replying to a post that does not exist or has been deleted
+	ErrParentPostNotFound = &NotFoundError{Resource: "post", Description: "parent post not found"}
+	// ErrPostNotRestorable is returned when a post is not deleted or its restore window has passed
+	ErrPostNotRestorable = &PreconditionError{Resource: "post", Description: "post is not deleted or its restore window has passed"}
+	// ErrVersionConflict is returned when a mutation expected a different version of a row
+	ErrVersionConflict = &ConflictError{Resource: "post", Description: "post was modified concurrently"}
+	// ErrRepostedPostNotFound is returned when reposting a post that does not exist
+	ErrRepostedPostNotFound = &NotFoundError{Resource: "post", Description: "reposted post not found"}
+	// ErrRepostedPostDeleted is returned when reposting a post that has been deleted
+	ErrRepostedPostDeleted = &PreconditionError{Resource: "post", Description: "reposted post is deleted"}
+	// ErrRepostedPostNotPublic is returned when reposting a post that is not public
+	ErrRepostedPostNotPublic = &PreconditionError{Resource: "post", Description: "reposted post is not public"}
+	// ErrPostNotDraft is returned when publishing a post that is not a draft
+	ErrPostNotDraft = &PreconditionError{Resource: "post", Description: "post is not a draft"}
+	// ErrNotPostAuthor is returned when a user other than its author edits or publishes a post,
+	// or deletes or restores it without being a moderator
+	ErrNotPostAuthor = &PermissionError{Resource: "post", Description: "only the author of a post can change it"}
+	// ErrPostRemovedByModerator is returned when an author restores a post a moderator removed
+	ErrPostRemovedByModerator = &PermissionError{Resource: "post", Description: "post was removed by a moderator"}
+	// ErrAlreadyReposted is returned when a user plainly reposts a post they have already plainly reposted
+	ErrAlreadyReposted = &AlreadyExistsError{Resource: "post", Description: "post already reposted"}
+)
+
 type dataRepository struct {
-	db *mysql.Client
+	// db is looked up on every use since clients only open their database once the service connects
+	db func() *sql.DB
 }
 
-//NewDataRepository news up a data repository
+// NewDataRepository news up a data repository stored in MySQL
 func NewDataRepository(db *mysql.Client) (DataRepository, error) {
 	return &dataRepository{
-		db: db,
+		db: func() *sql.DB { return db.DB },
 	}, nil
 }
 
-const getUserPostQuery = `
-SELECT
+// NewSQLiteDataRepository news up a data repository stored in SQLite, the client rewrites the few
+// statements where MySQL and SQLite differ so both share the same queries
+func NewSQLiteDataRepository(db *sqlite.Client) (DataRepository, error) {
+	return &dataRepository{
+		db: func() *sql.DB { return db.DB },
+	}, nil
+}
+
+// postMentionsSubquery aggregates a post's mentions as user_uuid:start:end
+const postMentionsSubquery = `SELECT GROUP_CONCAT(CONCAT(pm.user_uuid, ':', pm.start_offset, ':', pm.end_offset) ORDER BY pm.start_offset) FROM post_mentions pm WHERE pm.post_uuid=p.uuid`
+
+// postColumns are the columns of a post selected by post queries, in the order scannedPost scans them
+var postColumns = fmt.Sprintf(`
 	p.uuid,
 	p.user_uuid,
 	p.link_uuid,
+	p.title,
 	p.comment,
 	p.created_by_uuid,
 	p.created_at,
 	p.updated_by_uuid,
 	p.updated_at,
+	p.deleted_by_uuid,
+	p.deleted_at,
+	p.deleted_by_moderator,
+	p.version,
+	p.engagement_count,
+	p.parent_post_uuid,
+	p.root_post_uuid,
+	p.reply_count,
+	p.repost_of_uuid,
+	p.repost_count,
+	p.visibility,
+	p.draft,
+	(SELECT GROUP_CONCAT(pt.tag ORDER BY pt.tag) FROM post_tags pt WHERE pt.post_uuid=p.uuid) AS post_tags,
+	(%s) AS post_mentions,
+	(SELECT GROUP_CONCAT(CONCAT(prc.kind, ':', prc.count) ORDER BY prc.kind) FROM post_reaction_counts prc WHERE prc.post_uuid=p.uuid AND prc.count>0) AS post_reaction_counts`, postMentionsSubquery)
+
+// getAnyPostQuery gets posts whether or not they are deleted, so deleted posts can be shown as tombstones
+var getAnyPostQuery = fmt.Sprintf(`
+SELECT
+	%s
 FROM
 	posts p
 WHERE
-	p.uuid=?
-`
+`, postColumns)
 
-// GetPost gets a post by uuid
-func (dr *dataRepository) GetPost(ctx context.Context, uuid string) (*DBPost, error) {
-	post := DBPost{}
-	scanErr := dr.db.DB.QueryRowContext(ctx, getUserPostQuery, uuid).Scan(
-		&post.UUID,
-		&post.UserUUID,
-		&post.LinkUUID,
-		&post.Comment,
-		&post.CreatedByUUID,
-		&post.CreatedAt,
-		&post.UpdatedByUUID,
-		&post.UpdatedAt,
-	)
+var getPostQuery = fmt.Sprintf(`%s
+	p.deleted_at IS NULL
+AND
+`, getAnyPostQuery)
+
+// GetPost gets a post by uuid if the viewer can see it
+func (dr *dataRepository) GetPost(ctx context.Context, uuid string, viewer *Viewer) (*DBPost, error) {
+	visible, params := visibleWhere("p", viewer, false)
+	query := fmt.Sprintf("%s %s AND p.uuid=?", getPostQuery, visible)
+	post, scanErr := scanPost(dr.db().QueryRowContext(ctx, query, append(params, uuid)...))
 	if scanErr != nil {
-		return nil, errors.Wrapf(scanErr, "failed to scan a rom of posts for user %s", uuid)
+		return nil, errors.Wrapf(aboutResource(scanErr, "post", uuid), "failed to scan a rom of posts for user %s", uuid)
+	}
+	return post, nil
+}
+
+// GetPostsByUUIDs gets posts by their uuids in a single query, the posts are in the order of the uuids
+// and a post that does not exist or the viewer cannot see is nil
+func (dr *dataRepository) GetPostsByUUIDs(ctx context.Context, uuids []string, viewer *Viewer) ([]*DBPost, error) {
+	return dr.getPostsByUUIDs(ctx, getPostQuery, uuids, viewer)
+}
+
+// GetAnyPostsByUUIDs gets posts by their uuids like GetPostsByUUIDs, deleted posts are included as tombstones
+func (dr *dataRepository) GetAnyPostsByUUIDs(ctx context.Context, uuids []string, viewer *Viewer) ([]*DBPost, error) {
+	return dr.getPostsByUUIDs(ctx, getAnyPostQuery, uuids, viewer)
+}
+
+// getPostsByUUIDs gets posts by their uuids with a query built on getAnyPostQuery, in the order of the uuids
+func (dr *dataRepository) getPostsByUUIDs(ctx context.Context, baseQuery string, uuids []string, viewer *Viewer) ([]*DBPost, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	visible, params := visibleWhere("p", viewer, false)
+	query := fmt.Sprintf("%s %s AND p.uuid IN (%s)", baseQuery, visible, placeholders(len(uuids)))
+	found, err := dr.listPosts(ctx, query, append(params, stringArgs(uuids)...)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list posts %v", uuids)
+	}
+	byUUID := map[string]*DBPost{}
+	for _, post := range found {
+		byUUID[post.UUID] = post
+	}
+	posts := make([]*DBPost, len(uuids))
+	for i, id := range uuids {
+		posts[i] = byUUID[id]
+	}
+	return posts, nil
+}
+
+// scanPost scans a row of the columns selected by getPostQuery
+func scanPost(row scanner) (*DBPost, error) {
+	sp := scannedPost{}
+	if scanErr := row.Scan(sp.targets()...); scanErr != nil {
+		return nil, scanErr
+	}
+	return sp.finish()
+}
+
+// scannedPost is a post being scanned from postColumns along with its aggregated columns
+type scannedPost struct {
+	post              DBPost
+	aggTags           sql.NullString
+	aggMentions       sql.NullString
+	aggReactionCounts sql.NullString
+}
+
+// targets are the scan targets of postColumns
+func (sp *scannedPost) targets() []interface{} {
+	return []interface{}{
+		&sp.post.UUID,
+		&sp.post.UserUUID,
+		&sp.post.LinkUUID,
+		&sp.post.Title,
+		&sp.post.Comment,
+		&sp.post.CreatedByUUID,
+		&sp.post.CreatedAt,
+		&sp.post.UpdatedByUUID,
+		&sp.post.UpdatedAt,
+		&sp.post.DeletedByUUID,
+		&sp.post.DeletedAt,
+		&sp.post.DeletedByModerator,
+		&sp.post.Version,
+		&sp.post.EngagementCount,
+		&sp.post.ParentPostUUID,
+		&sp.post.RootPostUUID,
+		&sp.post.ReplyCount,
+		&sp.post.RepostOfUUID,
+		&sp.post.RepostCount,
+		&sp.post.Visibility,
+		&sp.post.Draft,
+		&sp.aggTags,
+		&sp.aggMentions,
+		&sp.aggReactionCounts,
+	}
+}
+
+// finish splits the aggregated columns into the scanned post
+func (sp *scannedPost) finish() (*DBPost, error) {
+	sp.post.Tags = splitGroupConcat(sp.aggTags)
+	mentions, err := splitPostMentions(sp.aggMentions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to split post mentions")
+	}
+	sp.post.Mentions = mentions
+	reactionCounts, err := splitReactionCounts(sp.aggReactionCounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to split post reaction counts")
 	}
-	return &post, nil
+	sp.post.ReactionCounts = reactionCounts
+	return &sp.post, nil
 }
 
 // GetLinkByUUID gets a link by the uuid
@@ -82,128 +314,284 @@ func (dr *dataRepository) GetLinkByUUID(ctx context.Context, uuid string) (*DBLi
 	whereStatement := "l.uuid=?"
 	link, err := dr.getLinkByParam(ctx, whereStatement, uuid)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get link with uuid %s", uuid)
+		return nil, errors.Wrapf(aboutResource(err, "link", uuid), "failed to get link with uuid %s", uuid)
 	}
 	return link, nil
 }
 
-// GetLinkByURL gets a link by the url
+// GetLinksByUUIDs gets links by their uuids in a single query, the links are in the order of the uuids
+// and a link that does not exist is nil
+func (dr *dataRepository) GetLinksByUUIDs(ctx context.Context, uuids []string) ([]*DBLink, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf("%s l.uuid IN (%s)", getLinkQuery, placeholders(len(uuids)))
+	rows, err := dr.db().QueryContext(ctx, query, stringArgs(uuids)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query links %v", uuids)
+	}
+	defer rows.Close()
+	byUUID := map[string]*DBLink{}
+	for rows.Next() {
+		link, scanErr := scanLink(rows)
+		if scanErr != nil {
+			return nil, errors.Wrapf(scanErr, "failed to scan a row of links %v", uuids)
+		}
+		byUUID[link.UUID] = link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to iterate links %v", uuids)
+	}
+	links := make([]*DBLink, len(uuids))
+	for i, id := range uuids {
+		links[i] = byUUID[id]
+	}
+	return links, nil
+}
+
+// GetLinkByURL gets a link by the canonical form of the url, matching either the url the link was
+// submitted with or the url it resolved to, links submitted with the url are preferred
 func (dr *dataRepository) GetLinkByURL(ctx context.Context, url string) (*DBLink, error) {
-	whereStatement := "l.url=?"
-	link, err := dr.getLinkByParam(ctx, whereStatement, url)
+	canonicalURL, err := canonical.URL(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to canonicalize url %s", url)
+	}
+	hash := hashURL(canonicalURL)
+	whereStatement := `
+	l.canonical_url_hash=? OR l.resolved_url_hash=?
+ORDER BY
+	l.canonical_url_hash=? DESC,
+	l.created_at ASC
+LIMIT 1`
+	link, err := dr.getLinkByParam(ctx, whereStatement, hash, hash, hash)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get link with url %s", url)
+		return nil, errors.Wrapf(aboutResource(err, "link", url), "failed to get link with url %s", url)
 	}
 	return link, nil
 }
 
 const getLinkQuery = `
 SELECT
-	l.uuid
+	l.uuid,
 	l.url,
+	l.canonical_url,
+	l.resolved_url,
 	l.created_by_uuid,
 	l.created_at,
 	l.updated_by_uuid,
 	l.updated_at,
-	GROUP_CONCAT(lsh.source_uuid)
+	l.version,
+	l.status,
+	l.status_checked_at,
+	(SELECT GROUP_CONCAT(lsh.source_uuid) FROM link_source_heads lsh WHERE lsh.link_uuid=l.uuid) AS link_sources,
+	lm.link_uuid,
+	lm.title,
+	lm.description,
+	lm.canonical_url,
+	lm.site_name,
+	lm.image_url,
+	lm.published_at,
+	lm.fetched_at
 FROM
 	links l
-INNER JOIN
-	link_source_heads lsh
+LEFT JOIN
+	link_metadata lm
 ON
-	l.uuid=lsh.link_uuid
+	l.uuid=lm.link_uuid
 WHERE
 `
 
-func (dr *dataRepository) getLinkByParam(ctx context.Context, whereStatement string, param string) (*DBLink, error) {
-	link := DBLink{}
-	var aggSources string
+func (dr *dataRepository) getLinkByParam(ctx context.Context, whereStatement string, params ...interface{}) (*DBLink, error) {
 	query := fmt.Sprintf("%s %s", getLinkQuery, whereStatement)
-	scanErr := dr.db.DB.QueryRowContext(ctx, query, param).Scan(
+	link, scanErr := scanLink(dr.db().QueryRowContext(ctx, query, params...))
+	if scanErr != nil {
+		return nil, errors.Wrapf(scanErr, "failed to scan a rom of link for params %v", params)
+	}
+	return link, nil
+}
+
+// scanner is satisfied by both sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLink scans a row of the columns selected by getLinkQuery
+func scanLink(row scanner) (*DBLink, error) {
+	link := DBLink{}
+	var aggSources sql.NullString
+	meta := nullLinkMetadata{}
+	scanErr := row.Scan(
 		&link.UUID,
 		&link.URL,
+		&link.CanonicalURL,
+		&link.ResolvedURL,
 		&link.CreatedByUUID,
 		&link.CreatedAt,
 		&link.UpdatedByUUID,
 		&link.UpdatedAt,
+		&link.Version,
+		&link.Status,
+		&link.StatusCheckedAt,
 		&aggSources,
+		&meta.LinkUUID,
+		&meta.Title,
+		&meta.Description,
+		&meta.CanonicalURL,
+		&meta.SiteName,
+		&meta.ImageURL,
+		&meta.PublishedAt,
+		&meta.FetchedAt,
 	)
-	if aggSources != "" {
-		link.SourceHeadUUIDs = strings.Split(aggSources, ",")
-	}
 	if scanErr != nil {
-		return nil, errors.Wrapf(scanErr, "failed to scan a rom of link for param %s", param)
+		return nil, scanErr
 	}
+	link.SourceHeadUUIDs = splitGroupConcat(aggSources)
+	link.Metadata = meta.toDB()
 	return &link, nil
 }
 
-const getUsersPostsQuery = `
+// splitGroupConcat splits the values aggregated by GROUP_CONCAT, e.g. the source head uuids of a link
+func splitGroupConcat(agg sql.NullString) []string {
+	if !agg.Valid || agg.String == "" {
+		return nil
+	}
+	return strings.Split(agg.String, ",")
+}
+
+// getAnyPostsWithLinksQuery gets posts with their links whether or not the posts are deleted
+var getAnyPostsWithLinksQuery = fmt.Sprintf(`
 SELECT
-	p.uuid,
-	p.user_uuid,
-	p.link_uuid,
-	p.comment,
-	p.created_by_uuid,
-	p.created_at,
-	p.updated_by_uuid,
-	p.updated_at,
+	%s,
 	l.uuid,
 	l.url,
+	l.canonical_url,
+	l.resolved_url,
 	l.created_by_uuid,
 	l.created_at,
 	l.updated_by_uuid,
 	l.updated_at,
-	(SELECT GROUP_CONCAT(lsh.source_uuid) FROM link_source_heads lsh WHERE lsh.link_uuid=l.uuid) AS link_sources
+	l.version,
+	l.status,
+	l.status_checked_at,
+	(SELECT GROUP_CONCAT(lsh.source_uuid) FROM link_source_heads lsh WHERE lsh.link_uuid=l.uuid) AS link_sources,
+	lm.link_uuid,
+	lm.title,
+	lm.description,
+	lm.canonical_url,
+	lm.site_name,
+	lm.image_url,
+	lm.published_at,
+	lm.fetched_at
 FROM
 	posts p
 INNER JOIN
 	links l
 ON
 	p.link_uuid=l.uuid
+LEFT JOIN
+	link_metadata lm
+ON
+	l.uuid=lm.link_uuid
 WHERE
-	p.user_uuid=?	
-`
+`, postColumns)
+
+var getPostsWithLinksQuery = fmt.Sprintf(`%s
+	p.deleted_at IS NULL
+AND
+`, getAnyPostsWithLinksQuery)
 
-// GetUsersPosts gets the posts from a user from the database
-func (dr *dataRepository) GetUsersPosts(ctx context.Context, userUUID string, token *proto.PaginationToken) ([]*DBPost, []*DBLink, error) {
-	query := token.ApplyToQuery(getUsersPostsQuery, "p.created_at")
-	fmt.Printf("query: %s\n", query)
-	rows, err := dr.db.DB.QueryContext(ctx, query, userUUID)
+// GetUsersPosts gets the posts from a user the viewer can see from the database
+func (dr *dataRepository) GetUsersPosts(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, PostOrderNewest, viewer, "p.user_uuid=?", userUUID)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to query posts for user %s", userUUID)
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for user %s", userUUID)
 	}
+	return posts, links, info, nil
+}
+
+// GetLinksPosts gets the posts about a link the viewer can see from the database in the given order
+func (dr *dataRepository) GetLinksPosts(ctx context.Context, linkUUID string, order PostOrder, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, order, viewer, "p.link_uuid=?", linkUUID)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for link %s", linkUUID)
+	}
+	return posts, links, info, nil
+}
+
+// pagePostsWithLinks lists a page of the posts matching a condition that the viewer can see along with their links
+func (dr *dataRepository) pagePostsWithLinks(ctx context.Context, page *keyset.Page, order PostOrder, viewer *Viewer, where string, params ...interface{}) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	visible, visibleParams := visibleWhere("p", viewer, true)
+	query, pageParams := page.Apply(fmt.Sprintf("%s %s AND %s", getPostsWithLinksQuery, visible, where), order.column(), "p.uuid")
+	params = append(visibleParams, params...)
+	posts, links, err := dr.listPostsWithLinks(ctx, query, append(params, pageParams...)...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keys := make([]keyset.Key, len(posts))
+	for i, post := range posts {
+		keys[i] = order.key(post)
+	}
+	n, info, err := page.Finish(keys, func(i, j int) {
+		posts[i], posts[j] = posts[j], posts[i]
+		links[i], links[j] = links[j], links[i]
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to finish page of posts")
+	}
+	return posts[:n], links[:n], info, nil
+}
+
+// listPostsWithLinks runs a query built on getPostsWithLinksQuery or getAnyPostsWithLinksQuery, the links are in the order of their posts
+func (dr *dataRepository) listPostsWithLinks(ctx context.Context, query string, params ...interface{}) ([]*DBPost, []*DBLink, error) {
+	rows, err := dr.db().QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to query posts")
+	}
+	defer rows.Close()
 	var posts []*DBPost
 	var links []*DBLink
 	for rows.Next() {
-		post := DBPost{}
+		sp := scannedPost{}
 		link := DBLink{}
-		var aggSources string
-		scanErr := rows.Scan(
-			&post.UUID,
-			&post.UserUUID,
-			&post.LinkUUID,
-			&post.Comment,
-			&post.CreatedByUUID,
-			&post.CreatedAt,
-			&post.UpdatedByUUID,
-			&post.UpdatedAt,
+		var aggSources sql.NullString
+		meta := nullLinkMetadata{}
+		scanErr := rows.Scan(append(sp.targets(),
 			&link.UUID,
 			&link.URL,
+			&link.CanonicalURL,
+			&link.ResolvedURL,
 			&link.CreatedByUUID,
 			&link.CreatedAt,
 			&link.UpdatedByUUID,
 			&link.UpdatedAt,
+			&link.Version,
+			&link.Status,
+			&link.StatusCheckedAt,
 			&aggSources,
-		)
+			&meta.LinkUUID,
+			&meta.Title,
+			&meta.Description,
+			&meta.CanonicalURL,
+			&meta.SiteName,
+			&meta.ImageURL,
+			&meta.PublishedAt,
+			&meta.FetchedAt,
+		)...)
 		if scanErr != nil {
-			return nil, nil, errors.Wrapf(scanErr, "failed to scan a rom of posts for user %s", userUUID)
+			return nil, nil, errors.Wrap(scanErr, "failed to scan a row of posts")
 		}
-		posts = append(posts, &post)
-		if aggSources != "" {
-			link.SourceHeadUUIDs = strings.Split(aggSources, ",")
+		post, err := sp.finish()
+		if err != nil {
+			return nil, nil, err
 		}
+		posts = append(posts, post)
+		link.SourceHeadUUIDs = splitGroupConcat(aggSources)
+		link.Metadata = meta.toDB()
 		links = append(links, &link)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to iterate posts")
+	}
 	return posts, links, nil
 }
 
@@ -218,25 +606,87 @@ INSERT INTO
 		created_by_uuid,
 		created_at,
 		updated_by_uuid,
-		updated_at
+		updated_at,
+		version,
+		parent_post_uuid,
+		root_post_uuid,
+		repost_of_uuid,
+		visibility,
+		draft
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?)
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
-// CreatePost adds a post in the database
+// CreatePost adds a post in the database, a reply is about its parent's link when it has none of its own
+// and a repost is about the reposted post's link
 func (dr *dataRepository) CreatePost(ctx context.Context, post *DBPost) error {
-	tx, err := dr.db.DB.BeginTx(ctx, nil)
+	tx, err := dr.db().BeginTx(ctx, nil)
 	if err != nil {
 		fmt.Printf("Failed to begin tx: %+v\n", err)
 		return errors.Wrapf(err, "failed to begin transaction")
 	}
-	stm, err := tx.PrepareContext(ctx, createPostStatement)
+	if err := dr.createPost(ctx, tx, post); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %+v", post)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			fmt.Printf("Failed to rollback after commit: %+v\n", rollErr)
+			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %+v", post)
+		}
+		fmt.Printf("Failed to commit: %+v\n", err)
+		return errors.Wrapf(err, "failed to create post %+v", post)
+	}
+	return nil
+}
+
+// CreatePostWithLink adds a post about a link in the database in one transaction, the link is created unless a link
+// with the same canonical or resolved url exists, whose source heads are merged with the new link's instead;
+// link.UUID and post.LinkUUID are set to the link the post is about
+func (dr *dataRepository) CreatePostWithLink(ctx context.Context, link *DBLink, post *DBPost) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
 	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := dr.findOrCreateLink(ctx, tx, link); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to create link %+v", link)
+		}
+		return err
+	}
+	post.LinkUUID = link.UUID
+	if err := dr.createPost(ctx, tx, post); err != nil {
 		if rollErr := tx.Rollback(); rollErr != nil {
-			fmt.Printf("Failed to rollback after prepare: %+v\n", rollErr)
 			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %+v", post)
 		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %s with link %s", post.UUID, link.URL)
+		}
+		return errors.Wrapf(err, "failed to create post %s with link %s", post.UUID, link.URL)
+	}
+	return nil
+}
+
+// createPost adds a post within a transaction, attaching it to the post it replies to or reposts
+func (dr *dataRepository) createPost(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	if post.ParentPostUUID.Valid {
+		if err := dr.attachReply(ctx, tx, post); err != nil {
+			return errors.Wrapf(err, "failed to attach reply to post %s", post.ParentPostUUID.String)
+		}
+	}
+	if post.RepostOfUUID.Valid {
+		if err := dr.attachRepost(ctx, tx, post); err != nil {
+			return errors.Wrapf(err, "failed to attach repost to post %s", post.RepostOfUUID.String)
+		}
+	}
+	stm, err := tx.PrepareContext(ctx, createPostStatement)
+	if err != nil {
 		fmt.Printf("Failed to prepare statement: %+v\n", err)
 		return errors.Wrapf(err, "failed to prepare statement to create post %+v", post)
 	}
@@ -250,43 +700,41 @@ func (dr *dataRepository) CreatePost(ctx context.Context, post *DBPost) error {
 		post.CreatedAt,
 		post.UpdatedByUUID.String,
 		post.UpdatedAt.Int64,
+		post.Version,
+		post.ParentPostUUID,
+		post.RootPostUUID,
+		post.RepostOfUUID,
+		post.Visibility,
+		post.Draft,
 	)
 	if err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			fmt.Printf("Failed to rollback after execute statement: %+v\n", rollErr)
-			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %+v", post)
-		}
 		fmt.Printf("Failed to execute statement: %+v\n", err)
 		return errors.Wrapf(err, "failed to execute statment to create post %+v", post)
 	}
-	if err := tx.Commit(); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			fmt.Printf("Failed to rollback after commit: %+v\n", rollErr)
-			return errors.Wrapf(rollErr, "failed to rollback after failing to create post %+v", post)
-		}
-		fmt.Printf("Failed to commit: %+v\n", err)
-		return errors.Wrapf(err, "failed to create post %+v", post)
+	if err := dr.replacePostTags(ctx, tx, post); err != nil {
+		return errors.Wrap(err, "failed to create in the post tags table")
+	}
+	if err := dr.replacePostMentions(ctx, tx, post); err != nil {
+		return errors.Wrap(err, "failed to create in the post mentions table")
+	}
+	if err := dr.countRepost(ctx, tx, post.UUID, 1); err != nil {
+		return errors.Wrap(err, "failed to count repost")
 	}
 	return nil
 }
 
-// CreateLink adds a link in the database
+// CreateLink adds a link in the database, if a link with the same canonical or resolved url exists
+// its source heads are merged with the new link's and link.UUID is set to the existing link
 func (dr *dataRepository) CreateLink(ctx context.Context, link *DBLink) error {
-	tx, err := dr.db.DB.BeginTx(ctx, nil)
+	tx, err := dr.db().BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Wrapf(err, "failed to begin transaction")
 	}
-	if err := dr.createLink(ctx, tx, link); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrapf(rollErr, "failed to rollback after failing to create link %+v", link)
-		}
-		return errors.Wrap(err, "failed to create in the link table")
-	}
-	if err := dr.createLinkSourceHeads(ctx, tx, link); err != nil {
+	if err := dr.findOrCreateLink(ctx, tx, link); err != nil {
 		if rollErr := tx.Rollback(); rollErr != nil {
 			return errors.Wrapf(rollErr, "failed to rollback after failing to create link %+v", link)
 		}
-		return errors.Wrap(err, "failed to create in the link source head table")
+		return err
 	}
 	if err := tx.Commit(); err != nil {
 		if rollErr := tx.Rollback(); rollErr != nil {
@@ -297,18 +745,107 @@ func (dr *dataRepository) CreateLink(ctx context.Context, link *DBLink) error {
 	return nil
 }
 
+// findOrCreateLink adds a link within a transaction unless a link with the same canonical or resolved url exists,
+// in which case its source heads are merged with the new link's and link.UUID is set to the existing link,
+// including a link another transaction creates between the lookup and the insert
+func (dr *dataRepository) findOrCreateLink(ctx context.Context, tx *sql.Tx, link *DBLink) error {
+	existingUUID, err := dr.lockLinkByURLs(ctx, tx, link.CanonicalURL, link.ResolvedURL)
+	if err != nil {
+		return errors.Wrap(err, "failed to look up existing link")
+	}
+	if existingUUID == "" {
+		existingUUID, err = dr.createLinkWithSourceHeads(ctx, tx, link)
+		if err != nil {
+			return errors.Wrap(err, "failed to create link")
+		}
+		if existingUUID == "" {
+			return nil
+		}
+	}
+	if err := dr.mergeLinkSourceHeads(ctx, tx, existingUUID, link); err != nil {
+		return errors.Wrap(err, "failed to merge in the link source head table")
+	}
+	link.UUID = existingUUID
+	return nil
+}
+
+const lockLinkByURLsQuery = `
+SELECT
+	l.uuid
+FROM
+	links l
+WHERE
+	l.canonical_url_hash IN (?, ?)
+OR
+	l.resolved_url_hash IN (?, ?)
+ORDER BY
+	l.canonical_url_hash=? DESC,
+	l.created_at ASC
+LIMIT 1
+FOR UPDATE
+`
+
+// lockLinkByURLs gets the uuid of the link that was submitted with or resolved to either url,
+// locking it for the rest of the transaction, it returns an empty uuid when there is no such link
+func (dr *dataRepository) lockLinkByURLs(ctx context.Context, tx *sql.Tx, canonicalURL string, resolvedURL string) (string, error) {
+	canonicalHash, resolvedHash := hashURL(canonicalURL), hashURL(resolvedURL)
+	var linkUUID string
+	scanErr := tx.QueryRowContext(ctx, lockLinkByURLsQuery,
+		canonicalHash,
+		resolvedHash,
+		canonicalHash,
+		resolvedHash,
+		canonicalHash,
+	).Scan(&linkUUID)
+	if scanErr == sql.ErrNoRows {
+		return "", nil
+	}
+	if scanErr != nil {
+		return "", errors.Wrapf(scanErr, "failed to scan link with url %s or %s", canonicalURL, resolvedURL)
+	}
+	return linkUUID, nil
+}
+
+// createLinkWithSourceHeads adds a link and its source heads, unless another transaction added a link with the same
+// url first, in which case nothing is added and the uuid of that link is returned; the duplicate key only fails the
+// insert, so the transaction can still look up the link, which the locking read sees once it is committed
+func (dr *dataRepository) createLinkWithSourceHeads(ctx context.Context, tx *sql.Tx, link *DBLink) (string, error) {
+	if err := dr.createLink(ctx, tx, link); err != nil {
+		if !duplicateKey(err) {
+			return "", errors.Wrap(err, "failed to create in the link table")
+		}
+		existingUUID, lookupErr := dr.lockLinkByURLs(ctx, tx, link.CanonicalURL, link.ResolvedURL)
+		if lookupErr != nil {
+			return "", errors.Wrap(lookupErr, "failed to look up link created concurrently")
+		}
+		if existingUUID == "" {
+			return "", errors.Wrap(aboutResource(err, "link", link.CanonicalURL), "failed to create in the link table")
+		}
+		return existingUUID, nil
+	}
+	if err := dr.createLinkSourceHeads(ctx, tx, link); err != nil {
+		return "", errors.Wrap(err, "failed to create in the link source head table")
+	}
+	return "", nil
+}
+
 const createLinkStatement = `
 INSERT INTO
 	links (
 		uuid,
 		url,
+		canonical_url,
+		canonical_url_hash,
+		resolved_url,
+		resolved_url_hash,
 		created_by_uuid,
 		created_at,
 		updated_by_uuid,
-		updated_at
+		updated_at,
+		version
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?)
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 func (dr *dataRepository) createLink(ctx context.Context, tx *sql.Tx, link *DBLink) error {
@@ -319,10 +856,15 @@ func (dr *dataRepository) createLink(ctx context.Context, tx *sql.Tx, link *DBLi
 	_, err = stm.ExecContext(ctx,
 		link.UUID,
 		link.URL,
+		link.CanonicalURL,
+		hashURL(link.CanonicalURL),
+		link.ResolvedURL,
+		hashURL(link.ResolvedURL),
 		link.CreatedByUUID,
 		link.CreatedAt,
 		link.UpdatedByUUID.String,
 		link.UpdatedAt.Int64,
+		link.Version,
 	)
 	if err != nil {
 		return errors.Wrapf(err, "failed to execute statment to create link %+v", link)
@@ -356,3 +898,1717 @@ func (dr *dataRepository) createLinkSourceHeads(ctx context.Context, tx *sql.Tx,
 	}
 	return nil
 }
+
+const mergeLinkSourceHeadStatement = `
+INSERT IGNORE INTO
+	link_source_heads(
+		link_uuid,
+		source_uuid
+	)
+VALUES
+	(?, ?)
+`
+
+const touchLinkStatement = `
+UPDATE
+	links
+SET
+	updated_by_uuid=?,
+	updated_at=?,
+	version=version+1
+WHERE
+	uuid=?
+`
+
+// mergeLinkSourceHeads adds the source heads of link to the existing link, bumping its version if any were new
+func (dr *dataRepository) mergeLinkSourceHeads(ctx context.Context, tx *sql.Tx, existingUUID string, link *DBLink) error {
+	stm, err := tx.PrepareContext(ctx, mergeLinkSourceHeadStatement)
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare statement to merge link source heads %+v", link)
+	}
+	var merged int64
+	for _, s := range link.SourceHeadUUIDs {
+		res, err := stm.ExecContext(ctx,
+			existingUUID,
+			s,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to execute statment to merge link source head %+v", link)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "failed to read affected rows")
+		}
+		merged += affected
+	}
+	if merged == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, touchLinkStatement,
+		link.UpdatedByUUID.String,
+		link.UpdatedAt.Int64,
+		existingUUID,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to touch link %s", existingUUID)
+	}
+	return nil
+}
+
+const upsertLinkMetadataStatement = `
+INSERT INTO
+	link_metadata (
+		link_uuid,
+		title,
+		description,
+		canonical_url,
+		site_name,
+		image_url,
+		published_at,
+		fetched_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+	title=VALUES(title),
+	description=VALUES(description),
+	canonical_url=VALUES(canonical_url),
+	site_name=VALUES(site_name),
+	image_url=VALUES(image_url),
+	published_at=VALUES(published_at),
+	fetched_at=VALUES(fetched_at)
+`
+
+// UpsertLinkMetadata stores the metadata unfurled for a link, replacing any previous metadata
+func (dr *dataRepository) UpsertLinkMetadata(ctx context.Context, meta *DBLinkMetadata) error {
+	_, err := dr.db().ExecContext(ctx, upsertLinkMetadataStatement,
+		meta.LinkUUID,
+		meta.Title,
+		meta.Description,
+		meta.CanonicalURL,
+		meta.SiteName,
+		meta.ImageURL,
+		meta.PublishedAt,
+		meta.FetchedAt,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to upsert metadata for link %s", meta.LinkUUID)
+	}
+	return nil
+}
+
+const listLinksToCheckQuery = `
+SELECT
+	l.uuid,
+	l.url
+FROM
+	links l
+WHERE
+	l.status_checked_at IS NULL
+OR
+	l.status_checked_at<?
+ORDER BY
+	l.status_checked_at ASC
+LIMIT ?
+`
+
+// ListLinksToCheck gets the links that have not been checked since checkedBefore, least recently checked first
+func (dr *dataRepository) ListLinksToCheck(ctx context.Context, checkedBefore int64, limit int) ([]*DBLink, error) {
+	rows, err := dr.db().QueryContext(ctx, listLinksToCheckQuery, checkedBefore, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query links to check")
+	}
+	defer rows.Close()
+	var links []*DBLink
+	for rows.Next() {
+		link := DBLink{}
+		if scanErr := rows.Scan(&link.UUID, &link.URL); scanErr != nil {
+			return nil, errors.Wrap(scanErr, "failed to scan a row of links to check")
+		}
+		links = append(links, &link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate links to check")
+	}
+	return links, nil
+}
+
+// ListDeadLinks gets the links the health checker found to be dead
+func (dr *dataRepository) ListDeadLinks(ctx context.Context, page *keyset.Page) ([]*DBLink, *keyset.PageInfo, error) {
+	links, info, err := dr.pageLinks(ctx, page, linkOrderChecked, "l.status=?", linkcheck.StatusDead)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list dead links")
+	}
+	return links, info, nil
+}
+
+const sourceHeadLinksWhere = `
+	l.uuid IN (SELECT lsh.link_uuid FROM link_source_heads lsh WHERE lsh.source_uuid=?)
+`
+
+// GetSourcesLinks gets the links a source is a source head of
+func (dr *dataRepository) GetSourcesLinks(ctx context.Context, sourceUUID string, page *keyset.Page) ([]*DBLink, *keyset.PageInfo, error) {
+	links, info, err := dr.pageLinks(ctx, page, linkOrderNewest, sourceHeadLinksWhere, sourceUUID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list links for source %s", sourceUUID)
+	}
+	return links, info, nil
+}
+
+// GetSourcesPosts gets the posts the viewer can see about links a source is a source head of
+func (dr *dataRepository) GetSourcesPosts(ctx context.Context, sourceUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, PostOrderNewest, viewer, sourceHeadLinksWhere, sourceUUID)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for source %s", sourceUUID)
+	}
+	return posts, links, info, nil
+}
+
+// GetFeedPosts gets the posts the viewer can see by the followed users or about links from the followed sources,
+// only the newest of the feed's posts about each link is included
+func (dr *dataRepository) GetFeedPosts(ctx context.Context, userUUIDs []string, sourceUUIDs []string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	if len(userUUIDs) == 0 && len(sourceUUIDs) == 0 {
+		return nil, nil, &keyset.PageInfo{}, nil
+	}
+	feedWhere, feedParams := feedPostsWhere("p", userUUIDs, sourceUUIDs)
+	newerWhere, newerParams := feedPostsWhere("np", userUUIDs, sourceUUIDs)
+	newerVisible, newerVisibleParams := visibleWhere("np", viewer, true)
+	where := fmt.Sprintf(`%s
+AND NOT EXISTS (
+	SELECT 1 FROM posts np
+	WHERE np.link_uuid=p.link_uuid
+	AND np.deleted_at IS NULL
+	AND %s
+	AND %s
+	AND (np.created_at > p.created_at OR (np.created_at = p.created_at AND np.uuid > p.uuid))
+)`, feedWhere, newerWhere, newerVisible)
+	params := append(feedParams, newerParams...)
+	params = append(params, newerVisibleParams...)
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, PostOrderNewest, viewer, where, params...)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to list feed posts")
+	}
+	return posts, links, info, nil
+}
+
+// feedPostsWhere builds the condition matching the posts of alias that belong in a feed
+func feedPostsWhere(alias string, userUUIDs []string, sourceUUIDs []string) (string, []interface{}) {
+	var conds []string
+	var params []interface{}
+	if len(userUUIDs) > 0 {
+		conds = append(conds, fmt.Sprintf("%s.user_uuid IN (%s)", alias, placeholders(len(userUUIDs))))
+		params = append(params, stringArgs(userUUIDs)...)
+	}
+	if len(sourceUUIDs) > 0 {
+		conds = append(conds, fmt.Sprintf(
+			"%s.link_uuid IN (SELECT lsh.link_uuid FROM link_source_heads lsh WHERE lsh.source_uuid IN (%s))",
+			alias, placeholders(len(sourceUUIDs)),
+		))
+		params = append(params, stringArgs(sourceUUIDs)...)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(conds, " OR ")), params
+}
+
+// linkOrder is the order links are listed in
+type linkOrder int
+
+const (
+	// linkOrderNewest lists the most recently created links first
+	linkOrderNewest linkOrder = iota
+	// linkOrderChecked lists the most recently checked links first
+	linkOrderChecked
+)
+
+// column is the links column a linkOrder sorts on
+func (o linkOrder) column() string {
+	if o == linkOrderChecked {
+		return "l.status_checked_at"
+	}
+	return "l.created_at"
+}
+
+// key is the position of a link in a list in a linkOrder
+func (o linkOrder) key(link *DBLink) keyset.Key {
+	if o == linkOrderChecked {
+		return keyset.Key{Value: link.StatusCheckedAt.Int64, UUID: link.UUID}
+	}
+	return keyset.Key{Value: link.CreatedAt, UUID: link.UUID}
+}
+
+// pageLinks lists a page of the links matching a condition
+func (dr *dataRepository) pageLinks(ctx context.Context, page *keyset.Page, order linkOrder, where string, params ...interface{}) ([]*DBLink, *keyset.PageInfo, error) {
+	query, pageParams := page.Apply(fmt.Sprintf("%s %s", getLinkQuery, where), order.column(), "l.uuid")
+	links, err := dr.listLinks(ctx, query, append(params, pageParams...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]keyset.Key, len(links))
+	for i, link := range links {
+		keys[i] = order.key(link)
+	}
+	n, info, err := page.Finish(keys, func(i, j int) {
+		links[i], links[j] = links[j], links[i]
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of links")
+	}
+	return links[:n], info, nil
+}
+
+// listLinks runs a query built on getLinkQuery
+func (dr *dataRepository) listLinks(ctx context.Context, query string, params ...interface{}) ([]*DBLink, error) {
+	rows, err := dr.db().QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query links")
+	}
+	defer rows.Close()
+	var links []*DBLink
+	for rows.Next() {
+		link, scanErr := scanLink(rows)
+		if scanErr != nil {
+			return nil, errors.Wrap(scanErr, "failed to scan a row of links")
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate links")
+	}
+	return links, nil
+}
+
+const lockLinkHealthQuery = `
+SELECT
+	l.status,
+	l.consecutive_failures
+FROM
+	links l
+WHERE
+	l.uuid=?
+FOR UPDATE
+`
+
+const createLinkCheckStatement = `
+INSERT INTO
+	link_checks (
+		uuid,
+		link_uuid,
+		checked_at,
+		status,
+		http_status,
+		final_url,
+		error
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?)
+`
+
+const updateLinkHealthStatement = `
+UPDATE
+	links
+SET
+	status=?,
+	status_checked_at=?,
+	consecutive_failures=?
+WHERE
+	uuid=?
+`
+
+// RecordLinkCheck stores a check of a link in its history and updates the link's status,
+// the link is dead once deadAfter checks in a row have failed
+func (dr *dataRepository) RecordLinkCheck(ctx context.Context, check *DBLinkCheck, deadAfter int) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := dr.recordLinkCheck(ctx, tx, check, deadAfter); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to record check %+v", check)
+		}
+		return errors.Wrapf(err, "failed to record check of link %s", check.LinkUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit check of link %s", check.LinkUUID)
+	}
+	return nil
+}
+
+func (dr *dataRepository) recordLinkCheck(ctx context.Context, tx *sql.Tx, check *DBLinkCheck, deadAfter int) error {
+	var previous linkcheck.Status
+	var failures int
+	scanErr := tx.QueryRowContext(ctx, lockLinkHealthQuery, check.LinkUUID).Scan(&previous, &failures)
+	if scanErr != nil {
+		return errors.Wrapf(scanErr, "failed to scan health of link %s", check.LinkUUID)
+	}
+	if check.OK {
+		failures = 0
+	} else {
+		failures++
+	}
+	check.Status = linkcheck.NextStatus(previous, check.OK, check.Redirected, failures, deadAfter)
+	_, err := tx.ExecContext(ctx, createLinkCheckStatement,
+		check.UUID,
+		check.LinkUUID,
+		check.CheckedAt,
+		check.Status,
+		check.HTTPStatus,
+		check.FinalURL,
+		check.Error,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to create link check %+v", check)
+	}
+	_, err = tx.ExecContext(ctx, updateLinkHealthStatement,
+		check.Status,
+		check.CheckedAt,
+		failures,
+		check.LinkUUID,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to update health of link %s", check.LinkUUID)
+	}
+	return nil
+}
+
+// placeholders returns n comma separated query placeholders for an IN clause
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// stringArgs converts strings to query args
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// hashURL hashes a canonical url for the unique index on links
+func hashURL(canonicalURL string) string {
+	sum := sha256.Sum256([]byte(canonicalURL))
+	return hex.EncodeToString(sum[:])
+}
+
+const listPostRevisionsQuery = `
+SELECT
+	r.uuid,
+	r.post_uuid,
+	r.revision,
+	r.title,
+	r.comment,
+	r.created_by_uuid,
+	r.created_at
+FROM
+	post_revisions r
+WHERE
+	r.post_uuid=?
+ORDER BY
+	r.revision DESC
+`
+
+// ListPostRevisions gets the prior versions of a post, newest first
+func (dr *dataRepository) ListPostRevisions(ctx context.Context, postUUID string) ([]*DBPostRevision, error) {
+	rows, err := dr.db().QueryContext(ctx, listPostRevisionsQuery, postUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query revisions for post %s", postUUID)
+	}
+	defer rows.Close()
+	var revisions []*DBPostRevision
+	for rows.Next() {
+		revision := DBPostRevision{}
+		scanErr := rows.Scan(
+			&revision.UUID,
+			&revision.PostUUID,
+			&revision.Revision,
+			&revision.Title,
+			&revision.Comment,
+			&revision.CreatedByUUID,
+			&revision.CreatedAt,
+		)
+		if scanErr != nil {
+			return nil, errors.Wrapf(scanErr, "failed to scan a row of revisions for post %s", postUUID)
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to iterate revisions for post %s", postUUID)
+	}
+	return revisions, nil
+}
+
+// UpdatePost edits a post in the database, keeping its prior version as a revision
+func (dr *dataRepository) UpdatePost(ctx context.Context, post *DBPost) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := requireAuthor(ctx, tx, post.UUID, post.UpdatedByUUID.String, ErrPostNotFound); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrapf(err, "failed to update post %s", post.UUID)
+	}
+	if err := expectVersion(ctx, tx, lockPostVersionQuery, post.UUID, post.Version, ErrPostNotFound); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrapf(err, "failed to lock post %s", post.UUID)
+	}
+	if err := dr.createPostRevision(ctx, tx, post.UUID); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrap(err, "failed to create in the post revisions table")
+	}
+	if err := dr.updatePost(ctx, tx, post); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrap(err, "failed to update in the posts table")
+	}
+	if err := dr.replacePostTags(ctx, tx, post); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrap(err, "failed to update in the post tags table")
+	}
+	if err := dr.replacePostMentions(ctx, tx, post); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrap(err, "failed to update in the post mentions table")
+	}
+	if err := tx.Commit(); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to update post %s", post.UUID)
+		}
+		return errors.Wrapf(err, "failed to update post %s", post.UUID)
+	}
+	return nil
+}
+
+const lockPostForRevisionQuery = `
+SELECT
+	p.title,
+	p.comment,
+	COALESCE(p.updated_by_uuid, p.created_by_uuid),
+	COALESCE(p.updated_at, p.created_at),
+	(SELECT COALESCE(MAX(r.revision), 0) + 1 FROM post_revisions r WHERE r.post_uuid=p.uuid)
+FROM
+	posts p
+WHERE
+	p.uuid=?
+AND
+	p.deleted_at IS NULL
+FOR UPDATE
+`
+
+const createPostRevisionStatement = `
+INSERT INTO
+	post_revisions (
+		uuid,
+		post_uuid,
+		revision,
+		title,
+		comment,
+		created_by_uuid,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?)
+`
+
+func (dr *dataRepository) createPostRevision(ctx context.Context, tx *sql.Tx, postUUID string) error {
+	revisionUUID, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "failed to generate uuid for post revision")
+	}
+	revision := DBPostRevision{
+		UUID:     revisionUUID.String(),
+		PostUUID: postUUID,
+	}
+	scanErr := tx.QueryRowContext(ctx, lockPostForRevisionQuery, postUUID).Scan(
+		&revision.Title,
+		&revision.Comment,
+		&revision.CreatedByUUID,
+		&revision.CreatedAt,
+		&revision.Revision,
+	)
+	if scanErr == sql.ErrNoRows {
+		return aboutResource(ErrPostNotFound, "post", postUUID)
+	}
+	if scanErr != nil {
+		return errors.Wrapf(scanErr, "failed to scan current version of post %s", postUUID)
+	}
+	_, err = tx.ExecContext(ctx, createPostRevisionStatement,
+		revision.UUID,
+		revision.PostUUID,
+		revision.Revision,
+		revision.Title,
+		revision.Comment,
+		revision.CreatedByUUID,
+		revision.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to create revision %+v", revision)
+	}
+	return nil
+}
+
+const updatePostStatement = `
+UPDATE
+	posts
+SET
+	title=?,
+	comment=?,
+	updated_by_uuid=?,
+	updated_at=?,
+	version=version+1
+WHERE
+	uuid=?
+`
+
+func (dr *dataRepository) updatePost(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	_, err := tx.ExecContext(ctx, updatePostStatement,
+		post.Title,
+		post.Comment,
+		post.UpdatedByUUID.String,
+		post.UpdatedAt.Int64,
+		post.UUID,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statment to update post %s", post.UUID)
+	}
+	return nil
+}
+
+const lockParentPostQuery = `
+SELECT
+	p.link_uuid,
+	COALESCE(p.root_post_uuid, p.uuid)
+FROM
+	posts p
+WHERE
+	p.uuid=?
+AND
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+FOR UPDATE
+`
+
+const countReplyStatement = `
+UPDATE
+	posts
+SET
+	reply_count=reply_count+?,
+	engagement_count=engagement_count+?
+WHERE
+	uuid=?
+`
+
+// attachReply points a reply at the root of its parent's thread and counts it on its parent,
+// replies can only be made to posts that are not deleted
+func (dr *dataRepository) attachReply(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	var linkUUID string
+	var rootUUID string
+	err := tx.QueryRowContext(ctx, lockParentPostQuery, post.ParentPostUUID.String).Scan(&linkUUID, &rootUUID)
+	if err == sql.ErrNoRows {
+		return aboutResource(ErrParentPostNotFound, "post", post.ParentPostUUID.String)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to lock parent post")
+	}
+	if post.LinkUUID == "" {
+		post.LinkUUID = linkUUID
+	}
+	post.RootPostUUID = sql.NullString{Valid: true, String: rootUUID}
+	if _, err := tx.ExecContext(ctx, countReplyStatement, 1, 1, post.ParentPostUUID.String); err != nil {
+		return errors.Wrap(err, "failed to execute statement to count reply")
+	}
+	return nil
+}
+
+const lockRepostedPostQuery = `
+SELECT
+	p.link_uuid,
+	p.deleted_at,
+	p.repost_of_uuid,
+	p.title,
+	p.comment,
+	p.visibility,
+	p.draft
+FROM
+	posts p
+WHERE
+	p.uuid=?
+FOR UPDATE
+`
+
+const countUsersRepostsQuery = `
+SELECT
+	COUNT(*)
+FROM
+	posts p
+WHERE
+	p.repost_of_uuid=?
+AND
+	p.user_uuid=?
+AND
+	p.title=''
+AND
+	p.comment=''
+AND
+	p.deleted_at IS NULL
+`
+
+const getRepostOfQuery = `
+SELECT
+	p.repost_of_uuid
+FROM
+	posts p
+WHERE
+	p.uuid=?
+`
+
+const countRepostStatement = `
+UPDATE
+	posts
+SET
+	repost_count=repost_count+?,
+	engagement_count=engagement_count+?
+WHERE
+	uuid=?
+`
+
+// attachRepost points a repost at the post it reposts and takes that post's link, a plain repost of a
+// plain repost reposts the original post; only public posts can be reposted, deleted posts cannot be
+// reposted and a user can only plainly repost a post once
+func (dr *dataRepository) attachRepost(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	var linkUUID string
+	var deletedAt sql.NullInt64
+	var repostOfUUID sql.NullString
+	var title, comment, visibility string
+	var draft bool
+	err := tx.QueryRowContext(ctx, lockRepostedPostQuery, post.RepostOfUUID.String).Scan(&linkUUID, &deletedAt, &repostOfUUID, &title, &comment, &visibility, &draft)
+	if err == sql.ErrNoRows || draft {
+		return aboutResource(ErrRepostedPostNotFound, "post", post.RepostOfUUID.String)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to lock reposted post")
+	}
+	if repostOfUUID.Valid && title == "" && comment == "" && post.IsPlainRepost() {
+		post.RepostOfUUID = repostOfUUID
+		return dr.attachRepost(ctx, tx, post)
+	}
+	if deletedAt.Valid {
+		return aboutResource(ErrRepostedPostDeleted, "post", post.RepostOfUUID.String)
+	}
+	if visibility != VisibilityPublic {
+		return aboutResource(ErrRepostedPostNotPublic, "post", post.RepostOfUUID.String)
+	}
+	if post.IsPlainRepost() {
+		var reposts int
+		if err := tx.QueryRowContext(ctx, countUsersRepostsQuery, post.RepostOfUUID.String, post.UserUUID).Scan(&reposts); err != nil {
+			return errors.Wrap(err, "failed to count users reposts")
+		}
+		if reposts > 0 {
+			return aboutResource(ErrAlreadyReposted, "post", post.RepostOfUUID.String)
+		}
+	}
+	post.LinkUUID = linkUUID
+	return nil
+}
+
+const getRestoredRepostQuery = `
+SELECT
+	p.user_uuid,
+	p.repost_of_uuid,
+	p.title,
+	p.comment
+FROM
+	posts p
+WHERE
+	p.uuid=?
+`
+
+// requireOnlyRepost checks a restored plain repost is the only plain repost of the post by its user, it locks the
+// reposted post as reposting it does so a restore and a repost cannot both pass the check
+func (dr *dataRepository) requireOnlyRepost(ctx context.Context, tx *sql.Tx, postUUID string) error {
+	post := DBPost{}
+	if err := tx.QueryRowContext(ctx, getRestoredRepostQuery, postUUID).Scan(&post.UserUUID, &post.RepostOfUUID, &post.Title, &post.Comment); err != nil {
+		return errors.Wrapf(err, "failed to scan restored post %s", postUUID)
+	}
+	if !post.IsPlainRepost() {
+		return nil
+	}
+	var authorUUID string
+	err := tx.QueryRowContext(ctx, lockPostAuthorQuery, post.RepostOfUUID.String).Scan(&authorUUID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "failed to lock reposted post")
+	}
+	var reposts int
+	if err := tx.QueryRowContext(ctx, countUsersRepostsQuery, post.RepostOfUUID.String, post.UserUUID).Scan(&reposts); err != nil {
+		return errors.Wrap(err, "failed to count users reposts")
+	}
+	// the restored repost counts itself
+	if reposts > 1 {
+		return aboutResource(ErrAlreadyReposted, "post", post.RepostOfUUID.String)
+	}
+	return nil
+}
+
+// countRepost adds delta to the repost count of the post a post reposts, it does nothing for posts that are not reposts
+func (dr *dataRepository) countRepost(ctx context.Context, tx *sql.Tx, postUUID string, delta int) error {
+	var repostOfUUID sql.NullString
+	if err := tx.QueryRowContext(ctx, getRepostOfQuery, postUUID).Scan(&repostOfUUID); err != nil {
+		return errors.Wrapf(err, "failed to scan what post %s reposts", postUUID)
+	}
+	if !repostOfUUID.Valid {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, countRepostStatement, delta, delta, repostOfUUID.String); err != nil {
+		return errors.Wrapf(err, "failed to execute statement to count repost %s", postUUID)
+	}
+	return nil
+}
+
+const getParentPostQuery = `
+SELECT
+	p.parent_post_uuid
+FROM
+	posts p
+WHERE
+	p.uuid=?
+`
+
+// countReply adds delta to the reply count of the post a post replies to, it does nothing for posts that are not replies
+func (dr *dataRepository) countReply(ctx context.Context, tx *sql.Tx, postUUID string, delta int) error {
+	var parentUUID sql.NullString
+	if err := tx.QueryRowContext(ctx, getParentPostQuery, postUUID).Scan(&parentUUID); err != nil {
+		return errors.Wrapf(err, "failed to scan what post %s replies to", postUUID)
+	}
+	if !parentUUID.Valid {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, countReplyStatement, delta, delta, parentUUID.String); err != nil {
+		return errors.Wrapf(err, "failed to execute statement to count reply %s", postUUID)
+	}
+	return nil
+}
+
+// threadQuery selects the uuids of the replies under posts down to a depth
+const threadQuery = `
+WITH RECURSIVE thread (uuid, depth) AS (
+	SELECT r.uuid, 1 FROM posts r WHERE r.parent_post_uuid IN (%s)
+	UNION ALL
+	SELECT r.uuid, t.depth+1 FROM posts r INNER JOIN thread t ON r.parent_post_uuid=t.uuid WHERE t.depth<?
+)
+SELECT uuid FROM thread
+`
+
+// GetReplies gets the direct replies to a post the viewer can see, oldest first, deleted replies are included as tombstones
+func (dr *dataRepository) GetReplies(ctx context.Context, postUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, *keyset.PageInfo, error) {
+	page.Ascending = true
+	posts, info, err := dr.pagePosts(ctx, page, getAnyPostQuery, viewer, "p.parent_post_uuid=?", postUUID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list replies to post %s", postUUID)
+	}
+	return posts, info, nil
+}
+
+// GetDescendants gets the replies under posts the viewer can see down to a depth, deleted replies are included as tombstones
+func (dr *dataRepository) GetDescendants(ctx context.Context, postUUIDs []string, maxDepth int, viewer *Viewer) ([]*DBPost, error) {
+	if len(postUUIDs) == 0 || maxDepth < 1 {
+		return nil, nil
+	}
+	visible, params := visibleWhere("p", viewer, true)
+	query := fmt.Sprintf("%s %s AND p.uuid IN (%s)", getAnyPostQuery, visible, fmt.Sprintf(threadQuery, placeholders(len(postUUIDs))))
+	params = append(params, stringArgs(postUUIDs)...)
+	posts, err := dr.listPosts(ctx, query, append(params, maxDepth)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list descendants of posts %v", postUUIDs)
+	}
+	return posts, nil
+}
+
+// GetThread gets every reply under a post the viewer can see down to a depth, oldest first,
+// deleted replies are included as tombstones
+func (dr *dataRepository) GetThread(ctx context.Context, postUUID string, maxDepth int, viewer *Viewer, page *keyset.Page) ([]*DBPost, *keyset.PageInfo, error) {
+	page.Ascending = true
+	where := fmt.Sprintf("p.uuid IN (%s)", fmt.Sprintf(threadQuery, "?"))
+	posts, info, err := dr.pagePosts(ctx, page, getAnyPostQuery, viewer, where, postUUID, maxDepth)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list thread of post %s", postUUID)
+	}
+	return posts, info, nil
+}
+
+// pagePosts lists a page of the posts matching a condition that the viewer can see, newest first unless the page is ascending
+func (dr *dataRepository) pagePosts(ctx context.Context, page *keyset.Page, baseQuery string, viewer *Viewer, where string, params ...interface{}) ([]*DBPost, *keyset.PageInfo, error) {
+	visible, visibleParams := visibleWhere("p", viewer, true)
+	query, pageParams := page.Apply(fmt.Sprintf("%s %s AND %s", baseQuery, visible, where), "p.created_at", "p.uuid")
+	params = append(visibleParams, params...)
+	posts, err := dr.listPosts(ctx, query, append(params, pageParams...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]keyset.Key, len(posts))
+	for i, post := range posts {
+		keys[i] = PostOrderNewest.key(post)
+	}
+	n, info, err := page.Finish(keys, func(i, j int) {
+		posts[i], posts[j] = posts[j], posts[i]
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of posts")
+	}
+	return posts[:n], info, nil
+}
+
+// listPosts runs a query built on getPostQuery or getAnyPostQuery
+func (dr *dataRepository) listPosts(ctx context.Context, query string, params ...interface{}) ([]*DBPost, error) {
+	rows, err := dr.db().QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query posts")
+	}
+	defer rows.Close()
+	var posts []*DBPost
+	for rows.Next() {
+		post, scanErr := scanPost(rows)
+		if scanErr != nil {
+			return nil, errors.Wrap(scanErr, "failed to scan a row of posts")
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate posts")
+	}
+	return posts, nil
+}
+
+const lockPostQuery = `
+SELECT
+	p.uuid
+FROM
+	posts p
+WHERE
+	p.uuid=?
+AND
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+FOR UPDATE
+`
+
+const createReactionStatement = `
+INSERT IGNORE INTO
+	post_reactions (
+		uuid,
+		post_uuid,
+		user_uuid,
+		kind,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?, ?)
+`
+
+const countReactionStatement = `
+INSERT INTO
+	post_reaction_counts (
+		post_uuid,
+		kind,
+		count
+	)
+VALUES
+	(?, ?, ?)
+ON DUPLICATE KEY UPDATE
+	count=count+VALUES(count)
+`
+
+const countEngagementStatement = `
+UPDATE
+	posts
+SET
+	engagement_count=engagement_count+?
+WHERE
+	uuid=?
+`
+
+// AddReaction adds a user's reaction to a post and counts it, adding a reaction the user already made is a no-op
+func (dr *dataRepository) AddReaction(ctx context.Context, reaction *DBReaction) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := dr.addReaction(ctx, tx, reaction); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to add reaction to post %s", reaction.PostUUID)
+		}
+		return errors.Wrapf(err, "failed to add reaction to post %s", reaction.PostUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to add reaction to post %s", reaction.PostUUID)
+		}
+		return errors.Wrapf(err, "failed to add reaction to post %s", reaction.PostUUID)
+	}
+	return nil
+}
+
+func (dr *dataRepository) addReaction(ctx context.Context, tx *sql.Tx, reaction *DBReaction) error {
+	var postUUID string
+	err := tx.QueryRowContext(ctx, lockPostQuery, reaction.PostUUID).Scan(&postUUID)
+	if err == sql.ErrNoRows {
+		return aboutResource(ErrPostNotFound, "post", reaction.PostUUID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to lock post")
+	}
+	res, err := tx.ExecContext(ctx, createReactionStatement,
+		reaction.UUID,
+		reaction.PostUUID,
+		reaction.UserUUID,
+		reaction.Kind,
+		reaction.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute statement to create reaction")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+	if affected == 0 {
+		return nil
+	}
+	return dr.countReaction(ctx, tx, reaction.PostUUID, reaction.Kind, 1)
+}
+
+const deleteReactionStatement = `
+DELETE FROM
+	post_reactions
+WHERE
+	post_uuid=?
+AND
+	user_uuid=?
+AND
+	kind=?
+`
+
+// RemoveReaction removes a user's reaction from a post and uncounts it, removing a reaction the user did not make is a no-op
+func (dr *dataRepository) RemoveReaction(ctx context.Context, postUUID string, userUUID string, kind string) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := dr.removeReaction(ctx, tx, postUUID, userUUID, kind); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to remove reaction from post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to remove reaction from post %s", postUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to remove reaction from post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to remove reaction from post %s", postUUID)
+	}
+	return nil
+}
+
+func (dr *dataRepository) removeReaction(ctx context.Context, tx *sql.Tx, postUUID string, userUUID string, kind string) error {
+	res, err := tx.ExecContext(ctx, deleteReactionStatement, postUUID, userUUID, kind)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute statement to delete reaction")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+	if affected == 0 {
+		return nil
+	}
+	return dr.countReaction(ctx, tx, postUUID, kind, -1)
+}
+
+// countReaction moves the count of a kind of reaction on a post and the post's engagement by delta
+func (dr *dataRepository) countReaction(ctx context.Context, tx *sql.Tx, postUUID string, kind string, delta int) error {
+	if _, err := tx.ExecContext(ctx, countReactionStatement, postUUID, kind, delta); err != nil {
+		return errors.Wrap(err, "failed to execute statement to count reaction")
+	}
+	if _, err := tx.ExecContext(ctx, countEngagementStatement, delta, postUUID); err != nil {
+		return errors.Wrap(err, "failed to execute statement to count engagement")
+	}
+	return nil
+}
+
+const listReactionsQuery = `
+SELECT
+	pr.uuid,
+	pr.post_uuid,
+	pr.user_uuid,
+	pr.kind,
+	pr.created_at
+FROM
+	post_reactions pr
+WHERE
+	pr.post_uuid=?
+`
+
+// ListReactions gets the reactions to a post, newest first, only of a kind when the kind is set
+func (dr *dataRepository) ListReactions(ctx context.Context, postUUID string, kind string, page *keyset.Page) ([]*DBReaction, *keyset.PageInfo, error) {
+	query := listReactionsQuery
+	params := []interface{}{postUUID}
+	if kind != "" {
+		query += " AND pr.kind=?"
+		params = append(params, kind)
+	}
+	query, pageParams := page.Apply(query, "pr.created_at", "pr.uuid")
+	rows, err := dr.db().QueryContext(ctx, query, append(params, pageParams...)...)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to query reactions to post %s", postUUID)
+	}
+	defer rows.Close()
+	var reactions []*DBReaction
+	var keys []keyset.Key
+	for rows.Next() {
+		reaction := DBReaction{}
+		scanErr := rows.Scan(
+			&reaction.UUID,
+			&reaction.PostUUID,
+			&reaction.UserUUID,
+			&reaction.Kind,
+			&reaction.CreatedAt,
+		)
+		if scanErr != nil {
+			return nil, nil, errors.Wrapf(scanErr, "failed to scan a row of reactions to post %s", postUUID)
+		}
+		reactions = append(reactions, &reaction)
+		keys = append(keys, keyset.Key{Value: reaction.CreatedAt, UUID: reaction.UUID})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to iterate reactions to post %s", postUUID)
+	}
+	n, info, err := page.Finish(keys, func(i, j int) {
+		reactions[i], reactions[j] = reactions[j], reactions[i]
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of reactions")
+	}
+	return reactions[:n], info, nil
+}
+
+// splitReactionCounts splits the reaction counts aggregated as kind:count
+func splitReactionCounts(agg sql.NullString) ([]*DBReactionCount, error) {
+	var counts []*DBReactionCount
+	for _, part := range splitGroupConcat(agg) {
+		fields := strings.Split(part, ":")
+		if len(fields) != 2 {
+			return nil, errors.Errorf("malformed reaction count %s", part)
+		}
+		count, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed reaction count %s", part)
+		}
+		counts = append(counts, &DBReactionCount{Kind: fields[0], Count: count})
+	}
+	return counts, nil
+}
+
+const getPostQueryForBookmark = `
+SELECT
+	p.uuid
+FROM
+	posts p
+WHERE
+	p.uuid=?
+AND
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+`
+
+const createBookmarkStatement = `
+INSERT IGNORE INTO
+	bookmarks (
+		uuid,
+		user_uuid,
+		post_uuid,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?)
+`
+
+// CreateBookmark bookmarks a post for a user, bookmarking a post the user already bookmarked is a no-op; the post is
+// not locked since a bookmark of a post deleted right after it is checked is no different from one of a post
+// deleted later, whose bookmark stays and lists it as a tombstone
+func (dr *dataRepository) CreateBookmark(ctx context.Context, bookmark *DBBookmark) error {
+	var postUUID string
+	err := dr.db().QueryRowContext(ctx, getPostQueryForBookmark, bookmark.PostUUID).Scan(&postUUID)
+	if err == sql.ErrNoRows {
+		return aboutResource(ErrPostNotFound, "post", bookmark.PostUUID)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get post %s to bookmark", bookmark.PostUUID)
+	}
+	_, err = dr.db().ExecContext(ctx, createBookmarkStatement,
+		bookmark.UUID,
+		bookmark.UserUUID,
+		bookmark.PostUUID,
+		bookmark.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute statement to bookmark post %s", bookmark.PostUUID)
+	}
+	return nil
+}
+
+const deleteBookmarkStatement = `
+DELETE FROM
+	bookmarks
+WHERE
+	user_uuid=?
+AND
+	post_uuid=?
+`
+
+// DeleteBookmark removes a user's bookmark of a post, removing a bookmark that does not exist is a no-op
+func (dr *dataRepository) DeleteBookmark(ctx context.Context, userUUID string, postUUID string) error {
+	if _, err := dr.db().ExecContext(ctx, deleteBookmarkStatement, userUUID, postUUID); err != nil {
+		return errors.Wrapf(err, "failed to execute statement to delete bookmark of post %s", postUUID)
+	}
+	return nil
+}
+
+const listBookmarksQuery = `
+SELECT
+	b.uuid,
+	b.user_uuid,
+	b.post_uuid,
+	b.created_at
+FROM
+	bookmarks b
+WHERE
+	b.user_uuid=?
+AND
+	b.post_uuid IN (SELECT p.uuid FROM posts p WHERE %s)
+`
+
+// ListBookmarks gets a user's bookmarks of posts the viewer can see, newest first, along with the bookmarked
+// posts and their links in the same order, bookmarked posts that have been deleted are included as tombstones
+func (dr *dataRepository) ListBookmarks(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBBookmark, []*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	visible, visibleParams := visibleWhere("p", viewer, false)
+	query, pageParams := page.Apply(fmt.Sprintf(listBookmarksQuery, visible), "b.created_at", "b.uuid")
+	params := append([]interface{}{userUUID}, visibleParams...)
+	rows, err := dr.db().QueryContext(ctx, query, append(params, pageParams...)...)
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrapf(err, "failed to query bookmarks of user %s", userUUID)
+	}
+	defer rows.Close()
+	var bookmarks []*DBBookmark
+	var keys []keyset.Key
+	for rows.Next() {
+		bookmark := DBBookmark{}
+		scanErr := rows.Scan(
+			&bookmark.UUID,
+			&bookmark.UserUUID,
+			&bookmark.PostUUID,
+			&bookmark.CreatedAt,
+		)
+		if scanErr != nil {
+			return nil, nil, nil, nil, errors.Wrapf(scanErr, "failed to scan a row of bookmarks of user %s", userUUID)
+		}
+		bookmarks = append(bookmarks, &bookmark)
+		keys = append(keys, keyset.Key{Value: bookmark.CreatedAt, UUID: bookmark.UUID})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, nil, errors.Wrapf(err, "failed to iterate bookmarks of user %s", userUUID)
+	}
+	n, info, err := page.Finish(keys, func(i, j int) {
+		bookmarks[i], bookmarks[j] = bookmarks[j], bookmarks[i]
+	})
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrap(err, "failed to finish page of bookmarks")
+	}
+	bookmarks = bookmarks[:n]
+	if len(bookmarks) == 0 {
+		return nil, nil, nil, info, nil
+	}
+
+	postUUIDs := make([]string, len(bookmarks))
+	for i, b := range bookmarks {
+		postUUIDs[i] = b.PostUUID
+	}
+	postsQuery := fmt.Sprintf("%s p.uuid IN (%s)", getAnyPostsWithLinksQuery, placeholders(len(postUUIDs)))
+	posts, links, err := dr.listPostsWithLinks(ctx, postsQuery, stringArgs(postUUIDs)...)
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrapf(err, "failed to list bookmarked posts of user %s", userUUID)
+	}
+	postsByUUID := map[string]int{}
+	for i, p := range posts {
+		postsByUUID[p.UUID] = i
+	}
+	orderedPosts := make([]*DBPost, len(bookmarks))
+	orderedLinks := make([]*DBLink, len(bookmarks))
+	for i, b := range bookmarks {
+		j, ok := postsByUUID[b.PostUUID]
+		if !ok {
+			return nil, nil, nil, nil, errors.Errorf("bookmarked post %s does not exist", b.PostUUID)
+		}
+		orderedPosts[i] = posts[j]
+		orderedLinks[i] = links[j]
+	}
+	return bookmarks, orderedPosts, orderedLinks, info, nil
+}
+
+const deletePostTagsStatement = `
+DELETE FROM
+	post_tags
+WHERE
+	post_uuid=?
+`
+
+const createPostTagStatement = `
+INSERT INTO
+	post_tags (
+		post_uuid,
+		tag
+	)
+VALUES
+	(?, ?)
+`
+
+// replacePostTags replaces the tags of a post with the post's current tags
+func (dr *dataRepository) replacePostTags(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	if _, err := tx.ExecContext(ctx, deletePostTagsStatement, post.UUID); err != nil {
+		return errors.Wrapf(err, "failed to execute statement to delete tags of post %s", post.UUID)
+	}
+	for _, tag := range post.Tags {
+		if _, err := tx.ExecContext(ctx, createPostTagStatement, post.UUID, tag); err != nil {
+			return errors.Wrapf(err, "failed to execute statement to create tag %s of post %s", tag, post.UUID)
+		}
+	}
+	return nil
+}
+
+const deletePostMentionsStatement = `
+DELETE FROM
+	post_mentions
+WHERE
+	post_uuid=?
+`
+
+const createPostMentionStatement = `
+INSERT INTO
+	post_mentions (
+		post_uuid,
+		user_uuid,
+		start_offset,
+		end_offset
+	)
+VALUES
+	(?, ?, ?, ?)
+`
+
+// replacePostMentions replaces the mentions of a post with the post's current mentions
+func (dr *dataRepository) replacePostMentions(ctx context.Context, tx *sql.Tx, post *DBPost) error {
+	if _, err := tx.ExecContext(ctx, deletePostMentionsStatement, post.UUID); err != nil {
+		return errors.Wrapf(err, "failed to execute statement to delete mentions of post %s", post.UUID)
+	}
+	for _, m := range post.Mentions {
+		if _, err := tx.ExecContext(ctx, createPostMentionStatement, post.UUID, m.UserUUID, m.Start, m.End); err != nil {
+			return errors.Wrapf(err, "failed to execute statement to create mention of %s in post %s", m.UserUUID, post.UUID)
+		}
+	}
+	return nil
+}
+
+// splitPostMentions splits the mentions aggregated by postMentionsSubquery
+func splitPostMentions(agg sql.NullString) ([]*DBPostMention, error) {
+	var mentions []*DBPostMention
+	for _, part := range splitGroupConcat(agg) {
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return nil, errors.Errorf("malformed post mention %s", part)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed post mention start %s", part)
+		}
+		end, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed post mention end %s", part)
+		}
+		mentions = append(mentions, &DBPostMention{UserUUID: fields[0], Start: start, End: end})
+	}
+	return mentions, nil
+}
+
+// GetMentioningPosts gets the posts mentioning a user
+func (dr *dataRepository) GetMentioningPosts(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	where := "p.uuid IN (SELECT pm.post_uuid FROM post_mentions pm WHERE pm.user_uuid=?)"
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, PostOrderNewest, viewer, where, userUUID)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts mentioning user %s", userUUID)
+	}
+	return posts, links, info, nil
+}
+
+// GetTagsPosts gets the posts tagged with a normalized tag that the viewer can see
+func (dr *dataRepository) GetTagsPosts(ctx context.Context, tag string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	where := "p.uuid IN (SELECT pt.post_uuid FROM post_tags pt WHERE pt.tag=?)"
+	posts, links, info, err := dr.pagePostsWithLinks(ctx, page, PostOrderNewest, viewer, where, tag)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for tag %s", tag)
+	}
+	return posts, links, info, nil
+}
+
+const listTrendingTagsQuery = `
+SELECT
+	pt.tag,
+	COUNT(*) AS post_count
+FROM
+	post_tags pt
+INNER JOIN
+	posts p
+ON
+	pt.post_uuid=p.uuid
+WHERE
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+AND
+	p.visibility='public'
+AND
+	p.created_at>=?
+GROUP BY
+	pt.tag
+ORDER BY
+	post_count DESC,
+	pt.tag ASC
+LIMIT ?
+`
+
+// ListTrendingTags gets the tags on the most public posts created since a unix time
+func (dr *dataRepository) ListTrendingTags(ctx context.Context, since int64, limit int) ([]*DBTagCount, error) {
+	rows, err := dr.db().QueryContext(ctx, listTrendingTagsQuery, since, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query trending tags")
+	}
+	defer rows.Close()
+	var tags []*DBTagCount
+	for rows.Next() {
+		tag := DBTagCount{}
+		if err := rows.Scan(&tag.Tag, &tag.PostCount); err != nil {
+			return nil, errors.Wrap(err, "failed to scan a row of trending tags")
+		}
+		tags = append(tags, &tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate trending tags")
+	}
+	return tags, nil
+}
+
+const publishDraftStatement = `
+UPDATE
+	posts
+SET
+	draft=0,
+	created_at=?,
+	updated_by_uuid=?,
+	updated_at=?,
+	version=version+1
+WHERE
+	uuid=?
+AND
+	deleted_at IS NULL
+AND
+	draft=1
+`
+
+// PublishDraft publishes a draft post, a published draft is listed as of when it was published
+func (dr *dataRepository) PublishDraft(ctx context.Context, postUUID string, publishedByUUID string, expectedVersion int64) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if err := requireAuthor(ctx, tx, postUUID, publishedByUUID, ErrPostNotFound); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to publish post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to publish post %s", postUUID)
+	}
+	if err := expectVersion(ctx, tx, lockPostVersionQuery, postUUID, expectedVersion, ErrPostNotFound); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to publish post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to lock post %s", postUUID)
+	}
+	now := time.Now().Unix()
+	res, err := tx.ExecContext(ctx, publishDraftStatement, now, publishedByUUID, now, postUUID)
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to publish post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to execute statment to publish post %s", postUUID)
+	}
+	if err := requireRowsAffected(res, aboutResource(ErrPostNotDraft, "post", postUUID)); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to publish post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to publish post %s", postUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit publish of post %s", postUUID)
+	}
+	return nil
+}
+
+const deletePostStatement = `
+UPDATE
+	posts
+SET
+	deleted_by_uuid=?,
+	deleted_at=?,
+	deleted_by_moderator=?,
+	updated_by_uuid=?,
+	updated_at=?,
+	version=version+1
+WHERE
+	uuid=?
+AND
+	deleted_at IS NULL
+`
+
+// DeletePost soft deletes a post in the database, a post deleted by a moderator other than its author is removed
+// by moderation and only a moderator can restore it
+func (dr *dataRepository) DeletePost(ctx context.Context, postUUID string, deletedByUUID string, moderator bool, expectedVersion int64) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	moderated, err := requireModerates(ctx, tx, postUUID, deletedByUUID, moderator, ErrPostNotFound)
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to delete post %s", postUUID)
+	}
+	if err := expectVersion(ctx, tx, lockPostVersionQuery, postUUID, expectedVersion, ErrPostNotFound); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to lock post %s", postUUID)
+	}
+	now := time.Now().Unix()
+	res, err := tx.ExecContext(ctx, deletePostStatement, deletedByUUID, now, moderated, deletedByUUID, now, postUUID)
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to execute statment to delete post %s", postUUID)
+	}
+	if err := requireRowsAffected(res, aboutResource(ErrPostNotFound, "post", postUUID)); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to delete post %s", postUUID)
+	}
+	if err := dr.countRepost(ctx, tx, postUUID, -1); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to uncount deleted post %s", postUUID)
+	}
+	if err := dr.countReply(ctx, tx, postUUID, -1); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to delete post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to uncount deleted reply %s", postUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit delete of post %s", postUUID)
+	}
+	return nil
+}
+
+const restorePostStatement = `
+UPDATE
+	posts
+SET
+	deleted_by_uuid=NULL,
+	deleted_at=NULL,
+	deleted_by_moderator=0,
+	updated_by_uuid=?,
+	updated_at=?,
+	version=version+1
+WHERE
+	uuid=?
+AND
+	deleted_at IS NOT NULL
+AND
+	deleted_at>=?
+`
+
+// RestorePost restores a post that was deleted at or after deletedSince, a post removed by a moderator
+// can only be restored by a moderator
+func (dr *dataRepository) RestorePost(ctx context.Context, postUUID string, restoredByUUID string, moderator bool, deletedSince int64) error {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	if _, err := requireModerates(ctx, tx, postUUID, restoredByUUID, moderator, ErrPostNotRestorable); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to restore post %s", postUUID)
+	}
+	res, err := tx.ExecContext(ctx, restorePostStatement, restoredByUUID, time.Now().Unix(), postUUID, deletedSince)
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to execute statment to restore post %s", postUUID)
+	}
+	if err := requireRowsAffected(res, aboutResource(ErrPostNotRestorable, "post", postUUID)); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to restore post %s", postUUID)
+	}
+	if err := dr.requireOnlyRepost(ctx, tx, postUUID); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to restore post %s", postUUID)
+	}
+	if err := dr.countRepost(ctx, tx, postUUID, 1); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to recount restored post %s", postUUID)
+	}
+	if err := dr.countReply(ctx, tx, postUUID, 1); err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return errors.Wrapf(rollErr, "failed to rollback after failing to restore post %s", postUUID)
+		}
+		return errors.Wrapf(err, "failed to recount restored reply %s", postUUID)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit restore of post %s", postUUID)
+	}
+	return nil
+}
+
+const lockPostVersionQuery = `
+SELECT
+	p.version
+FROM
+	posts p
+WHERE
+	p.uuid=?
+AND
+	p.deleted_at IS NULL
+FOR UPDATE
+`
+
+// expectVersion locks a row for the rest of the transaction and checks it is at the expected version,
+// an expected version of 0 only checks the row exists
+func expectVersion(ctx context.Context, tx *sql.Tx, lockQuery string, uuid string, expectedVersion int64, notFoundErr error) error {
+	var version int64
+	scanErr := tx.QueryRowContext(ctx, lockQuery, uuid).Scan(&version)
+	if scanErr == sql.ErrNoRows {
+		return aboutResource(notFoundErr, "post", uuid)
+	}
+	if scanErr != nil {
+		return errors.Wrapf(scanErr, "failed to scan version of %s", uuid)
+	}
+	if expectedVersion != 0 && version != expectedVersion {
+		return errors.Wrapf(aboutResource(ErrVersionConflict, "post", uuid), "expected version %d of %s but found %d", expectedVersion, uuid, version)
+	}
+	return nil
+}
+
+const lockPostAuthorQuery = `
+SELECT
+	p.user_uuid
+FROM
+	posts p
+WHERE
+	p.uuid=?
+FOR UPDATE
+`
+
+// requireAuthor locks a post, deleted or not, for the rest of the transaction and checks the user is its author
+func requireAuthor(ctx context.Context, tx *sql.Tx, postUUID string, userUUID string, notFoundErr error) error {
+	var authorUUID string
+	scanErr := tx.QueryRowContext(ctx, lockPostAuthorQuery, postUUID).Scan(&authorUUID)
+	if scanErr == sql.ErrNoRows {
+		return aboutResource(notFoundErr, "post", postUUID)
+	}
+	if scanErr != nil {
+		return errors.Wrapf(scanErr, "failed to scan author of post %s", postUUID)
+	}
+	if authorUUID != userUUID {
+		return errors.Wrapf(aboutResource(ErrNotPostAuthor, "post", postUUID), "user %s is not the author %s", userUUID, authorUUID)
+	}
+	return nil
+}
+
+const lockPostModerationQuery = `
+SELECT
+	p.user_uuid,
+	p.deleted_by_moderator
+FROM
+	posts p
+WHERE
+	p.uuid=?
+FOR UPDATE
+`
+
+// requireModerates locks a post, deleted or not, for the rest of the transaction and checks the user can delete
+// or restore it: its author can unless a moderator removed it and a moderator always can; it returns whether the
+// user acts on the post as a moderator rather than as its author
+func requireModerates(ctx context.Context, tx *sql.Tx, postUUID string, userUUID string, moderator bool, notFoundErr error) (bool, error) {
+	var authorUUID string
+	var deletedByModerator bool
+	scanErr := tx.QueryRowContext(ctx, lockPostModerationQuery, postUUID).Scan(&authorUUID, &deletedByModerator)
+	if scanErr == sql.ErrNoRows {
+		return false, aboutResource(notFoundErr, "post", postUUID)
+	}
+	if scanErr != nil {
+		return false, errors.Wrapf(scanErr, "failed to scan author of post %s", postUUID)
+	}
+	return moderates(postUUID, authorUUID, deletedByModerator, userUUID, moderator)
+}
+
+// moderates checks a user can delete or restore a post and returns whether they act on it as a moderator
+func moderates(postUUID string, authorUUID string, deletedByModerator bool, userUUID string, moderator bool) (bool, error) {
+	if moderator {
+		return userUUID != authorUUID, nil
+	}
+	if userUUID != authorUUID {
+		return false, errors.Wrapf(aboutResource(ErrNotPostAuthor, "post", postUUID), "user %s is not the author %s or a moderator", userUUID, authorUUID)
+	}
+	if deletedByModerator {
+		return false, aboutResource(ErrPostRemovedByModerator, "post", postUUID)
+	}
+	return false, nil
+}
+
+// requireRowsAffected returns notAffectedErr when a statement did not change any rows
+func requireRowsAffected(res sql.Result, notAffectedErr error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to read affected rows")
+	}
+	if affected == 0 {
+		return notAffectedErr
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+)
+
+// LinkCanonicalizer is a data repository holding links stored before their urls were canonicalized
+type LinkCanonicalizer interface {
+	// CanonicalizeLinks canonicalizes the url of every link, merging links whose canonical urls are the same
+	CanonicalizeLinks(ctx context.Context) (canonicalized int, merged int, err error)
+}
+
+// canonicalizeBatchSize is how many links are read at a time while canonicalizing links
+const canonicalizeBatchSize = 500
+
+const listLinksToCanonicalizeQuery = `
+SELECT
+	l.uuid,
+	l.url,
+	l.canonical_url,
+	l.resolved_url,
+	l.created_at
+FROM
+	links l
+WHERE
+	(l.created_at>? OR (l.created_at=? AND l.uuid>?))
+ORDER BY
+	l.created_at ASC,
+	l.uuid ASC
+LIMIT ?
+`
+
+// CanonicalizeLinks canonicalizes the url of every link, oldest first; a link whose canonical url another link
+// already has is merged into that link, its posts and source heads move over and its metadata and checks are dropped,
+// links whose urls cannot be canonicalized are logged and left as they are
+func (dr *dataRepository) CanonicalizeLinks(ctx context.Context) (int, int, error) {
+	var canonicalized, merged int
+	afterCreatedAt, afterUUID := int64(-1), ""
+	for {
+		links, err := dr.listLinksToCanonicalize(ctx, afterCreatedAt, afterUUID)
+		if err != nil {
+			return canonicalized, merged, err
+		}
+		for _, link := range links {
+			canonicalURL, err := canonical.URL(link.URL)
+			if err != nil {
+				log.Printf("Failed to canonicalize url of link %s: %+v\n", link.UUID, err)
+				continue
+			}
+			if canonicalURL == link.CanonicalURL {
+				continue
+			}
+			wasMerged, err := dr.canonicalizeLink(ctx, link, canonicalURL)
+			if err != nil {
+				return canonicalized, merged, errors.Wrapf(err, "failed to canonicalize link %s", link.UUID)
+			}
+			if wasMerged {
+				merged++
+			} else {
+				canonicalized++
+			}
+		}
+		if len(links) < canonicalizeBatchSize {
+			return canonicalized, merged, nil
+		}
+		last := links[len(links)-1]
+		afterCreatedAt, afterUUID = last.CreatedAt, last.UUID
+	}
+}
+
+func (dr *dataRepository) listLinksToCanonicalize(ctx context.Context, afterCreatedAt int64, afterUUID string) ([]*DBLink, error) {
+	rows, err := dr.db().QueryContext(ctx, listLinksToCanonicalizeQuery, afterCreatedAt, afterCreatedAt, afterUUID, canonicalizeBatchSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query links to canonicalize")
+	}
+	defer rows.Close()
+	var links []*DBLink
+	for rows.Next() {
+		link := DBLink{}
+		if err := rows.Scan(&link.UUID, &link.URL, &link.CanonicalURL, &link.ResolvedURL, &link.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan a row of links to canonicalize")
+		}
+		links = append(links, &link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate links to canonicalize")
+	}
+	return links, nil
+}
+
+const canonicalizeLinkStatement = `
+UPDATE
+	links
+SET
+	canonical_url=?,
+	canonical_url_hash=?,
+	resolved_url=?,
+	resolved_url_hash=?
+WHERE
+	uuid=?
+`
+
+// canonicalizeLink sets the canonical url of a link, or merges it into the link that already has the canonical url
+func (dr *dataRepository) canonicalizeLink(ctx context.Context, link *DBLink, canonicalURL string) (bool, error) {
+	tx, err := dr.db().BeginTx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to begin transaction")
+	}
+	existingUUID, err := dr.lockLinkByURLs(ctx, tx, canonicalURL, canonicalURL)
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return false, errors.Wrapf(rollErr, "failed to rollback after failing to canonicalize link %s", link.UUID)
+		}
+		return false, errors.Wrap(err, "failed to look up existing link")
+	}
+	merge := existingUUID != "" && existingUUID != link.UUID
+	if merge {
+		err = dr.mergeLink(ctx, tx, link.UUID, existingUUID)
+	} else {
+		// a link that was never resolved to somewhere else resolves to its own canonical url
+		resolvedURL := link.ResolvedURL
+		if resolvedURL == link.CanonicalURL {
+			resolvedURL = canonicalURL
+		}
+		_, err = tx.ExecContext(ctx, canonicalizeLinkStatement, canonicalURL, hashURL(canonicalURL), resolvedURL, hashURL(resolvedURL), link.UUID)
+	}
+	if err != nil {
+		if rollErr := tx.Rollback(); rollErr != nil {
+			return false, errors.Wrapf(rollErr, "failed to rollback after failing to canonicalize link %s", link.UUID)
+		}
+		return false, errors.Wrapf(err, "failed to execute statement to canonicalize link %s", link.UUID)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrapf(err, "failed to commit canonicalizing link %s", link.UUID)
+	}
+	return merge, nil
+}
+
+// mergeLinkStatements move what references a duplicate link over to the link it is merged into, then delete it;
+// each statement takes the uuid of the duplicate link and those with two placeholders the kept link's uuid first
+var mergeLinkStatements = []struct {
+	statement string
+	keptUUID  bool
+}{
+	{"INSERT IGNORE INTO link_source_heads (link_uuid, source_uuid) SELECT ?, h.source_uuid FROM link_source_heads h WHERE h.link_uuid=?", true},
+	{"DELETE FROM link_source_heads WHERE link_uuid=?", false},
+	{"UPDATE posts SET link_uuid=? WHERE link_uuid=?", true},
+	{"DELETE FROM link_metadata WHERE link_uuid=?", false},
+	{"DELETE FROM link_checks WHERE link_uuid=?", false},
+	{"DELETE FROM links WHERE uuid=?", false},
+}
+
+// mergeLink merges a duplicate link into the link kept in its place
+func (dr *dataRepository) mergeLink(ctx context.Context, tx *sql.Tx, duplicateUUID string, keptUUID string) error {
+	for _, m := range mergeLinkStatements {
+		args := []interface{}{duplicateUUID}
+		if m.keptUUID {
+			args = []interface{}{keptUUID, duplicateUUID}
+		}
+		if _, err := tx.ExecContext(ctx, m.statement, args...); err != nil {
+			return errors.Wrapf(err, "failed to merge link %s into %s", duplicateUUID, keptUUID)
+		}
+	}
+	return nil
+}
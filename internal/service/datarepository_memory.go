@@ -0,0 +1,1124 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+	"github.com/srcabl/posts/internal/keyset"
+	"github.com/srcabl/posts/internal/linkcheck"
+)
+
+// memoryLink is a link stored in memory along with the health it is checked against
+type memoryLink struct {
+	link                DBLink
+	consecutiveFailures int
+}
+
+// memoryDataRepository is a data repository held in memory, it has the same semantics as the mysql data repository
+type memoryDataRepository struct {
+	mu             sync.RWMutex
+	posts          map[string]*DBPost
+	links          map[string]*memoryLink
+	linkChecks     []*DBLinkCheck
+	revisions      map[string][]*DBPostRevision
+	reactions      map[memoryReactionKey]*DBReaction
+	reactionCounts map[string]map[string]int64
+	bookmarks      map[memoryBookmarkKey]*DBBookmark
+}
+
+// memoryReactionKey is what makes a reaction unique, a user can react to a post once with each kind
+type memoryReactionKey struct {
+	postUUID string
+	userUUID string
+	kind     string
+}
+
+// memoryBookmarkKey is what makes a bookmark unique, a user can bookmark a post once
+type memoryBookmarkKey struct {
+	userUUID string
+	postUUID string
+}
+
+// NewMemoryDataRepository news up a data repository held in memory, e.g. for tests and local development
+func NewMemoryDataRepository() DataRepository {
+	return &memoryDataRepository{
+		posts:          map[string]*DBPost{},
+		links:          map[string]*memoryLink{},
+		revisions:      map[string][]*DBPostRevision{},
+		reactions:      map[memoryReactionKey]*DBReaction{},
+		reactionCounts: map[string]map[string]int64{},
+		bookmarks:      map[memoryBookmarkKey]*DBBookmark{},
+	}
+}
+
+// GetPost gets a post by uuid if the viewer can see it
+func (mr *memoryDataRepository) GetPost(ctx context.Context, uuid string, viewer *Viewer) (*DBPost, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	post, ok := mr.posts[uuid]
+	if !ok || post.DeletedAt.Valid || !viewer.sees(post, false) {
+		return nil, errors.Wrapf(aboutResource(sql.ErrNoRows, "post", uuid), "failed to get post %s", uuid)
+	}
+	return mr.copyPost(post), nil
+}
+
+// GetPostsByUUIDs gets posts by their uuids, the posts are in the order of the uuids
+// and a post that does not exist or the viewer cannot see is nil
+func (mr *memoryDataRepository) GetPostsByUUIDs(ctx context.Context, uuids []string, viewer *Viewer) ([]*DBPost, error) {
+	return mr.getPostsByUUIDs(uuids, viewer, false), nil
+}
+
+// GetAnyPostsByUUIDs gets posts by their uuids like GetPostsByUUIDs, deleted posts are included as tombstones
+func (mr *memoryDataRepository) GetAnyPostsByUUIDs(ctx context.Context, uuids []string, viewer *Viewer) ([]*DBPost, error) {
+	return mr.getPostsByUUIDs(uuids, viewer, true), nil
+}
+
+func (mr *memoryDataRepository) getPostsByUUIDs(uuids []string, viewer *Viewer, withDeleted bool) []*DBPost {
+	if len(uuids) == 0 {
+		return nil
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	posts := make([]*DBPost, len(uuids))
+	for i, id := range uuids {
+		post, ok := mr.posts[id]
+		if !ok || (post.DeletedAt.Valid && !withDeleted) || !viewer.sees(post, false) {
+			continue
+		}
+		posts[i] = mr.copyPost(post)
+	}
+	return posts
+}
+
+// GetLinkByUUID gets a link by the uuid
+func (mr *memoryDataRepository) GetLinkByUUID(ctx context.Context, uuid string) (*DBLink, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	ml, ok := mr.links[uuid]
+	if !ok {
+		return nil, errors.Wrapf(aboutResource(sql.ErrNoRows, "link", uuid), "failed to get link with uuid %s", uuid)
+	}
+	return copyLink(&ml.link), nil
+}
+
+// GetLinksByUUIDs gets links by their uuids, the links are in the order of the uuids and a link that does not exist is nil
+func (mr *memoryDataRepository) GetLinksByUUIDs(ctx context.Context, uuids []string) ([]*DBLink, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	links := make([]*DBLink, len(uuids))
+	for i, id := range uuids {
+		if ml, ok := mr.links[id]; ok {
+			links[i] = copyLink(&ml.link)
+		}
+	}
+	return links, nil
+}
+
+// GetLinkByURL gets a link by the canonical form of the url, matching either the url the link was
+// submitted with or the url it resolved to, links submitted with the url are preferred
+func (mr *memoryDataRepository) GetLinkByURL(ctx context.Context, url string) (*DBLink, error) {
+	canonicalURL, err := canonical.URL(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to canonicalize url %s", url)
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	ml := mr.linkByURLs(canonicalURL, canonicalURL)
+	if ml == nil {
+		return nil, errors.Wrapf(aboutResource(sql.ErrNoRows, "link", url), "failed to get link with url %s", url)
+	}
+	return copyLink(&ml.link), nil
+}
+
+// linkByURLs finds the link that was submitted with or resolved to either url, preferring a link submitted with
+// the canonical url and then the oldest, it returns nil when there is no such link
+func (mr *memoryDataRepository) linkByURLs(canonicalURL string, resolvedURL string) *memoryLink {
+	var found *memoryLink
+	foundSubmitted := false
+	for _, ml := range mr.links {
+		l := &ml.link
+		if l.CanonicalURL != canonicalURL && l.CanonicalURL != resolvedURL && l.ResolvedURL != canonicalURL && l.ResolvedURL != resolvedURL {
+			continue
+		}
+		submitted := l.CanonicalURL == canonicalURL
+		if found == nil ||
+			(submitted && !foundSubmitted) ||
+			(submitted == foundSubmitted && (l.CreatedAt < found.link.CreatedAt || (l.CreatedAt == found.link.CreatedAt && l.UUID < found.link.UUID))) {
+			found = ml
+			foundSubmitted = submitted
+		}
+	}
+	return found
+}
+
+// GetUsersPosts gets the posts from a user the viewer can see
+func (mr *memoryDataRepository) GetUsersPosts(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := mr.pagePostsWithLinks(page, PostOrderNewest, viewer, func(p *DBPost) bool {
+		return p.UserUUID == userUUID
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for user %s", userUUID)
+	}
+	return posts, links, info, nil
+}
+
+// GetLinksPosts gets the posts about a link the viewer can see in the given order
+func (mr *memoryDataRepository) GetLinksPosts(ctx context.Context, linkUUID string, order PostOrder, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := mr.pagePostsWithLinks(page, order, viewer, func(p *DBPost) bool {
+		return p.LinkUUID == linkUUID
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for link %s", linkUUID)
+	}
+	return posts, links, info, nil
+}
+
+// GetSourcesPosts gets the posts the viewer can see about links a source is a source head of
+func (mr *memoryDataRepository) GetSourcesPosts(ctx context.Context, sourceUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := mr.pagePostsWithLinks(page, PostOrderNewest, viewer, func(p *DBPost) bool {
+		return mr.linkHasSourceHead(p.LinkUUID, sourceUUID)
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for source %s", sourceUUID)
+	}
+	return posts, links, info, nil
+}
+
+// GetFeedPosts gets the posts the viewer can see by the followed users or about links from the followed sources,
+// only the newest of the feed's posts about each link is included
+func (mr *memoryDataRepository) GetFeedPosts(ctx context.Context, userUUIDs []string, sourceUUIDs []string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	if len(userUUIDs) == 0 && len(sourceUUIDs) == 0 {
+		return nil, nil, &keyset.PageInfo{}, nil
+	}
+	users := stringSet(userUUIDs)
+	inFeed := func(p *DBPost) bool {
+		if users[p.UserUUID] {
+			return true
+		}
+		for _, s := range sourceUUIDs {
+			if mr.linkHasSourceHead(p.LinkUUID, s) {
+				return true
+			}
+		}
+		return false
+	}
+	posts, links, info, err := mr.pagePostsWithLinks(page, PostOrderNewest, viewer, func(p *DBPost) bool {
+		if !inFeed(p) {
+			return false
+		}
+		for _, np := range mr.posts {
+			if np.LinkUUID != p.LinkUUID || np.DeletedAt.Valid || !inFeed(np) || !viewer.sees(np, true) {
+				continue
+			}
+			if np.CreatedAt > p.CreatedAt || (np.CreatedAt == p.CreatedAt && np.UUID > p.UUID) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to list feed posts")
+	}
+	return posts, links, info, nil
+}
+
+// GetTagsPosts gets the posts tagged with a normalized tag that the viewer can see
+func (mr *memoryDataRepository) GetTagsPosts(ctx context.Context, tag string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := mr.pagePostsWithLinks(page, PostOrderNewest, viewer, func(p *DBPost) bool {
+		for _, t := range p.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts for tag %s", tag)
+	}
+	return posts, links, info, nil
+}
+
+// GetMentioningPosts gets the posts the viewer can see that mention a user
+func (mr *memoryDataRepository) GetMentioningPosts(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	posts, links, info, err := mr.pagePostsWithLinks(page, PostOrderNewest, viewer, func(p *DBPost) bool {
+		for _, m := range p.Mentions {
+			if m.UserUUID == userUUID {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to list posts mentioning user %s", userUUID)
+	}
+	return posts, links, info, nil
+}
+
+// pagePostsWithLinks lists a page of the posts that are not deleted, match and the viewer can see along with their links
+func (mr *memoryDataRepository) pagePostsWithLinks(page *keyset.Page, order PostOrder, viewer *Viewer, match func(*DBPost) bool) ([]*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var matched []*DBPost
+	var keys []keyset.Key
+	for _, p := range mr.posts {
+		if p.DeletedAt.Valid || !viewer.sees(p, true) || !match(p) {
+			continue
+		}
+		if _, ok := mr.links[p.LinkUUID]; !ok {
+			continue
+		}
+		matched = append(matched, p)
+		keys = append(keys, order.key(p))
+	}
+	picked, info, err := memoryPage(page, keys)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to finish page of posts")
+	}
+	posts := make([]*DBPost, len(picked))
+	links := make([]*DBLink, len(picked))
+	for i, j := range picked {
+		posts[i] = mr.copyPost(matched[j])
+		links[i] = copyLink(&mr.links[matched[j].LinkUUID].link)
+	}
+	return posts, links, info, nil
+}
+
+// GetReplies gets the direct replies to a post the viewer can see, oldest first, deleted replies are included as tombstones
+func (mr *memoryDataRepository) GetReplies(ctx context.Context, postUUID string, viewer *Viewer, page *keyset.Page) ([]*DBPost, *keyset.PageInfo, error) {
+	page.Ascending = true
+	posts, info, err := mr.pagePosts(page, viewer, func(p *DBPost) bool {
+		return p.ParentPostUUID.Valid && p.ParentPostUUID.String == postUUID
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list replies to post %s", postUUID)
+	}
+	return posts, info, nil
+}
+
+// GetDescendants gets the replies under posts the viewer can see down to a depth, deleted replies are included as tombstones
+func (mr *memoryDataRepository) GetDescendants(ctx context.Context, postUUIDs []string, maxDepth int, viewer *Viewer) ([]*DBPost, error) {
+	if len(postUUIDs) == 0 || maxDepth < 1 {
+		return nil, nil
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	thread := mr.thread(postUUIDs, maxDepth)
+	var posts []*DBPost
+	for _, p := range mr.posts {
+		if thread[p.UUID] && viewer.sees(p, true) {
+			posts = append(posts, mr.copyPost(p))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].CreatedAt != posts[j].CreatedAt {
+			return posts[i].CreatedAt < posts[j].CreatedAt
+		}
+		return posts[i].UUID < posts[j].UUID
+	})
+	return posts, nil
+}
+
+// GetThread gets every reply under a post the viewer can see down to a depth, oldest first,
+// deleted replies are included as tombstones
+func (mr *memoryDataRepository) GetThread(ctx context.Context, postUUID string, maxDepth int, viewer *Viewer, page *keyset.Page) ([]*DBPost, *keyset.PageInfo, error) {
+	page.Ascending = true
+	mr.mu.RLock()
+	thread := mr.thread([]string{postUUID}, maxDepth)
+	mr.mu.RUnlock()
+	posts, info, err := mr.pagePosts(page, viewer, func(p *DBPost) bool {
+		return thread[p.UUID]
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list thread of post %s", postUUID)
+	}
+	return posts, info, nil
+}
+
+// thread finds the uuids of the replies under posts down to a depth, whether or not they are deleted
+func (mr *memoryDataRepository) thread(postUUIDs []string, maxDepth int) map[string]bool {
+	children := map[string][]string{}
+	for _, p := range mr.posts {
+		if p.ParentPostUUID.Valid {
+			children[p.ParentPostUUID.String] = append(children[p.ParentPostUUID.String], p.UUID)
+		}
+	}
+	thread := map[string]bool{}
+	level := postUUIDs
+	for depth := 1; depth <= maxDepth && len(level) > 0; depth++ {
+		var next []string
+		for _, id := range level {
+			for _, child := range children[id] {
+				thread[child] = true
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+	return thread
+}
+
+// pagePosts lists a page of the posts that match and the viewer can see, deleted posts included,
+// newest first unless the page is ascending
+func (mr *memoryDataRepository) pagePosts(page *keyset.Page, viewer *Viewer, match func(*DBPost) bool) ([]*DBPost, *keyset.PageInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var matched []*DBPost
+	var keys []keyset.Key
+	for _, p := range mr.posts {
+		if !viewer.sees(p, true) || !match(p) {
+			continue
+		}
+		matched = append(matched, p)
+		keys = append(keys, PostOrderNewest.key(p))
+	}
+	picked, info, err := memoryPage(page, keys)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of posts")
+	}
+	posts := make([]*DBPost, len(picked))
+	for i, j := range picked {
+		posts[i] = mr.copyPost(matched[j])
+	}
+	return posts, info, nil
+}
+
+// ListPostRevisions gets the prior versions of a post, newest first
+func (mr *memoryDataRepository) ListPostRevisions(ctx context.Context, postUUID string) ([]*DBPostRevision, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	stored := mr.revisions[postUUID]
+	var revisions []*DBPostRevision
+	for i := len(stored) - 1; i >= 0; i-- {
+		r := *stored[i]
+		revisions = append(revisions, &r)
+	}
+	return revisions, nil
+}
+
+// ListLinksToCheck gets the links that have not been checked since checkedBefore, least recently checked first
+func (mr *memoryDataRepository) ListLinksToCheck(ctx context.Context, checkedBefore int64, limit int) ([]*DBLink, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var due []*DBLink
+	for _, ml := range mr.links {
+		if !ml.link.StatusCheckedAt.Valid || ml.link.StatusCheckedAt.Int64 < checkedBefore {
+			due = append(due, &DBLink{UUID: ml.link.UUID, URL: ml.link.URL, StatusCheckedAt: ml.link.StatusCheckedAt})
+		}
+	}
+	// links never checked come first like nulls do in mysql
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].StatusCheckedAt.Valid != due[j].StatusCheckedAt.Valid {
+			return !due[i].StatusCheckedAt.Valid
+		}
+		if due[i].StatusCheckedAt.Int64 != due[j].StatusCheckedAt.Int64 {
+			return due[i].StatusCheckedAt.Int64 < due[j].StatusCheckedAt.Int64
+		}
+		return due[i].UUID < due[j].UUID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, l := range due {
+		l.StatusCheckedAt = sql.NullInt64{}
+	}
+	return due, nil
+}
+
+// ListDeadLinks gets the links the health checker found to be dead
+func (mr *memoryDataRepository) ListDeadLinks(ctx context.Context, page *keyset.Page) ([]*DBLink, *keyset.PageInfo, error) {
+	links, info, err := mr.pageLinks(page, linkOrderChecked, func(l *DBLink) bool {
+		return l.Status == linkcheck.StatusDead
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list dead links")
+	}
+	return links, info, nil
+}
+
+// GetSourcesLinks gets the links a source is a source head of
+func (mr *memoryDataRepository) GetSourcesLinks(ctx context.Context, sourceUUID string, page *keyset.Page) ([]*DBLink, *keyset.PageInfo, error) {
+	links, info, err := mr.pageLinks(page, linkOrderNewest, func(l *DBLink) bool {
+		return mr.linkHasSourceHead(l.UUID, sourceUUID)
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list links for source %s", sourceUUID)
+	}
+	return links, info, nil
+}
+
+// pageLinks lists a page of the links that match
+func (mr *memoryDataRepository) pageLinks(page *keyset.Page, order linkOrder, match func(*DBLink) bool) ([]*DBLink, *keyset.PageInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var matched []*DBLink
+	var keys []keyset.Key
+	for _, ml := range mr.links {
+		if !match(&ml.link) {
+			continue
+		}
+		matched = append(matched, &ml.link)
+		keys = append(keys, order.key(&ml.link))
+	}
+	picked, info, err := memoryPage(page, keys)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of links")
+	}
+	links := make([]*DBLink, len(picked))
+	for i, j := range picked {
+		links[i] = copyLink(matched[j])
+	}
+	return links, info, nil
+}
+
+// linkHasSourceHead is whether a source is one of a link's source heads
+func (mr *memoryDataRepository) linkHasSourceHead(linkUUID string, sourceUUID string) bool {
+	ml, ok := mr.links[linkUUID]
+	if !ok {
+		return false
+	}
+	for _, s := range ml.link.SourceHeadUUIDs {
+		if s == sourceUUID {
+			return true
+		}
+	}
+	return false
+}
+
+// ListTrendingTags gets the tags on the most public posts created since a unix time
+func (mr *memoryDataRepository) ListTrendingTags(ctx context.Context, since int64, limit int) ([]*DBTagCount, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	counts := map[string]int64{}
+	for _, p := range mr.posts {
+		if p.DeletedAt.Valid || p.Draft || p.Visibility != VisibilityPublic || p.CreatedAt < since {
+			continue
+		}
+		for _, t := range p.Tags {
+			counts[t]++
+		}
+	}
+	var tags []*DBTagCount
+	for t, c := range counts {
+		tags = append(tags, &DBTagCount{Tag: t, PostCount: c})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].PostCount != tags[j].PostCount {
+			return tags[i].PostCount > tags[j].PostCount
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+// ListReactions gets the reactions to a post, newest first, only of a kind when the kind is set
+func (mr *memoryDataRepository) ListReactions(ctx context.Context, postUUID string, kind string, page *keyset.Page) ([]*DBReaction, *keyset.PageInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var matched []*DBReaction
+	var keys []keyset.Key
+	for _, r := range mr.reactions {
+		if r.PostUUID != postUUID || (kind != "" && r.Kind != kind) {
+			continue
+		}
+		matched = append(matched, r)
+		keys = append(keys, keyset.Key{Value: r.CreatedAt, UUID: r.UUID})
+	}
+	picked, info, err := memoryPage(page, keys)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to finish page of reactions")
+	}
+	reactions := make([]*DBReaction, len(picked))
+	for i, j := range picked {
+		r := *matched[j]
+		reactions[i] = &r
+	}
+	return reactions, info, nil
+}
+
+// ListBookmarks gets a user's bookmarks of posts the viewer can see, newest first, along with the bookmarked
+// posts and their links in the same order, bookmarked posts that have been deleted are included as tombstones
+func (mr *memoryDataRepository) ListBookmarks(ctx context.Context, userUUID string, viewer *Viewer, page *keyset.Page) ([]*DBBookmark, []*DBPost, []*DBLink, *keyset.PageInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var matched []*DBBookmark
+	var keys []keyset.Key
+	for _, b := range mr.bookmarks {
+		if b.UserUUID != userUUID {
+			continue
+		}
+		if p, ok := mr.posts[b.PostUUID]; !ok || !viewer.sees(p, false) {
+			continue
+		}
+		matched = append(matched, b)
+		keys = append(keys, keyset.Key{Value: b.CreatedAt, UUID: b.UUID})
+	}
+	picked, info, err := memoryPage(page, keys)
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrap(err, "failed to finish page of bookmarks")
+	}
+	if len(picked) == 0 {
+		return nil, nil, nil, info, nil
+	}
+	bookmarks := make([]*DBBookmark, len(picked))
+	posts := make([]*DBPost, len(picked))
+	links := make([]*DBLink, len(picked))
+	for i, j := range picked {
+		b := *matched[j]
+		bookmarks[i] = &b
+		posts[i] = mr.copyPost(mr.posts[b.PostUUID])
+		ml, ok := mr.links[posts[i].LinkUUID]
+		if !ok {
+			return nil, nil, nil, nil, errors.Errorf("link %s of bookmarked post %s does not exist", posts[i].LinkUUID, b.PostUUID)
+		}
+		links[i] = copyLink(&ml.link)
+	}
+	return bookmarks, posts, links, info, nil
+}
+
+// CreateLink adds a link, if a link with the same canonical or resolved url exists
+// its source heads are merged with the new link's and link.UUID is set to the existing link
+func (mr *memoryDataRepository) CreateLink(ctx context.Context, link *DBLink) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.createLink(link)
+}
+
+// createLink adds or merges a link, the caller holds the write lock
+func (mr *memoryDataRepository) createLink(link *DBLink) error {
+	if existing := mr.linkByURLs(link.CanonicalURL, link.ResolvedURL); existing != nil {
+		merged := false
+		for _, s := range link.SourceHeadUUIDs {
+			if !containsString(existing.link.SourceHeadUUIDs, s) {
+				existing.link.SourceHeadUUIDs = append(existing.link.SourceHeadUUIDs, s)
+				merged = true
+			}
+		}
+		if merged {
+			existing.link.UpdatedByUUID = sql.NullString{Valid: true, String: link.UpdatedByUUID.String}
+			existing.link.UpdatedAt = sql.NullInt64{Valid: true, Int64: link.UpdatedAt.Int64}
+			existing.link.Version++
+		}
+		link.UUID = existing.link.UUID
+		return nil
+	}
+	if _, ok := mr.links[link.UUID]; ok {
+		return errors.Errorf("failed to create link %s: duplicate uuid", link.UUID)
+	}
+	stored := copyLink(link)
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: link.UpdatedByUUID.String}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: link.UpdatedAt.Int64}
+	stored.Status = linkcheck.StatusUnknown
+	stored.StatusCheckedAt = sql.NullInt64{}
+	stored.Metadata = nil
+	var sourceHeads []string
+	for _, s := range stored.SourceHeadUUIDs {
+		if containsString(sourceHeads, s) {
+			return errors.Errorf("failed to create link %s: duplicate source head %s", link.UUID, s)
+		}
+		sourceHeads = append(sourceHeads, s)
+	}
+	mr.links[link.UUID] = &memoryLink{link: *stored}
+	return nil
+}
+
+// CreatePost adds a post, a reply is about its parent's link when it has none of its own
+// and a repost is about the reposted post's link
+func (mr *memoryDataRepository) CreatePost(ctx context.Context, post *DBPost) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.createPost(post)
+}
+
+// CreatePostWithLink adds a post about a link, the link is created unless a link with the same canonical or
+// resolved url exists, whose source heads are merged with the new link's instead; link.UUID and post.LinkUUID
+// are set to the link the post is about
+func (mr *memoryDataRepository) CreatePostWithLink(ctx context.Context, link *DBLink, post *DBPost) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	// the link is put back as it was when the post cannot be created, as a rolled back transaction would
+	var prior *memoryLink
+	if existing := mr.linkByURLs(link.CanonicalURL, link.ResolvedURL); existing != nil {
+		prior = &memoryLink{link: *copyLink(&existing.link), consecutiveFailures: existing.consecutiveFailures}
+	}
+	if err := mr.createLink(link); err != nil {
+		return err
+	}
+	post.LinkUUID = link.UUID
+	if err := mr.createPost(post); err != nil {
+		if prior != nil {
+			mr.links[prior.link.UUID] = prior
+		} else {
+			delete(mr.links, link.UUID)
+		}
+		return err
+	}
+	return nil
+}
+
+// createPost adds a post, the caller holds the write lock
+func (mr *memoryDataRepository) createPost(post *DBPost) error {
+	if _, ok := mr.posts[post.UUID]; ok {
+		return errors.Errorf("failed to create post %s: duplicate uuid", post.UUID)
+	}
+	var parent *DBPost
+	if post.ParentPostUUID.Valid {
+		parent = mr.posts[post.ParentPostUUID.String]
+		if parent == nil || parent.DeletedAt.Valid || parent.Draft {
+			return errors.Wrapf(aboutResource(ErrParentPostNotFound, "post", post.ParentPostUUID.String), "failed to attach reply to post %s", post.ParentPostUUID.String)
+		}
+		if post.LinkUUID == "" {
+			post.LinkUUID = parent.LinkUUID
+		}
+		root := parent.UUID
+		if parent.RootPostUUID.Valid {
+			root = parent.RootPostUUID.String
+		}
+		post.RootPostUUID = sql.NullString{Valid: true, String: root}
+	}
+	var reposted *DBPost
+	if post.RepostOfUUID.Valid {
+		var err error
+		if reposted, err = mr.repostedPost(post); err != nil {
+			return errors.Wrapf(err, "failed to attach repost to post %s", post.RepostOfUUID.String)
+		}
+		post.LinkUUID = reposted.LinkUUID
+	}
+	if _, ok := mr.links[post.LinkUUID]; !ok {
+		return errors.Errorf("failed to create post %s: link %s does not exist", post.UUID, post.LinkUUID)
+	}
+	stored := mr.copyPost(post)
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: post.UpdatedByUUID.String}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: post.UpdatedAt.Int64}
+	stored.DeletedByUUID = sql.NullString{}
+	stored.DeletedAt = sql.NullInt64{}
+	stored.EngagementCount = 0
+	stored.ReplyCount = 0
+	stored.RepostCount = 0
+	stored.ReactionCounts = nil
+	mr.posts[post.UUID] = stored
+	if parent != nil {
+		parent.ReplyCount++
+		parent.EngagementCount++
+	}
+	if reposted != nil {
+		reposted.RepostCount++
+		reposted.EngagementCount++
+	}
+	return nil
+}
+
+// repostedPost finds the post a repost reposts, following a plain repost of a plain repost to the original post;
+// only public posts can be reposted, deleted posts cannot be reposted and a user can only plainly repost a post once
+func (mr *memoryDataRepository) repostedPost(post *DBPost) (*DBPost, error) {
+	reposted := mr.posts[post.RepostOfUUID.String]
+	if reposted == nil || reposted.Draft {
+		return nil, aboutResource(ErrRepostedPostNotFound, "post", post.RepostOfUUID.String)
+	}
+	if reposted.IsPlainRepost() && post.IsPlainRepost() {
+		post.RepostOfUUID = reposted.RepostOfUUID
+		return mr.repostedPost(post)
+	}
+	if reposted.DeletedAt.Valid {
+		return nil, aboutResource(ErrRepostedPostDeleted, "post", post.RepostOfUUID.String)
+	}
+	if reposted.Visibility != VisibilityPublic {
+		return nil, aboutResource(ErrRepostedPostNotPublic, "post", post.RepostOfUUID.String)
+	}
+	if post.IsPlainRepost() && mr.hasPlainRepost(post) {
+		return nil, aboutResource(ErrAlreadyReposted, "post", post.RepostOfUUID.String)
+	}
+	return reposted, nil
+}
+
+// hasPlainRepost is whether the user of a plain repost already has another plain repost of the same post
+func (mr *memoryDataRepository) hasPlainRepost(post *DBPost) bool {
+	for _, p := range mr.posts {
+		if p != post && p.IsPlainRepost() && p.RepostOfUUID == post.RepostOfUUID && p.UserUUID == post.UserUUID && !p.DeletedAt.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReaction adds a user's reaction to a post and counts it, adding a reaction the user already made is a no-op
+func (mr *memoryDataRepository) AddReaction(ctx context.Context, reaction *DBReaction) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	post, ok := mr.posts[reaction.PostUUID]
+	if !ok || post.DeletedAt.Valid || post.Draft {
+		return errors.Wrapf(aboutResource(ErrPostNotFound, "post", reaction.PostUUID), "failed to add reaction to post %s", reaction.PostUUID)
+	}
+	key := memoryReactionKey{postUUID: reaction.PostUUID, userUUID: reaction.UserUUID, kind: reaction.Kind}
+	if _, ok := mr.reactions[key]; ok {
+		return nil
+	}
+	stored := *reaction
+	mr.reactions[key] = &stored
+	mr.countReaction(post, reaction.Kind, 1)
+	return nil
+}
+
+// RemoveReaction removes a user's reaction from a post and uncounts it, removing a reaction the user did not make is a no-op
+func (mr *memoryDataRepository) RemoveReaction(ctx context.Context, postUUID string, userUUID string, kind string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	key := memoryReactionKey{postUUID: postUUID, userUUID: userUUID, kind: kind}
+	if _, ok := mr.reactions[key]; !ok {
+		return nil
+	}
+	delete(mr.reactions, key)
+	if post, ok := mr.posts[postUUID]; ok {
+		mr.countReaction(post, kind, -1)
+	}
+	return nil
+}
+
+// countReaction moves the count of a kind of reaction on a post and the post's engagement by delta
+func (mr *memoryDataRepository) countReaction(post *DBPost, kind string, delta int64) {
+	counts, ok := mr.reactionCounts[post.UUID]
+	if !ok {
+		counts = map[string]int64{}
+		mr.reactionCounts[post.UUID] = counts
+	}
+	counts[kind] += delta
+	post.EngagementCount += delta
+}
+
+// CreateBookmark bookmarks a post for a user, bookmarking a post the user already bookmarked is a no-op
+func (mr *memoryDataRepository) CreateBookmark(ctx context.Context, bookmark *DBBookmark) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	post, ok := mr.posts[bookmark.PostUUID]
+	if !ok || post.DeletedAt.Valid || post.Draft {
+		return aboutResource(ErrPostNotFound, "post", bookmark.PostUUID)
+	}
+	key := memoryBookmarkKey{userUUID: bookmark.UserUUID, postUUID: bookmark.PostUUID}
+	if _, ok := mr.bookmarks[key]; ok {
+		return nil
+	}
+	stored := *bookmark
+	mr.bookmarks[key] = &stored
+	return nil
+}
+
+// DeleteBookmark removes a user's bookmark of a post, removing a bookmark that does not exist is a no-op
+func (mr *memoryDataRepository) DeleteBookmark(ctx context.Context, userUUID string, postUUID string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	delete(mr.bookmarks, memoryBookmarkKey{userUUID: userUUID, postUUID: postUUID})
+	return nil
+}
+
+// UpdatePost edits a post, keeping its prior version as a revision
+func (mr *memoryDataRepository) UpdatePost(ctx context.Context, post *DBPost) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if err := mr.requireAuthor(post.UUID, post.UpdatedByUUID.String, ErrPostNotFound); err != nil {
+		return errors.Wrapf(err, "failed to update post %s", post.UUID)
+	}
+	stored, err := mr.expectVersion(post.UUID, post.Version)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock post %s", post.UUID)
+	}
+	revisionUUID, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "failed to generate uuid for post revision")
+	}
+	revision := &DBPostRevision{
+		UUID:          revisionUUID.String(),
+		PostUUID:      stored.UUID,
+		Revision:      int64(len(mr.revisions[stored.UUID]) + 1),
+		Title:         stored.Title,
+		Comment:       stored.Comment,
+		CreatedByUUID: stored.CreatedByUUID,
+		CreatedAt:     stored.CreatedAt,
+	}
+	if stored.UpdatedByUUID.Valid {
+		revision.CreatedByUUID = stored.UpdatedByUUID.String
+	}
+	if stored.UpdatedAt.Valid {
+		revision.CreatedAt = stored.UpdatedAt.Int64
+	}
+	mr.revisions[stored.UUID] = append(mr.revisions[stored.UUID], revision)
+	stored.Title = post.Title
+	stored.Comment = post.Comment
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: post.UpdatedByUUID.String}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: post.UpdatedAt.Int64}
+	stored.Version++
+	stored.Tags = sortedTags(post.Tags)
+	stored.Mentions = sortedMentions(post.Mentions)
+	return nil
+}
+
+// PublishDraft publishes a draft post, a published draft is listed as of when it was published
+func (mr *memoryDataRepository) PublishDraft(ctx context.Context, postUUID string, publishedByUUID string, expectedVersion int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if err := mr.requireAuthor(postUUID, publishedByUUID, ErrPostNotFound); err != nil {
+		return errors.Wrapf(err, "failed to publish post %s", postUUID)
+	}
+	stored, err := mr.expectVersion(postUUID, expectedVersion)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock post %s", postUUID)
+	}
+	if !stored.Draft {
+		return errors.Wrapf(aboutResource(ErrPostNotDraft, "post", postUUID), "failed to publish post %s", postUUID)
+	}
+	now := time.Now().Unix()
+	stored.Draft = false
+	stored.CreatedAt = now
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: publishedByUUID}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: now}
+	stored.Version++
+	return nil
+}
+
+// UpsertLinkMetadata stores the metadata unfurled for a link, replacing any previous metadata
+func (mr *memoryDataRepository) UpsertLinkMetadata(ctx context.Context, meta *DBLinkMetadata) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	ml, ok := mr.links[meta.LinkUUID]
+	if !ok {
+		return errors.Errorf("failed to upsert metadata for link %s: link does not exist", meta.LinkUUID)
+	}
+	stored := *meta
+	ml.link.Metadata = &stored
+	return nil
+}
+
+// RecordLinkCheck stores a check of a link in its history and updates the link's status,
+// the link is dead once deadAfter checks in a row have failed
+func (mr *memoryDataRepository) RecordLinkCheck(ctx context.Context, check *DBLinkCheck, deadAfter int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	ml, ok := mr.links[check.LinkUUID]
+	if !ok {
+		return errors.Wrapf(aboutResource(sql.ErrNoRows, "link", check.LinkUUID), "failed to record check of link %s", check.LinkUUID)
+	}
+	if check.OK {
+		ml.consecutiveFailures = 0
+	} else {
+		ml.consecutiveFailures++
+	}
+	check.Status = linkcheck.NextStatus(ml.link.Status, check.OK, check.Redirected, ml.consecutiveFailures, deadAfter)
+	stored := *check
+	mr.linkChecks = append(mr.linkChecks, &stored)
+	ml.link.Status = check.Status
+	ml.link.StatusCheckedAt = sql.NullInt64{Valid: true, Int64: check.CheckedAt}
+	return nil
+}
+
+// DeletePost soft deletes a post, a post deleted by a moderator other than its author is removed by moderation
+// and only a moderator can restore it
+func (mr *memoryDataRepository) DeletePost(ctx context.Context, postUUID string, deletedByUUID string, moderator bool, expectedVersion int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	moderated, err := mr.requireModerates(postUUID, deletedByUUID, moderator, ErrPostNotFound)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete post %s", postUUID)
+	}
+	stored, err := mr.expectVersion(postUUID, expectedVersion)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock post %s", postUUID)
+	}
+	now := time.Now().Unix()
+	stored.DeletedByUUID = sql.NullString{Valid: true, String: deletedByUUID}
+	stored.DeletedAt = sql.NullInt64{Valid: true, Int64: now}
+	stored.DeletedByModerator = moderated
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: deletedByUUID}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: now}
+	stored.Version++
+	mr.countRepost(stored, -1)
+	mr.countReply(stored, -1)
+	return nil
+}
+
+// RestorePost restores a post that was deleted at or after deletedSince, a post removed by a moderator
+// can only be restored by a moderator
+func (mr *memoryDataRepository) RestorePost(ctx context.Context, postUUID string, restoredByUUID string, moderator bool, deletedSince int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, err := mr.requireModerates(postUUID, restoredByUUID, moderator, ErrPostNotRestorable); err != nil {
+		return errors.Wrapf(err, "failed to restore post %s", postUUID)
+	}
+	stored, ok := mr.posts[postUUID]
+	if !ok || !stored.DeletedAt.Valid || stored.DeletedAt.Int64 < deletedSince {
+		return errors.Wrapf(aboutResource(ErrPostNotRestorable, "post", postUUID), "failed to restore post %s", postUUID)
+	}
+	if stored.IsPlainRepost() && mr.hasPlainRepost(stored) {
+		return errors.Wrapf(aboutResource(ErrAlreadyReposted, "post", stored.RepostOfUUID.String), "failed to restore post %s", postUUID)
+	}
+	stored.DeletedByUUID = sql.NullString{}
+	stored.DeletedAt = sql.NullInt64{}
+	stored.DeletedByModerator = false
+	stored.UpdatedByUUID = sql.NullString{Valid: true, String: restoredByUUID}
+	stored.UpdatedAt = sql.NullInt64{Valid: true, Int64: time.Now().Unix()}
+	stored.Version++
+	mr.countRepost(stored, 1)
+	mr.countReply(stored, 1)
+	return nil
+}
+
+// countRepost adds delta to the repost count of the post a post reposts, it does nothing for posts that are not reposts
+func (mr *memoryDataRepository) countRepost(post *DBPost, delta int64) {
+	if !post.RepostOfUUID.Valid {
+		return
+	}
+	if reposted, ok := mr.posts[post.RepostOfUUID.String]; ok {
+		reposted.RepostCount += delta
+		reposted.EngagementCount += delta
+	}
+}
+
+// countReply adds delta to the reply count of the post a post replies to, it does nothing for posts that are not replies
+func (mr *memoryDataRepository) countReply(post *DBPost, delta int64) {
+	if !post.ParentPostUUID.Valid {
+		return
+	}
+	if parent, ok := mr.posts[post.ParentPostUUID.String]; ok {
+		parent.ReplyCount += delta
+		parent.EngagementCount += delta
+	}
+}
+
+// expectVersion gets a post that is not deleted and checks it is at the expected version,
+// an expected version of 0 only checks the post exists
+func (mr *memoryDataRepository) expectVersion(postUUID string, expectedVersion int64) (*DBPost, error) {
+	stored, ok := mr.posts[postUUID]
+	if !ok || stored.DeletedAt.Valid {
+		return nil, aboutResource(ErrPostNotFound, "post", postUUID)
+	}
+	if expectedVersion != 0 && stored.Version != expectedVersion {
+		return nil, errors.Wrapf(aboutResource(ErrVersionConflict, "post", postUUID), "expected version %d of %s but found %d", expectedVersion, postUUID, stored.Version)
+	}
+	return stored, nil
+}
+
+// requireAuthor checks the user is the author of a post, deleted or not
+func (mr *memoryDataRepository) requireAuthor(postUUID string, userUUID string, notFoundErr error) error {
+	stored, ok := mr.posts[postUUID]
+	if !ok {
+		return aboutResource(notFoundErr, "post", postUUID)
+	}
+	if stored.UserUUID != userUUID {
+		return errors.Wrapf(aboutResource(ErrNotPostAuthor, "post", postUUID), "user %s is not the author %s", userUUID, stored.UserUUID)
+	}
+	return nil
+}
+
+// requireModerates checks a user can delete or restore a post and returns whether they act on it as a moderator
+func (mr *memoryDataRepository) requireModerates(postUUID string, userUUID string, moderator bool, notFoundErr error) (bool, error) {
+	stored, ok := mr.posts[postUUID]
+	if !ok {
+		return false, aboutResource(notFoundErr, "post", postUUID)
+	}
+	return moderates(postUUID, stored.UserUUID, stored.DeletedByModerator, userUUID, moderator)
+}
+
+// copyPost copies a stored post so callers cannot change it, the copy has the post's reaction counts
+func (mr *memoryDataRepository) copyPost(post *DBPost) *DBPost {
+	c := *post
+	c.Tags = sortedTags(post.Tags)
+	c.Mentions = sortedMentions(post.Mentions)
+	c.ReactionCounts = nil
+	var kinds []string
+	for kind, count := range mr.reactionCounts[post.UUID] {
+		if count > 0 {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		c.ReactionCounts = append(c.ReactionCounts, &DBReactionCount{Kind: kind, Count: mr.reactionCounts[post.UUID][kind]})
+	}
+	return &c
+}
+
+// copyLink copies a stored link so callers cannot change it
+func copyLink(link *DBLink) *DBLink {
+	c := *link
+	if len(link.SourceHeadUUIDs) > 0 {
+		c.SourceHeadUUIDs = append([]string(nil), link.SourceHeadUUIDs...)
+	} else {
+		c.SourceHeadUUIDs = nil
+	}
+	if link.Metadata != nil {
+		meta := *link.Metadata
+		c.Metadata = &meta
+	}
+	return &c
+}
+
+// sortedTags copies tags in the order they are read back in, which is sorted
+func sortedTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// sortedMentions copies mentions in the order they are read back in, which is by where they start
+func sortedMentions(mentions []*DBPostMention) []*DBPostMention {
+	if len(mentions) == 0 {
+		return nil
+	}
+	sorted := make([]*DBPostMention, len(mentions))
+	for i, m := range mentions {
+		c := *m
+		sorted[i] = &c
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	return sorted
+}
+
+// memoryPage picks the page of rows with keys and works out how to get the pages either side,
+// it returns the indexes of the rows in the page in list order
+func memoryPage(page *keyset.Page, keys []keyset.Key) ([]int, *keyset.PageInfo, error) {
+	picked := page.Select(keys)
+	pickedKeys := make([]keyset.Key, len(picked))
+	for i, j := range picked {
+		pickedKeys[i] = keys[j]
+	}
+	n, info, err := page.Finish(pickedKeys, func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return picked[:n], info, nil
+}
+
+// stringSet makes a set of strings
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// containsString is whether values contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1 +1,1167 @@
 package service_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/keyset"
+	"github.com/srcabl/posts/internal/linkcheck"
+	"github.com/srcabl/posts/internal/service"
+	"github.com/srcabl/posts/internal/sqlite"
+	"github.com/srcabl/services/pkg/db/mysql"
+)
+
+// mysqlDSNEnv is the dsn of a migrated, disposable database to run the conformance suite against mysql
+const mysqlDSNEnv = "POSTS_TEST_MYSQL_DSN"
+
+// mysqlTables are emptied before each test run against mysql
+var mysqlTables = []string{
+	"bookmarks",
+	"post_reaction_counts",
+	"post_reactions",
+	"post_mentions",
+	"post_tags",
+	"post_revisions",
+	"link_checks",
+	"link_metadata",
+	"link_source_heads",
+	"posts",
+	"links",
+}
+
+func TestMemoryDataRepository(t *testing.T) {
+	testDataRepository(t, func(t *testing.T) service.DataRepository {
+		return service.NewMemoryDataRepository()
+	})
+}
+
+func TestMemoryDataRepositoryConcurrency(t *testing.T) {
+	f := &fixture{t: t, repo: service.NewMemoryDataRepository(), ctx: context.Background(), now: 1000}
+	post := f.post(newUUID(t), f.link("https://example.com/concurrent"), nil)
+	const reactors = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, reactors)
+	for i := 0; i < reactors; i++ {
+		wg.Add(1)
+		go func(at int64) {
+			defer wg.Done()
+			id, err := uuid.NewV4()
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- f.repo.AddReaction(f.ctx, &service.DBReaction{UUID: id.String(), PostUUID: post.UUID, UserUUID: id.String(), Kind: "like", CreatedAt: at})
+			if _, err := f.repo.GetPost(f.ctx, post.UUID, nil); err != nil {
+				errs <- err
+			}
+		}(int64(2000 + i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("failed to react concurrently: %+v", err)
+		}
+	}
+	if got := f.get(post.UUID); got.EngagementCount != reactors {
+		t.Errorf("engagement after concurrent reactions = %d, want %d", got.EngagementCount, reactors)
+	}
+}
+
+func TestSQLiteDataRepository(t *testing.T) {
+	testDataRepository(t, newSQLiteRepository)
+}
+
+// newSQLiteRepository is a data repository stored in a migrated, empty SQLite database
+func newSQLiteRepository(t *testing.T) service.DataRepository {
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "posts.db"))
+	if err != nil {
+		t.Fatalf("failed to new up sqlite client: %+v", err)
+	}
+	closeDB, err := db.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect to sqlite: %+v", err)
+	}
+	t.Cleanup(func() { closeDB() })
+	migrateUp(t, db.DB, sqliteMigrations)
+	repo, err := service.NewSQLiteDataRepository(db)
+	if err != nil {
+		t.Fatalf("failed to new up data repository: %+v", err)
+	}
+	return repo
+}
+
+func TestSQLiteCanonicalizeLinks(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	f := &fixture{t: t, repo: repo, ctx: context.Background(), now: 1000}
+	s1, s2 := newUUID(t), newUUID(t)
+	// the fixture stores links with their raw url as their canonical url, as links were before canonicalization
+	legacy := f.link("HTTPS://Example.com/a/?utm_source=feed", s1)
+	post := f.post(newUUID(t), legacy, nil)
+	kept := f.link("https://example.com/a", s2)
+	trailing := f.link("https://example.com/c/")
+
+	canonicalizer := repo.(service.LinkCanonicalizer)
+	canonicalized, merged, err := canonicalizer.CanonicalizeLinks(f.ctx)
+	if err != nil {
+		t.Fatalf("failed to canonicalize links: %+v", err)
+	}
+	if canonicalized != 1 || merged != 1 {
+		t.Errorf("canonicalized %d and merged %d links, want 1 and 1", canonicalized, merged)
+	}
+	if got := f.get(post.UUID); got.LinkUUID != kept.UUID {
+		t.Errorf("post of merged link is about %s, want %s", got.LinkUUID, kept.UUID)
+	}
+	if _, err := repo.GetLinkByUUID(f.ctx, legacy.UUID); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting a merged link = %v, want sql.ErrNoRows", err)
+	}
+	got, err := repo.GetLinkByUUID(f.ctx, kept.UUID)
+	if err != nil {
+		t.Fatalf("failed to get kept link: %+v", err)
+	}
+	heads := append([]string(nil), got.SourceHeadUUIDs...)
+	sort.Strings(heads)
+	want := []string{s1, s2}
+	sort.Strings(want)
+	if !reflect.DeepEqual(heads, want) {
+		t.Errorf("kept link source heads = %v, want %v", heads, want)
+	}
+	got, err = repo.GetLinkByUUID(f.ctx, trailing.UUID)
+	if err != nil {
+		t.Fatalf("failed to get canonicalized link: %+v", err)
+	}
+	if got.CanonicalURL != "https://example.com/c" || got.ResolvedURL != "https://example.com/c" {
+		t.Errorf("canonicalized link = %s resolving to %s, want https://example.com/c", got.CanonicalURL, got.ResolvedURL)
+	}
+
+	if canonicalized, merged, err := canonicalizer.CanonicalizeLinks(f.ctx); err != nil || canonicalized+merged != 0 {
+		t.Errorf("canonicalizing again = %d, %d, %v, want nothing to do", canonicalized, merged, err)
+	}
+}
+
+// sqliteMigrations are the migrations of the sqlite schema
+const sqliteMigrations = "../../migrations/sqlite"
+
+// migrateUp runs the up migrations in dir in order
+func migrateUp(t *testing.T, db *sql.DB, dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read migrations: %+v", err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".up.sql") {
+			continue
+		}
+		migration, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read migration %s: %+v", file.Name(), err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("failed to run migration %s: %+v", file.Name(), err)
+		}
+	}
+}
+
+func TestMySQLDataRepository(t *testing.T) {
+	dsn := os.Getenv(mysqlDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", mysqlDSNEnv)
+	}
+	// the users and sources the posts reference live in other services' databases
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("mysql", dsn+sep+"foreign_key_checks=0")
+	if err != nil {
+		t.Fatalf("failed to open mysql: %+v", err)
+	}
+	defer db.Close()
+	testDataRepository(t, func(t *testing.T) service.DataRepository {
+		for _, table := range mysqlTables {
+			if _, err := db.Exec("DELETE FROM " + table); err != nil {
+				t.Fatalf("failed to empty %s: %+v", table, err)
+			}
+		}
+		repo, err := service.NewDataRepository(&mysql.Client{DB: db})
+		if err != nil {
+			t.Fatalf("failed to new up data repository: %+v", err)
+		}
+		return repo
+	})
+}
+
+// testDataRepository is the conformance suite every DataRepository must pass, newRepo returns an empty repository
+func testDataRepository(t *testing.T, newRepo func(t *testing.T) service.DataRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, f *fixture)
+	}{
+		{"posts", testPosts},
+		{"post not found", testPostNotFound},
+		{"pagination", testPagination},
+		{"link source heads", testLinkSourceHeads},
+		{"link not found", testLinkNotFound},
+		{"post with link", testPostWithLink},
+		{"sources", testSources},
+		{"revisions", testRevisions},
+		{"versions", testVersions},
+		{"delete and restore", testDeleteAndRestore},
+		{"authors", testAuthors},
+		{"moderation", testModeration},
+		{"replies", testReplies},
+		{"reposts", testReposts},
+		{"reactions", testReactions},
+		{"bookmarks", testBookmarks},
+		{"visibility", testVisibility},
+		{"drafts", testDrafts},
+		{"tags and mentions", testTagsAndMentions},
+		{"feed", testFeed},
+		{"link checks", testLinkChecks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, &fixture{t: t, repo: newRepo(t), ctx: context.Background(), now: 1000})
+		})
+	}
+}
+
+// fixture creates rows in a repository under test
+type fixture struct {
+	t    *testing.T
+	repo service.DataRepository
+	ctx  context.Context
+	now  int64
+}
+
+// tick moves the fixture's clock on so rows are created in order
+func (f *fixture) tick() int64 {
+	f.now += 10
+	return f.now
+}
+
+func newUUID(t *testing.T) string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatalf("failed to generate uuid: %+v", err)
+	}
+	return id.String()
+}
+
+func (f *fixture) newLink(url string, sourceHeads ...string) *service.DBLink {
+	now := f.tick()
+	user := newUUID(f.t)
+	return &service.DBLink{
+		UUID:            newUUID(f.t),
+		URL:             url,
+		CanonicalURL:    url,
+		ResolvedURL:     url,
+		SourceHeadUUIDs: sourceHeads,
+		CreatedByUUID:   user,
+		CreatedAt:       now,
+		UpdatedByUUID:   sql.NullString{Valid: true, String: user},
+		UpdatedAt:       sql.NullInt64{Valid: true, Int64: now},
+		Version:         1,
+	}
+}
+
+func (f *fixture) link(url string, sourceHeads ...string) *service.DBLink {
+	f.t.Helper()
+	link := f.newLink(url, sourceHeads...)
+	if err := f.repo.CreateLink(f.ctx, link); err != nil {
+		f.t.Fatalf("failed to create link %s: %+v", url, err)
+	}
+	return link
+}
+
+func (f *fixture) newPost(user string, link *service.DBLink, edit func(*service.DBPost)) *service.DBPost {
+	now := f.tick()
+	post := &service.DBPost{
+		UUID:          newUUID(f.t),
+		UserUUID:      user,
+		Title:         "title",
+		Comment:       "comment",
+		CreatedByUUID: user,
+		CreatedAt:     now,
+		UpdatedByUUID: sql.NullString{Valid: true, String: user},
+		UpdatedAt:     sql.NullInt64{Valid: true, Int64: now},
+		Version:       1,
+		Visibility:    service.VisibilityPublic,
+	}
+	if link != nil {
+		post.LinkUUID = link.UUID
+	}
+	if edit != nil {
+		edit(post)
+	}
+	return post
+}
+
+func (f *fixture) post(user string, link *service.DBLink, edit func(*service.DBPost)) *service.DBPost {
+	f.t.Helper()
+	post := f.newPost(user, link, edit)
+	if err := f.repo.CreatePost(f.ctx, post); err != nil {
+		f.t.Fatalf("failed to create post: %+v", err)
+	}
+	return post
+}
+
+func (f *fixture) get(uuid string) *service.DBPost {
+	f.t.Helper()
+	post, err := f.repo.GetPost(f.ctx, uuid, nil)
+	if err != nil {
+		f.t.Fatalf("failed to get post %s: %+v", uuid, err)
+	}
+	return post
+}
+
+// pageRequest is a keyset.Request for tests
+type pageRequest struct {
+	token string
+	size  int32
+}
+
+func (r pageRequest) GetPageToken() string { return r.token }
+func (r pageRequest) GetPageSize() int32   { return r.size }
+
+func (f *fixture) page(token string, size int32) *keyset.Page {
+	f.t.Helper()
+	page, err := keyset.NewPage(pageRequest{token: token, size: size}, "", 20, 100)
+	if err != nil {
+		f.t.Fatalf("failed to new up page: %+v", err)
+	}
+	return page
+}
+
+func postUUIDs(posts []*service.DBPost) []string {
+	var uuids []string
+	for _, p := range posts {
+		if p == nil {
+			uuids = append(uuids, "")
+			continue
+		}
+		uuids = append(uuids, p.UUID)
+	}
+	return uuids
+}
+
+func wantUUIDs(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func testPosts(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	link := f.link("https://example.com/a")
+	post := f.post(user, link, nil)
+
+	got := f.get(post.UUID)
+	if got.UserUUID != user || got.LinkUUID != link.UUID || got.Title != "title" || got.Comment != "comment" || got.Version != 1 {
+		t.Errorf("got post %+v, want %+v", got, post)
+	}
+	if got.Visibility != service.VisibilityPublic || got.Draft || got.DeletedAt.Valid {
+		t.Errorf("got post %+v, want a public undeleted post", got)
+	}
+	got.Title = "changed"
+	if again := f.get(post.UUID); again.Title != "title" {
+		t.Errorf("changing a got post changed the stored post")
+	}
+
+	missing := newUUID(t)
+	posts, err := f.repo.GetPostsByUUIDs(f.ctx, []string{missing, post.UUID}, nil)
+	if err != nil {
+		t.Fatalf("failed to get posts: %+v", err)
+	}
+	wantUUIDs(t, "posts by uuids", postUUIDs(posts), "", post.UUID)
+
+	links, err := f.repo.GetLinksByUUIDs(f.ctx, []string{link.UUID, newUUID(t)})
+	if err != nil {
+		t.Fatalf("failed to get links: %+v", err)
+	}
+	if len(links) != 2 || links[0] == nil || links[0].UUID != link.UUID || links[1] != nil {
+		t.Errorf("links by uuids = %+v, want [%s nil]", links, link.UUID)
+	}
+
+	if err := f.repo.CreatePost(f.ctx, f.newPost(user, &service.DBLink{UUID: newUUID(t)}, nil)); err == nil {
+		t.Errorf("creating a post about a link that does not exist did not fail")
+	}
+}
+
+func testPostNotFound(t *testing.T, f *fixture) {
+	_, err := f.repo.GetPost(f.ctx, newUUID(t), nil)
+	if errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting a post that does not exist = %v, want sql.ErrNoRows", err)
+	}
+	err = f.repo.UpdatePost(f.ctx, &service.DBPost{UUID: newUUID(t), UpdatedByUUID: sql.NullString{Valid: true, String: newUUID(t)}})
+	if errors.Cause(err) != service.ErrPostNotFound {
+		t.Errorf("updating a post that does not exist = %v, want ErrPostNotFound", err)
+	}
+	err = f.repo.DeletePost(f.ctx, newUUID(t), newUUID(t), false, 0)
+	if errors.Cause(err) != service.ErrPostNotFound {
+		t.Errorf("deleting a post that does not exist = %v, want ErrPostNotFound", err)
+	}
+	err = f.repo.AddReaction(f.ctx, &service.DBReaction{UUID: newUUID(t), PostUUID: newUUID(t), UserUUID: newUUID(t), Kind: "like", CreatedAt: f.tick()})
+	if errors.Cause(err) != service.ErrPostNotFound {
+		t.Errorf("reacting to a post that does not exist = %v, want ErrPostNotFound", err)
+	}
+	err = f.repo.CreateBookmark(f.ctx, &service.DBBookmark{UUID: newUUID(t), PostUUID: newUUID(t), UserUUID: newUUID(t), CreatedAt: f.tick()})
+	if errors.Cause(err) != service.ErrPostNotFound {
+		t.Errorf("bookmarking a post that does not exist = %v, want ErrPostNotFound", err)
+	}
+}
+
+func testPagination(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	link := f.link("https://example.com/paged")
+	var created []string
+	for i := 0; i < 5; i++ {
+		created = append(created, f.post(user, link, nil).UUID)
+	}
+	newest := []string{created[4], created[3], created[2], created[1], created[0]}
+
+	posts, _, info, err := f.repo.GetUsersPosts(f.ctx, user, nil, f.page("", 2))
+	if err != nil {
+		t.Fatalf("failed to get first page: %+v", err)
+	}
+	wantUUIDs(t, "first page", postUUIDs(posts), newest[:2]...)
+	if info.NextToken == "" || info.PrevToken != "" {
+		t.Fatalf("first page info = %+v, want only a next token", info)
+	}
+
+	posts, _, info, err = f.repo.GetUsersPosts(f.ctx, user, nil, f.page(info.NextToken, 2))
+	if err != nil {
+		t.Fatalf("failed to get second page: %+v", err)
+	}
+	wantUUIDs(t, "second page", postUUIDs(posts), newest[2:4]...)
+	if info.NextToken == "" || info.PrevToken == "" {
+		t.Fatalf("second page info = %+v, want both tokens", info)
+	}
+	prev := info.PrevToken
+
+	posts, _, info, err = f.repo.GetUsersPosts(f.ctx, user, nil, f.page(info.NextToken, 2))
+	if err != nil {
+		t.Fatalf("failed to get last page: %+v", err)
+	}
+	wantUUIDs(t, "last page", postUUIDs(posts), newest[4:]...)
+	if info.NextToken != "" {
+		t.Errorf("last page info = %+v, want no next token", info)
+	}
+
+	posts, _, _, err = f.repo.GetUsersPosts(f.ctx, user, nil, f.page(prev, 2))
+	if err != nil {
+		t.Fatalf("failed to page back: %+v", err)
+	}
+	wantUUIDs(t, "paging back", postUUIDs(posts), newest[:2]...)
+
+	posts, links, _, err := f.repo.GetLinksPosts(f.ctx, link.UUID, service.PostOrderNewest, nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get links posts: %+v", err)
+	}
+	wantUUIDs(t, "links posts", postUUIDs(posts), newest...)
+	for _, l := range links {
+		if l.UUID != link.UUID {
+			t.Errorf("links posts came with link %s, want %s", l.UUID, link.UUID)
+		}
+	}
+}
+
+func testLinkSourceHeads(t *testing.T, f *fixture) {
+	s1, s2, s3 := newUUID(t), newUUID(t), newUUID(t)
+	link := f.link("https://example.com/heads", s1, s2)
+
+	again := f.link("https://example.com/heads", s2, s3)
+	if again.UUID != link.UUID {
+		t.Fatalf("creating a link with the same url made link %s, want %s", again.UUID, link.UUID)
+	}
+	got, err := f.repo.GetLinkByUUID(f.ctx, link.UUID)
+	if err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	heads := append([]string(nil), got.SourceHeadUUIDs...)
+	sort.Strings(heads)
+	want := []string{s1, s2, s3}
+	sort.Strings(want)
+	if !reflect.DeepEqual(heads, want) {
+		t.Errorf("source heads = %v, want %v", heads, want)
+	}
+	if got.Version != 2 {
+		t.Errorf("version after merging source heads = %d, want 2", got.Version)
+	}
+
+	f.link("https://example.com/heads", s1)
+	if got, _ := f.repo.GetLinkByUUID(f.ctx, link.UUID); got != nil && got.Version != 2 {
+		t.Errorf("version after merging nothing = %d, want 2", got.Version)
+	}
+
+	byURL, err := f.repo.GetLinkByURL(f.ctx, "https://example.com/heads")
+	if err != nil {
+		t.Fatalf("failed to get link by url: %+v", err)
+	}
+	if byURL.UUID != link.UUID {
+		t.Errorf("link by url = %s, want %s", byURL.UUID, link.UUID)
+	}
+	if got.Status != linkcheck.StatusUnknown || got.StatusCheckedAt.Valid || got.Metadata != nil {
+		t.Errorf("new link = %+v, want an unchecked link without metadata", got)
+	}
+}
+
+func testLinkNotFound(t *testing.T, f *fixture) {
+	if _, err := f.repo.GetLinkByUUID(f.ctx, newUUID(t)); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting a link that does not exist by uuid = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := f.repo.GetLinkByURL(f.ctx, "https://example.com/missing"); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting a link that does not exist by url = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testPostWithLink(t *testing.T, f *fixture) {
+	user, s1, s2 := newUUID(t), newUUID(t), newUUID(t)
+	link := f.newLink("https://example.com/with-post", s1)
+	post := f.newPost(user, nil, nil)
+	if err := f.repo.CreatePostWithLink(f.ctx, link, post); err != nil {
+		t.Fatalf("failed to create post with link: %+v", err)
+	}
+	if _, err := f.repo.GetLinkByUUID(f.ctx, link.UUID); err != nil {
+		t.Fatalf("failed to get created link: %+v", err)
+	}
+	if got := f.get(post.UUID); got.LinkUUID != link.UUID {
+		t.Errorf("post link = %s, want %s", got.LinkUUID, link.UUID)
+	}
+
+	again := f.newLink("https://example.com/with-post", s2)
+	second := f.newPost(user, nil, nil)
+	if err := f.repo.CreatePostWithLink(f.ctx, again, second); err != nil {
+		t.Fatalf("failed to create post with existing link: %+v", err)
+	}
+	if again.UUID != link.UUID || second.LinkUUID != link.UUID {
+		t.Errorf("post with the same url is about link %s, want %s", second.LinkUUID, link.UUID)
+	}
+	merged, err := f.repo.GetLinkByUUID(f.ctx, link.UUID)
+	if err != nil {
+		t.Fatalf("failed to get merged link: %+v", err)
+	}
+	if len(merged.SourceHeadUUIDs) != 2 || merged.Version != 2 {
+		t.Errorf("merged link has source heads %v at version %d, want 2 at version 2", merged.SourceHeadUUIDs, merged.Version)
+	}
+
+	// a repost of a post that does not exist cannot be created, so neither can its link
+	missingRepost := func(p *service.DBPost) {
+		p.RepostOfUUID = sql.NullString{Valid: true, String: newUUID(t)}
+	}
+	orphan := f.newLink("https://example.com/orphan")
+	err = f.repo.CreatePostWithLink(f.ctx, orphan, f.newPost(user, nil, missingRepost))
+	if errors.Cause(err) != service.ErrRepostedPostNotFound {
+		t.Errorf("creating a post that fails with a link = %v, want ErrRepostedPostNotFound", err)
+	}
+	if _, err := f.repo.GetLinkByURL(f.ctx, "https://example.com/orphan"); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting the link of a post that failed = %v, want sql.ErrNoRows", err)
+	}
+	unmerged := f.newLink("https://example.com/with-post", newUUID(t))
+	if err := f.repo.CreatePostWithLink(f.ctx, unmerged, f.newPost(user, nil, missingRepost)); err == nil {
+		t.Fatalf("created a repost of a post that does not exist")
+	}
+	if got, err := f.repo.GetLinkByUUID(f.ctx, link.UUID); err != nil || len(got.SourceHeadUUIDs) != 2 || got.Version != 2 {
+		t.Errorf("link after a post that failed = %+v (%v), want its 2 source heads at version 2", got, err)
+	}
+}
+
+func testSources(t *testing.T, f *fixture) {
+	source := newUUID(t)
+	user := newUUID(t)
+	a := f.link("https://example.com/source/a", source)
+	b := f.link("https://example.com/source/b", source)
+	other := f.link("https://example.com/source/other", newUUID(t))
+	pa := f.post(user, a, nil)
+	f.post(user, other, nil)
+	pb := f.post(user, b, nil)
+
+	links, _, err := f.repo.GetSourcesLinks(f.ctx, source, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get sources links: %+v", err)
+	}
+	var got []string
+	for _, l := range links {
+		got = append(got, l.UUID)
+	}
+	wantUUIDs(t, "sources links", got, b.UUID, a.UUID)
+
+	posts, _, _, err := f.repo.GetSourcesPosts(f.ctx, source, nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get sources posts: %+v", err)
+	}
+	wantUUIDs(t, "sources posts", postUUIDs(posts), pb.UUID, pa.UUID)
+}
+
+func testRevisions(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	post := f.post(user, f.link("https://example.com/revised"), nil)
+	for i, title := range []string{"second", "third"} {
+		now := f.tick()
+		err := f.repo.UpdatePost(f.ctx, &service.DBPost{
+			UUID:          post.UUID,
+			Title:         title,
+			Comment:       "comment",
+			UpdatedByUUID: sql.NullString{Valid: true, String: user},
+			UpdatedAt:     sql.NullInt64{Valid: true, Int64: now},
+			Version:       int64(i + 1),
+		})
+		if err != nil {
+			t.Fatalf("failed to update post: %+v", err)
+		}
+	}
+	got := f.get(post.UUID)
+	if got.Title != "third" || got.Version != 3 {
+		t.Errorf("updated post = %+v, want title third at version 3", got)
+	}
+	revisions, err := f.repo.ListPostRevisions(f.ctx, post.UUID)
+	if err != nil {
+		t.Fatalf("failed to list revisions: %+v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 2 || revisions[0].Title != "second" || revisions[1].Revision != 1 || revisions[1].Title != "title" {
+		t.Errorf("revisions = %+v, want second then title", revisions)
+	}
+}
+
+func testVersions(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	post := f.post(user, f.link("https://example.com/versioned"), nil)
+	err := f.repo.UpdatePost(f.ctx, &service.DBPost{
+		UUID:          post.UUID,
+		Title:         "stale",
+		UpdatedByUUID: sql.NullString{Valid: true, String: user},
+		UpdatedAt:     sql.NullInt64{Valid: true, Int64: f.tick()},
+		Version:       5,
+	})
+	if errors.Cause(err) != service.ErrVersionConflict {
+		t.Errorf("updating a stale version = %v, want ErrVersionConflict", err)
+	}
+	if err := f.repo.DeletePost(f.ctx, post.UUID, user, false, 5); errors.Cause(err) != service.ErrVersionConflict {
+		t.Errorf("deleting a stale version = %v, want ErrVersionConflict", err)
+	}
+	if got := f.get(post.UUID); got.Title != "title" || got.Version != 1 {
+		t.Errorf("post after conflicts = %+v, want it unchanged", got)
+	}
+}
+
+func testDeleteAndRestore(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	post := f.post(user, f.link("https://example.com/deleted"), nil)
+	if err := f.repo.DeletePost(f.ctx, post.UUID, user, false, 1); err != nil {
+		t.Fatalf("failed to delete post: %+v", err)
+	}
+	if _, err := f.repo.GetPost(f.ctx, post.UUID, nil); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("getting a deleted post = %v, want sql.ErrNoRows", err)
+	}
+	posts, _ := f.repo.GetPostsByUUIDs(f.ctx, []string{post.UUID}, nil)
+	wantUUIDs(t, "deleted post by uuid", postUUIDs(posts), "")
+	posts, _ = f.repo.GetAnyPostsByUUIDs(f.ctx, []string{post.UUID}, nil)
+	wantUUIDs(t, "deleted post as a tombstone", postUUIDs(posts), post.UUID)
+	if len(posts) == 1 && posts[0] != nil && !posts[0].DeletedAt.Valid {
+		t.Errorf("tombstone %+v is not marked deleted", posts[0])
+	}
+	listed, _, _, _ := f.repo.GetUsersPosts(f.ctx, user, nil, f.page("", 10))
+	wantUUIDs(t, "users posts after delete", postUUIDs(listed))
+	if err := f.repo.DeletePost(f.ctx, post.UUID, user, false, 0); errors.Cause(err) != service.ErrPostNotFound {
+		t.Errorf("deleting a deleted post = %v, want ErrPostNotFound", err)
+	}
+
+	if err := f.repo.RestorePost(f.ctx, post.UUID, user, false, 1<<40); errors.Cause(err) != service.ErrPostNotRestorable {
+		t.Errorf("restoring a post deleted before the window = %v, want ErrPostNotRestorable", err)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, user, false, 0); err != nil {
+		t.Fatalf("failed to restore post: %+v", err)
+	}
+	if got := f.get(post.UUID); got.Version != 3 {
+		t.Errorf("restored post version = %d, want 3", got.Version)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, user, false, 0); errors.Cause(err) != service.ErrPostNotRestorable {
+		t.Errorf("restoring a post that is not deleted = %v, want ErrPostNotRestorable", err)
+	}
+}
+
+func testAuthors(t *testing.T, f *fixture) {
+	author, other := newUUID(t), newUUID(t)
+	link := f.link("https://example.com/authored")
+	post := f.post(author, link, nil)
+	err := f.repo.UpdatePost(f.ctx, &service.DBPost{
+		UUID:          post.UUID,
+		Title:         "hijacked",
+		UpdatedByUUID: sql.NullString{Valid: true, String: other},
+		UpdatedAt:     sql.NullInt64{Valid: true, Int64: f.tick()},
+	})
+	if errors.Cause(err) != service.ErrNotPostAuthor {
+		t.Errorf("updating another user's post = %v, want ErrNotPostAuthor", err)
+	}
+	draft := f.post(author, link, func(p *service.DBPost) { p.Draft = true })
+	if err := f.repo.PublishDraft(f.ctx, draft.UUID, other, 0); errors.Cause(err) != service.ErrNotPostAuthor {
+		t.Errorf("publishing another user's draft = %v, want ErrNotPostAuthor", err)
+	}
+	if err := f.repo.DeletePost(f.ctx, post.UUID, author, false, 0); err != nil {
+		t.Fatalf("failed to delete post: %+v", err)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, other, false, 0); errors.Cause(err) != service.ErrNotPostAuthor {
+		t.Errorf("restoring another user's post = %v, want ErrNotPostAuthor", err)
+	}
+	if got := f.get(draft.UUID); !got.Draft || got.Version != 1 {
+		t.Errorf("draft after another user published it = %+v, want it unchanged", got)
+	}
+}
+
+func testModeration(t *testing.T, f *fixture) {
+	author, moderator, other := newUUID(t), newUUID(t), newUUID(t)
+	post := f.post(author, f.link("https://example.com/moderated"), nil)
+	if err := f.repo.DeletePost(f.ctx, post.UUID, other, false, 0); errors.Cause(err) != service.ErrNotPostAuthor {
+		t.Errorf("deleting another user's post = %v, want ErrNotPostAuthor", err)
+	}
+	if err := f.repo.DeletePost(f.ctx, post.UUID, moderator, true, 0); err != nil {
+		t.Fatalf("failed to remove post as a moderator: %+v", err)
+	}
+	posts, _ := f.repo.GetAnyPostsByUUIDs(f.ctx, []string{post.UUID}, nil)
+	if len(posts) != 1 || posts[0] == nil || posts[0].DeletedByUUID.String != moderator || !posts[0].DeletedByModerator {
+		t.Errorf("removed post = %+v, want it deleted by the moderator", posts)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, author, false, 0); errors.Cause(err) != service.ErrPostRemovedByModerator {
+		t.Errorf("author restoring a removed post = %v, want ErrPostRemovedByModerator", err)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, moderator, true, 0); err != nil {
+		t.Fatalf("failed to restore post as a moderator: %+v", err)
+	}
+	if got := f.get(post.UUID); got.DeletedByModerator {
+		t.Errorf("restored post = %+v, want it no longer removed", got)
+	}
+	if err := f.repo.DeletePost(f.ctx, post.UUID, author, false, 0); err != nil {
+		t.Fatalf("failed to delete own post: %+v", err)
+	}
+	if err := f.repo.RestorePost(f.ctx, post.UUID, author, false, 0); err != nil {
+		t.Errorf("author restoring their own delete = %v, want it restored", err)
+	}
+}
+
+func testReplies(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	link := f.link("https://example.com/thread")
+	root := f.post(user, link, nil)
+	reply := f.post(user, nil, func(p *service.DBPost) {
+		p.ParentPostUUID = sql.NullString{Valid: true, String: root.UUID}
+	})
+	nested := f.post(user, nil, func(p *service.DBPost) {
+		p.ParentPostUUID = sql.NullString{Valid: true, String: reply.UUID}
+	})
+	second := f.post(user, nil, func(p *service.DBPost) {
+		p.ParentPostUUID = sql.NullString{Valid: true, String: root.UUID}
+	})
+
+	got := f.get(nested.UUID)
+	if got.LinkUUID != link.UUID || got.RootPostUUID.String != root.UUID {
+		t.Errorf("nested reply = %+v, want link %s and root %s", got, link.UUID, root.UUID)
+	}
+	if got := f.get(root.UUID); got.ReplyCount != 2 || got.EngagementCount != 2 {
+		t.Errorf("root reply count = %d and engagement %d, want 2 and 2", got.ReplyCount, got.EngagementCount)
+	}
+
+	replies, _, err := f.repo.GetReplies(f.ctx, root.UUID, nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get replies: %+v", err)
+	}
+	wantUUIDs(t, "replies", postUUIDs(replies), reply.UUID, second.UUID)
+
+	thread, _, err := f.repo.GetThread(f.ctx, root.UUID, 5, nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get thread: %+v", err)
+	}
+	wantUUIDs(t, "thread", postUUIDs(thread), reply.UUID, nested.UUID, second.UUID)
+
+	shallow, err := f.repo.GetDescendants(f.ctx, []string{root.UUID}, 1, nil)
+	if err != nil {
+		t.Fatalf("failed to get descendants: %+v", err)
+	}
+	// descendants come in no particular order, they are threaded by the caller
+	descendants := postUUIDs(shallow)
+	want := []string{reply.UUID, second.UUID}
+	sort.Strings(descendants)
+	sort.Strings(want)
+	wantUUIDs(t, "descendants to depth 1", descendants, want...)
+
+	if err := f.repo.DeletePost(f.ctx, reply.UUID, user, false, 0); err != nil {
+		t.Fatalf("failed to delete reply: %+v", err)
+	}
+	replies, _, _ = f.repo.GetReplies(f.ctx, root.UUID, nil, f.page("", 10))
+	wantUUIDs(t, "replies with a tombstone", postUUIDs(replies), reply.UUID, second.UUID)
+	if got := f.get(root.UUID); got.ReplyCount != 1 || got.EngagementCount != 1 {
+		t.Errorf("root reply count = %d and engagement %d after a delete, want 1 and 1", got.ReplyCount, got.EngagementCount)
+	}
+
+	err = f.repo.CreatePost(f.ctx, f.newPost(user, nil, func(p *service.DBPost) {
+		p.ParentPostUUID = sql.NullString{Valid: true, String: reply.UUID}
+	}))
+	if errors.Cause(err) != service.ErrParentPostNotFound {
+		t.Errorf("replying to a deleted post = %v, want ErrParentPostNotFound", err)
+	}
+
+	if err := f.repo.RestorePost(f.ctx, reply.UUID, user, false, 0); err != nil {
+		t.Fatalf("failed to restore reply: %+v", err)
+	}
+	if got := f.get(root.UUID); got.ReplyCount != 2 || got.EngagementCount != 2 {
+		t.Errorf("root reply count = %d and engagement %d after a restore, want 2 and 2", got.ReplyCount, got.EngagementCount)
+	}
+}
+
+func testReposts(t *testing.T, f *fixture) {
+	author, reposter := newUUID(t), newUUID(t)
+	link := f.link("https://example.com/reposted")
+	original := f.post(author, link, nil)
+	plain := func(of string) func(*service.DBPost) {
+		return func(p *service.DBPost) {
+			p.Title, p.Comment = "", ""
+			p.RepostOfUUID = sql.NullString{Valid: true, String: of}
+		}
+	}
+	repost := f.post(reposter, nil, plain(original.UUID))
+	if got := f.get(repost.UUID); got.LinkUUID != link.UUID {
+		t.Errorf("repost link = %s, want %s", got.LinkUUID, link.UUID)
+	}
+
+	err := f.repo.CreatePost(f.ctx, f.newPost(reposter, nil, plain(original.UUID)))
+	if errors.Cause(err) != service.ErrAlreadyReposted {
+		t.Errorf("reposting twice = %v, want ErrAlreadyReposted", err)
+	}
+	chained := f.post(newUUID(t), nil, plain(repost.UUID))
+	if got := f.get(chained.UUID); got.RepostOfUUID.String != original.UUID {
+		t.Errorf("repost of a repost reposts %s, want the original %s", got.RepostOfUUID.String, original.UUID)
+	}
+	if got := f.get(original.UUID); got.RepostCount != 2 || got.EngagementCount != 2 {
+		t.Errorf("original repost count = %d and engagement %d, want 2 and 2", got.RepostCount, got.EngagementCount)
+	}
+
+	if err := f.repo.DeletePost(f.ctx, chained.UUID, chained.UserUUID, false, 0); err != nil {
+		t.Fatalf("failed to delete repost: %+v", err)
+	}
+	if got := f.get(original.UUID); got.RepostCount != 1 {
+		t.Errorf("original repost count after deleting a repost = %d, want 1", got.RepostCount)
+	}
+	if err := f.repo.DeletePost(f.ctx, repost.UUID, reposter, false, 0); err != nil {
+		t.Fatalf("failed to delete repost: %+v", err)
+	}
+	f.post(reposter, nil, plain(original.UUID))
+	if err := f.repo.RestorePost(f.ctx, repost.UUID, reposter, false, 0); errors.Cause(err) != service.ErrAlreadyReposted {
+		t.Errorf("restoring a repost reposted again = %v, want ErrAlreadyReposted", err)
+	}
+	if got := f.get(original.UUID); got.RepostCount != 1 {
+		t.Errorf("original repost count after failing to restore a repost = %d, want 1", got.RepostCount)
+	}
+
+	err = f.repo.CreatePost(f.ctx, f.newPost(reposter, nil, plain(newUUID(t))))
+	if errors.Cause(err) != service.ErrRepostedPostNotFound {
+		t.Errorf("reposting a post that does not exist = %v, want ErrRepostedPostNotFound", err)
+	}
+	private := f.post(author, link, func(p *service.DBPost) { p.Visibility = service.VisibilityPrivate })
+	err = f.repo.CreatePost(f.ctx, f.newPost(reposter, nil, plain(private.UUID)))
+	if errors.Cause(err) != service.ErrRepostedPostNotPublic {
+		t.Errorf("reposting a private post = %v, want ErrRepostedPostNotPublic", err)
+	}
+	if err := f.repo.DeletePost(f.ctx, original.UUID, author, false, 0); err != nil {
+		t.Fatalf("failed to delete original: %+v", err)
+	}
+	err = f.repo.CreatePost(f.ctx, f.newPost(newUUID(t), nil, plain(original.UUID)))
+	if errors.Cause(err) != service.ErrRepostedPostDeleted {
+		t.Errorf("reposting a deleted post = %v, want ErrRepostedPostDeleted", err)
+	}
+}
+
+func testReactions(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	post := f.post(newUUID(t), f.link("https://example.com/reacted"), nil)
+	react := func(user string, kind string) *service.DBReaction {
+		reaction := &service.DBReaction{UUID: newUUID(t), PostUUID: post.UUID, UserUUID: user, Kind: kind, CreatedAt: f.tick()}
+		if err := f.repo.AddReaction(f.ctx, reaction); err != nil {
+			t.Fatalf("failed to add reaction: %+v", err)
+		}
+		return reaction
+	}
+	like := react(user, "like")
+	react(user, "like")
+	react(user, "laugh")
+	other := react(newUUID(t), "like")
+
+	got := f.get(post.UUID)
+	var counts []string
+	for _, c := range got.ReactionCounts {
+		counts = append(counts, fmt.Sprintf("%s:%d", c.Kind, c.Count))
+	}
+	wantUUIDs(t, "reaction counts", counts, "laugh:1", "like:2")
+	if got.EngagementCount != 3 {
+		t.Errorf("engagement = %d, want 3", got.EngagementCount)
+	}
+
+	reactions, _, err := f.repo.ListReactions(f.ctx, post.UUID, "like", f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to list reactions: %+v", err)
+	}
+	var uuids []string
+	for _, r := range reactions {
+		uuids = append(uuids, r.UUID)
+	}
+	wantUUIDs(t, "like reactions", uuids, other.UUID, like.UUID)
+
+	if err := f.repo.RemoveReaction(f.ctx, post.UUID, user, "laugh"); err != nil {
+		t.Fatalf("failed to remove reaction: %+v", err)
+	}
+	if err := f.repo.RemoveReaction(f.ctx, post.UUID, user, "laugh"); err != nil {
+		t.Fatalf("failed to remove a removed reaction: %+v", err)
+	}
+	reactions, _, _ = f.repo.ListReactions(f.ctx, post.UUID, "", f.page("", 10))
+	if len(reactions) != 2 {
+		t.Errorf("reactions after removing one = %d, want 2", len(reactions))
+	}
+	if got := f.get(post.UUID); len(got.ReactionCounts) != 1 || got.EngagementCount != 2 {
+		t.Errorf("post after removing a reaction = %+v, want only likes counted", got)
+	}
+}
+
+func testBookmarks(t *testing.T, f *fixture) {
+	user := newUUID(t)
+	link := f.link("https://example.com/bookmarked")
+	first := f.post(newUUID(t), link, nil)
+	second := f.post(newUUID(t), link, nil)
+	for _, p := range []*service.DBPost{first, second, first} {
+		err := f.repo.CreateBookmark(f.ctx, &service.DBBookmark{UUID: newUUID(t), UserUUID: user, PostUUID: p.UUID, CreatedAt: f.tick()})
+		if err != nil {
+			t.Fatalf("failed to bookmark post: %+v", err)
+		}
+	}
+	bookmarks, posts, links, info, err := f.repo.ListBookmarks(f.ctx, user, nil, f.page("", 1))
+	if err != nil {
+		t.Fatalf("failed to list bookmarks: %+v", err)
+	}
+	wantUUIDs(t, "first page of bookmarks", postUUIDs(posts), second.UUID)
+	if len(bookmarks) != 1 || bookmarks[0].PostUUID != second.UUID || len(links) != 1 || links[0].UUID != link.UUID {
+		t.Errorf("bookmarks = %+v with links %+v, want the second post's bookmark", bookmarks, links)
+	}
+	_, posts, _, _, err = f.repo.ListBookmarks(f.ctx, user, nil, f.page(info.NextToken, 1))
+	if err != nil {
+		t.Fatalf("failed to list second page of bookmarks: %+v", err)
+	}
+	wantUUIDs(t, "second page of bookmarks", postUUIDs(posts), first.UUID)
+
+	if err := f.repo.DeletePost(f.ctx, first.UUID, first.UserUUID, false, 0); err != nil {
+		t.Fatalf("failed to delete post: %+v", err)
+	}
+	_, posts, _, _, _ = f.repo.ListBookmarks(f.ctx, user, nil, f.page("", 10))
+	wantUUIDs(t, "bookmarks with a tombstone", postUUIDs(posts), second.UUID, first.UUID)
+
+	if err := f.repo.DeleteBookmark(f.ctx, user, second.UUID); err != nil {
+		t.Fatalf("failed to delete bookmark: %+v", err)
+	}
+	if err := f.repo.DeleteBookmark(f.ctx, user, second.UUID); err != nil {
+		t.Fatalf("failed to delete a deleted bookmark: %+v", err)
+	}
+	_, posts, _, _, _ = f.repo.ListBookmarks(f.ctx, user, nil, f.page("", 10))
+	wantUUIDs(t, "bookmarks after unbookmarking", postUUIDs(posts), first.UUID)
+}
+
+func testVisibility(t *testing.T, f *fixture) {
+	author, follower, stranger := newUUID(t), newUUID(t), newUUID(t)
+	link := f.link("https://example.com/visible")
+	posts := map[string]*service.DBPost{}
+	for _, v := range []string{service.VisibilityPublic, service.VisibilityUnlisted, service.VisibilityFollowers, service.VisibilityPrivate} {
+		visibility := v
+		posts[v] = f.post(author, link, func(p *service.DBPost) { p.Visibility = visibility })
+	}
+	viewers := []struct {
+		name   string
+		viewer *service.Viewer
+		got    []string
+		listed []string
+	}{
+		{"anonymous", &service.Viewer{}, []string{service.VisibilityPublic, service.VisibilityUnlisted}, []string{service.VisibilityPublic}},
+		{"stranger", &service.Viewer{UserUUID: stranger}, []string{service.VisibilityPublic, service.VisibilityUnlisted}, []string{service.VisibilityPublic}},
+		{"follower", &service.Viewer{UserUUID: follower, FollowingUUIDs: []string{author}}, []string{service.VisibilityPublic, service.VisibilityUnlisted, service.VisibilityFollowers}, []string{service.VisibilityPublic, service.VisibilityFollowers}},
+		{"author", &service.Viewer{UserUUID: author}, []string{service.VisibilityPublic, service.VisibilityUnlisted, service.VisibilityFollowers, service.VisibilityPrivate}, []string{service.VisibilityPublic, service.VisibilityUnlisted, service.VisibilityFollowers, service.VisibilityPrivate}},
+	}
+	for _, v := range viewers {
+		for visibility, post := range posts {
+			_, err := f.repo.GetPost(f.ctx, post.UUID, v.viewer)
+			if sees := containsString(v.got, visibility); sees != (err == nil) {
+				t.Errorf("%s getting a %s post = %v, want seen %t", v.name, visibility, err, sees)
+			}
+		}
+		listed, _, _, err := f.repo.GetLinksPosts(f.ctx, link.UUID, service.PostOrderNewest, v.viewer, f.page("", 10))
+		if err != nil {
+			t.Fatalf("failed to list posts for %s: %+v", v.name, err)
+		}
+		var want []string
+		for _, visibility := range []string{service.VisibilityPrivate, service.VisibilityFollowers, service.VisibilityUnlisted, service.VisibilityPublic} {
+			if containsString(v.listed, visibility) {
+				want = append(want, posts[visibility].UUID)
+			}
+		}
+		wantUUIDs(t, v.name+" listing", postUUIDs(listed), want...)
+	}
+}
+
+func testDrafts(t *testing.T, f *fixture) {
+	author := newUUID(t)
+	link := f.link("https://example.com/drafted")
+	draft := f.post(author, link, func(p *service.DBPost) { p.Draft = true })
+
+	if _, err := f.repo.GetPost(f.ctx, draft.UUID, &service.Viewer{UserUUID: newUUID(t)}); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("another user getting a draft = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := f.repo.GetPost(f.ctx, draft.UUID, &service.Viewer{UserUUID: author}); err != nil {
+		t.Errorf("the author getting their draft = %v, want it", err)
+	}
+	listed, _, _, _ := f.repo.GetUsersPosts(f.ctx, author, &service.Viewer{UserUUID: author}, f.page("", 10))
+	wantUUIDs(t, "author's listing without drafts", postUUIDs(listed))
+	listed, _, _, _ = f.repo.GetUsersPosts(f.ctx, author, &service.Viewer{UserUUID: author, OwnDrafts: true}, f.page("", 10))
+	wantUUIDs(t, "author's listing with drafts", postUUIDs(listed), draft.UUID)
+
+	err := f.repo.CreatePost(f.ctx, f.newPost(newUUID(t), nil, func(p *service.DBPost) {
+		p.ParentPostUUID = sql.NullString{Valid: true, String: draft.UUID}
+	}))
+	if errors.Cause(err) != service.ErrParentPostNotFound {
+		t.Errorf("replying to a draft = %v, want ErrParentPostNotFound", err)
+	}
+
+	if err := f.repo.PublishDraft(f.ctx, draft.UUID, author, 1); err != nil {
+		t.Fatalf("failed to publish draft: %+v", err)
+	}
+	if got := f.get(draft.UUID); got.Draft || got.Version != 2 {
+		t.Errorf("published draft = %+v, want a post at version 2", got)
+	}
+	if err := f.repo.PublishDraft(f.ctx, draft.UUID, author, 0); errors.Cause(err) != service.ErrPostNotDraft {
+		t.Errorf("publishing a published post = %v, want ErrPostNotDraft", err)
+	}
+	listed, _, _, _ = f.repo.GetUsersPosts(f.ctx, author, &service.Viewer{}, f.page("", 10))
+	wantUUIDs(t, "listing after publishing", postUUIDs(listed), draft.UUID)
+}
+
+func testTagsAndMentions(t *testing.T, f *fixture) {
+	user, mentioned := newUUID(t), newUUID(t)
+	link := f.link("https://example.com/tagged")
+	first := f.post(user, link, func(p *service.DBPost) {
+		p.Tags = []string{"go", "db"}
+		p.Mentions = []*service.DBPostMention{{UserUUID: mentioned, Start: 5, End: 10}}
+	})
+	second := f.post(user, link, func(p *service.DBPost) { p.Tags = []string{"go"} })
+	f.post(user, link, func(p *service.DBPost) {
+		p.Tags = []string{"hidden"}
+		p.Visibility = service.VisibilityPrivate
+	})
+
+	got := f.get(first.UUID)
+	if !reflect.DeepEqual(got.Tags, []string{"db", "go"}) || len(got.Mentions) != 1 || got.Mentions[0].UserUUID != mentioned {
+		t.Errorf("tagged post = %+v, want tags [db go] and one mention", got)
+	}
+	tagged, _, _, err := f.repo.GetTagsPosts(f.ctx, "go", nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get tags posts: %+v", err)
+	}
+	wantUUIDs(t, "tagged posts", postUUIDs(tagged), second.UUID, first.UUID)
+	mentioning, _, _, err := f.repo.GetMentioningPosts(f.ctx, mentioned, nil, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get mentioning posts: %+v", err)
+	}
+	wantUUIDs(t, "mentioning posts", postUUIDs(mentioning), first.UUID)
+
+	trending, err := f.repo.ListTrendingTags(f.ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to list trending tags: %+v", err)
+	}
+	var tags []string
+	for _, tag := range trending {
+		tags = append(tags, tag.Tag)
+	}
+	wantUUIDs(t, "trending tags", tags, "go", "db")
+}
+
+func testFeed(t *testing.T, f *fixture) {
+	followed, source := newUUID(t), newUUID(t)
+	shared := f.link("https://example.com/feed/shared")
+	sourced := f.link("https://example.com/feed/sourced", source)
+	f.post(followed, shared, nil)
+	newer := f.post(followed, shared, nil)
+	fromSource := f.post(newUUID(t), sourced, nil)
+	f.post(newUUID(t), f.link("https://example.com/feed/unfollowed"), nil)
+
+	viewer := &service.Viewer{UserUUID: newUUID(t), FollowingUUIDs: []string{followed}}
+	posts, _, _, err := f.repo.GetFeedPosts(f.ctx, []string{followed}, []string{source}, viewer, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get feed: %+v", err)
+	}
+	wantUUIDs(t, "feed", postUUIDs(posts), fromSource.UUID, newer.UUID)
+	empty, _, _, err := f.repo.GetFeedPosts(f.ctx, nil, nil, viewer, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to get empty feed: %+v", err)
+	}
+	wantUUIDs(t, "empty feed", postUUIDs(empty))
+}
+
+func testLinkChecks(t *testing.T, f *fixture) {
+	checked := f.link("https://example.com/checked")
+	unchecked := f.link("https://example.com/unchecked")
+	check := func(ok bool) {
+		err := f.repo.RecordLinkCheck(f.ctx, &service.DBLinkCheck{UUID: newUUID(t), LinkUUID: checked.UUID, CheckedAt: f.tick(), OK: ok}, 2)
+		if err != nil {
+			t.Fatalf("failed to record link check: %+v", err)
+		}
+	}
+	check(false)
+	due, err := f.repo.ListLinksToCheck(f.ctx, f.now+1, 10)
+	if err != nil {
+		t.Fatalf("failed to list links to check: %+v", err)
+	}
+	var uuids []string
+	for _, l := range due {
+		uuids = append(uuids, l.UUID)
+	}
+	wantUUIDs(t, "links to check", uuids, unchecked.UUID, checked.UUID)
+	due, _ = f.repo.ListLinksToCheck(f.ctx, f.now, 10)
+	if len(due) != 1 || due[0].UUID != unchecked.UUID {
+		t.Errorf("links to check since the last check = %+v, want only %s", due, unchecked.UUID)
+	}
+
+	dead, _, _ := f.repo.ListDeadLinks(f.ctx, f.page("", 10))
+	if len(dead) != 0 {
+		t.Errorf("dead links after one failure = %d, want 0", len(dead))
+	}
+	check(false)
+	dead, _, err = f.repo.ListDeadLinks(f.ctx, f.page("", 10))
+	if err != nil {
+		t.Fatalf("failed to list dead links: %+v", err)
+	}
+	if len(dead) != 1 || dead[0].UUID != checked.UUID || dead[0].Status != linkcheck.StatusDead {
+		t.Errorf("dead links after two failures = %+v, want %s", dead, checked.UUID)
+	}
+	check(true)
+	if got, _ := f.repo.GetLinkByUUID(f.ctx, checked.UUID); got == nil || got.Status == linkcheck.StatusDead {
+		t.Errorf("link after recovering = %+v, want it alive", got)
+	}
+	if err := f.repo.RecordLinkCheck(f.ctx, &service.DBLinkCheck{UUID: newUUID(t), LinkUUID: newUUID(t), CheckedAt: f.tick()}, 2); err == nil {
+		t.Errorf("checking a link that does not exist did not fail")
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mysqlDuplicateEntry is the MySQL error number of an insert or update that violates a unique key
+	mysqlDuplicateEntry = 1062
+	// mysqlTooManyConnections is the MySQL error number of a connection refused because the server is full
+	mysqlTooManyConnections = 1040
+	// mysqlServerShutdown is the MySQL error number of a statement interrupted by the server shutting down
+	mysqlServerShutdown = 1053
+)
+
+// mysqlInvalidConnection is the message of the MySQL driver's error for a connection that broke mid statement
+const mysqlInvalidConnection = "invalid connection"
+
+// mysqlErrorNumber is the number of a MySQL server error, the MySQL driver is only a dependency of the services
+// mysql client so its errors are recognized by their message, which starts with the number in every driver version
+func mysqlErrorNumber(err error) (int, bool) {
+	var number int
+	if _, scanErr := fmt.Sscanf(errors.Cause(err).Error(), "Error %d", &number); scanErr != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// duplicateKey is whether a database error is a violation of a unique key, e.g. by another transaction inserting
+// the same row between a lookup and an insert
+func duplicateKey(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	number, ok := mysqlErrorNumber(err)
+	return ok && number == mysqlDuplicateEntry
+}
+
+// unreachable is whether a database error means the database could not be reached or could not take the
+// statement right now, so the request can be retried
+func unreachable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	if errors.Cause(err).Error() == mysqlInvalidConnection {
+		return true
+	}
+	number, ok := mysqlErrorNumber(err)
+	return ok && (number == mysqlTooManyConnections || number == mysqlServerShutdown)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// uuidDescription is what is wrong with a request field that does not hold a uuid
+const uuidDescription = "must be a 16 byte uuid"
+
+// NotFoundError is returned when a resource does not exist, has been deleted or cannot be seen by the viewer
+type NotFoundError struct {
+	// Resource is the type of resource, e.g. post or link
+	Resource string
+	// Description is what clients are told went wrong
+	Description string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Description
+}
+
+// AlreadyExistsError is returned when creating a resource that already exists
+type AlreadyExistsError struct {
+	// Resource is the type of resource, e.g. post or link
+	Resource string
+	// Description is what clients are told went wrong
+	Description string
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return e.Description
+}
+
+// ConflictError is returned when a mutation expected a different version of a resource
+type ConflictError struct {
+	// Resource is the type of resource, e.g. post or link
+	Resource string
+	// Description is what clients are told went wrong
+	Description string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Description
+}
+
+// PreconditionError is returned when a resource is not in the state a mutation needs it to be in
+type PreconditionError struct {
+	// Resource is the type of resource, e.g. post or link
+	Resource string
+	// Description is what clients are told went wrong
+	Description string
+}
+
+func (e *PreconditionError) Error() string {
+	return e.Description
+}
+
+// PermissionError is returned when a user changes a resource only its owner can change
+type PermissionError struct {
+	// Resource is the type of resource, e.g. post or link
+	Resource string
+	// Description is what clients are told went wrong
+	Description string
+}
+
+func (e *PermissionError) Error() string {
+	return e.Description
+}
+
+// UnavailableError is returned when a dependency of the service cannot be reached, the request can be retried
+type UnavailableError struct {
+	// Dependency is what could not be reached, e.g. the database or the follow graph
+	Dependency string
+	// Err is why it could not be reached, it is logged rather than told to clients
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s is unavailable: %v", e.Dependency, e.Err)
+}
+
+// Unwrap is why the dependency could not be reached
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError is returned when a field of a request is not valid
+type FieldError struct {
+	// Field is the name of the field in the request, e.g. post_uuid
+	Field string
+	// Description is what is wrong with the field
+	Description string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Description)
+}
+
+// invalidUUID is the error for a request field that does not hold a uuid
+func invalidUUID(field string) error {
+	return &FieldError{Field: field, Description: uuidDescription}
+}
+
+// ValidationError is returned when fields of a request are not valid, it holds every field that is not
+type ValidationError struct {
+	Violations []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.Error()
+	}
+	return strings.Join(violations, "; ")
+}
+
+// resourceError names the resource a repository error is about,
+// a lookup of it that found no rows is a NotFoundError of its type
+type resourceError struct {
+	err      error
+	resource string
+	name     string
+}
+
+// aboutResource names the resource an error is about, its cause is still the error's cause
+func aboutResource(err error, resource string, name string) error {
+	return &resourceError{err: err, resource: resource, name: name}
+}
+
+func (e *resourceError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.resource, e.name, e.err)
+}
+
+// Cause is the error about the resource
+func (e *resourceError) Cause() error {
+	return e.err
+}
+
+// Unwrap is the error about the resource
+func (e *resourceError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,9 @@
+package service
+
+import "context"
+
+// FollowGraph looks up who and what a user follows, it is backed by whichever service owns follows
+type FollowGraph interface {
+	// Following returns the uuids of the users and the sources a user follows
+	Following(ctx context.Context, userUUID string) (userUUIDs []string, sourceUUIDs []string, err error)
+}
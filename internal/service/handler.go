@@ -2,33 +2,61 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+	"github.com/srcabl/posts/internal/fetch"
+	"github.com/srcabl/posts/internal/hashtag"
+	"github.com/srcabl/posts/internal/keyset"
+	"github.com/srcabl/posts/internal/mention"
+	"github.com/srcabl/posts/internal/redirects"
+	"github.com/srcabl/posts/internal/search"
+	"github.com/srcabl/posts/internal/unfurl"
 	pb "github.com/srcabl/protos/posts"
 	"github.com/srcabl/protos/shared"
-	"github.com/srcabl/services/pkg/db/mysql"
-	"github.com/srcabl/services/pkg/proto"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // Handler implements the posts service
 type Handler struct {
 	pb.UnimplementedPostsServiceServer
+	config   *Config
 	datarepo DataRepository
+	unfurler *unfurl.Unfurler
+	resolver *redirects.Resolver
+	search   SearchIndex
+
+	// unfurls are the link unfurls running in the background, none start once unfurlsStopped is set
+	unfurls        sync.WaitGroup
+	unfurlsMu      sync.Mutex
+	unfurlsStopped bool
 }
 
 // New creates the service handler
-func New(db *mysql.Client) (*Handler, error) {
-	dataRepo, err := NewDataRepository(db)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create data repo")
+func New(dataRepo DataRepository, cfg *Config) (*Handler, error) {
+	if dataRepo == nil {
+		return nil, errors.New("a data repository is required")
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	searchIndex := cfg.SearchIndex
+	if searchIndex == nil {
+		searchIndex = search.NewMemoryIndex()
 	}
 	return &Handler{
+		config:   cfg,
 		datarepo: dataRepo,
+		unfurler: unfurl.New(fetch.NewClient(cfg.UnfurlTimeout)),
+		resolver: redirects.New(fetch.NewClient(cfg.RedirectTimeout), cfg.RedirectMaxHops),
+		search:   searchIndex,
 	}, nil
 }
 
@@ -40,125 +68,1497 @@ func (h *Handler) HealthCheck(ctx context.Context, empty *emptypb.Empty) (*empty
 
 // GetPost gets a post
 func (h *Handler) GetPost(ctx context.Context, req *pb.GetPostRequest) (*pb.GetPostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
 	postID, err := uuid.FromBytes(req.PostUuid)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrapf(err, "failed to convert uuid").Error())
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
 	}
-	dbPost, err := h.datarepo.GetPost(ctx, postID.String())
+	dbPost, err := h.datarepo.GetPost(ctx, postID.String(), viewer)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "something happened")
+		return nil, statusError(errors.Wrap(err, "failed to get post"))
 	}
 	pbPost, err := dbPost.ToGRPC()
 	if err != nil {
-		return nil, status.Error(codes.Internal, "something happened")
+		return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
+	}
+	if err := h.embedReposts(ctx, viewer, []*shared.Post{pbPost}, []*DBPost{dbPost}); err != nil {
+		return nil, statusError(err)
 	}
 	return &pb.GetPostResponse{Post: pbPost}, nil
 }
 
 // GetLink gets a link
 func (h *Handler) GetLink(ctx context.Context, req *pb.GetLinkRequest) (*pb.GetLinkResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
 	var dbLink *DBLink
 	if req.GetBy == pb.GetLinkRequest_URL {
 		l, err := h.datarepo.GetLinkByURL(ctx, req.Url)
 		if err != nil {
-			return nil, status.Error(codes.Internal, errors.Wrap(err, "Something happened").Error())
+			return nil, statusError(errors.Wrap(err, "failed to get link"))
 		}
 		dbLink = l
 	}
 	if req.GetBy == pb.GetLinkRequest_UUID {
-		l, err := h.datarepo.GetLinkByUUID(ctx, string(req.LinkUuid))
+		linkID, err := uuid.FromBytes(req.LinkUuid)
+		if err != nil {
+			return nil, statusError(invalidUUID("link_uuid"))
+		}
+		l, err := h.datarepo.GetLinkByUUID(ctx, linkID.String())
 		if err != nil {
-			return nil, status.Error(codes.Internal, errors.Wrap(err, "Something happened").Error())
+			return nil, statusError(errors.Wrap(err, "failed to get link"))
 		}
 		dbLink = l
 	}
 	if dbLink == nil {
-		return nil, status.Error(codes.InvalidArgument, "UNKNOWN get by value is not supported")
+		return nil, statusError(&FieldError{Field: "get_by", Description: "UNKNOWN get by value is not supported"})
 	}
 	pbLink, err := dbLink.ToGRPC()
 	if err != nil {
-		return nil, status.Error(codes.Internal, errors.Wrap(err, "something happened").Error())
+		return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
 	}
 	return &pb.GetLinkResponse{Link: pbLink}, nil
 }
 
+// BatchGetPosts gets many posts at once, the results are in the order of the requested uuids
+func (h *Handler) BatchGetPosts(ctx context.Context, req *pb.BatchGetPostsRequest) (*pb.BatchGetPostsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postIDs, err := h.batchUUIDs("post_uuids", req.PostUuids)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	dbPosts, err := h.datarepo.GetPostsByUUIDs(ctx, postIDs, viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get posts"))
+	}
+	results := make([]*pb.BatchGetPostsResponse_Result, len(dbPosts))
+	var found []*DBPost
+	var posts []*shared.Post
+	for i, dbp := range dbPosts {
+		results[i] = &pb.BatchGetPostsResponse_Result{PostUuid: req.PostUuids[i]}
+		if dbp == nil {
+			results[i].NotFound = true
+			continue
+		}
+		p, err := dbp.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
+		}
+		results[i].Post = p
+		found = append(found, dbp)
+		posts = append(posts, p)
+	}
+	if err := h.embedReposts(ctx, viewer, posts, found); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.BatchGetPostsResponse{Results: results}, nil
+}
+
+// BatchGetLinks gets many links at once, the results are in the order of the requested uuids
+func (h *Handler) BatchGetLinks(ctx context.Context, req *pb.BatchGetLinksRequest) (*pb.BatchGetLinksResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	linkIDs, err := h.batchUUIDs("link_uuids", req.LinkUuids)
+	if err != nil {
+		return nil, err
+	}
+	dbLinks, err := h.datarepo.GetLinksByUUIDs(ctx, linkIDs)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get links"))
+	}
+	results := make([]*pb.BatchGetLinksResponse_Result, len(dbLinks))
+	for i, dbl := range dbLinks {
+		results[i] = &pb.BatchGetLinksResponse_Result{LinkUuid: req.LinkUuids[i]}
+		if dbl == nil {
+			results[i].NotFound = true
+			continue
+		}
+		l, err := dbl.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
+		}
+		results[i].Link = l
+	}
+	return &pb.BatchGetLinksResponse{Results: results}, nil
+}
+
+// batchUUIDs converts the uuids in a field of a batch request
+func (h *Handler) batchUUIDs(field string, rawUUIDs [][]byte) ([]string, error) {
+	ids, err := uuidsToStrings(rawUUIDs)
+	if err != nil {
+		return nil, statusError(invalidUUID(field))
+	}
+	return ids, nil
+}
+
 // ListUsersPosts gets list of posts
 func (h *Handler) ListUsersPosts(ctx context.Context, req *pb.ListUsersPostsRequest) (*pb.ListUsersPostsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
 	userID, err := uuid.FromBytes(req.UserUuid)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrapf(err, "failed to convert uuid").Error())
+		return nil, statusError(invalidUUID("user_uuid"))
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	// users see their own drafts among their posts
+	viewer.OwnDrafts = viewer.UserUUID == userID.String()
+	dbPosts, dbLinks, pageInfo, err := h.datarepo.GetUsersPosts(ctx, userID.String(), viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list users posts"))
+	}
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if err := h.embedReposts(ctx, viewer, posts, dbPosts); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListUsersPostsResponse{
+		Posts:         posts,
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// ListPostsForLink lists the posts about a link, found by its uuid or url
+func (h *Handler) ListPostsForLink(ctx context.Context, req *pb.ListPostsForLinkRequest) (*pb.ListPostsForLinkResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	var dbLink *DBLink
+	if req.GetBy == pb.ListPostsForLinkRequest_URL {
+		l, err := h.datarepo.GetLinkByURL(ctx, req.Url)
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to get link"))
+		}
+		dbLink = l
+	} else {
+		linkID, err := uuid.FromBytes(req.LinkUuid)
+		if err != nil {
+			return nil, statusError(invalidUUID("link_uuid"))
+		}
+		l, err := h.datarepo.GetLinkByUUID(ctx, linkID.String())
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to get link"))
+		}
+		dbLink = l
+	}
+	order := PostOrderNewest
+	if req.SortBy == pb.ListPostsForLinkRequest_ENGAGEMENT {
+		order = PostOrderEngagement
+	}
+	page, err := h.page(req, order.pageOrder())
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	dbPosts, _, pageInfo, err := h.datarepo.GetLinksPosts(ctx, dbLink.UUID, order, viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list links posts"))
 	}
-	pagToken := proto.NewTokenFromRequest(req)
-	fmt.Printf("Pag Token: %+v\n", pagToken)
-	dbPosts, dbLinks, err := h.datarepo.GetUsersPosts(ctx, userID.String(), pagToken)
 	var posts []*shared.Post
-	var links []*shared.Link
-	for i, dbp := range dbPosts {
+	for _, dbp := range dbPosts {
 		p, err := dbp.ToGRPC()
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to transform dbpost").Error())
+			return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
 		}
-		l, err := dbLinks[i].ToGRPC()
+		posts = append(posts, p)
+	}
+	link, err := dbLink.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
+	}
+	return &pb.ListPostsForLinkResponse{
+		Link:          link,
+		Posts:         posts,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// ListLinksBySource lists the links a source is a source head of
+func (h *Handler) ListLinksBySource(ctx context.Context, req *pb.ListLinksBySourceRequest) (*pb.ListLinksBySourceResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	sourceID, err := uuid.FromBytes(req.SourceUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("source_uuid"))
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	dbLinks, pageInfo, err := h.datarepo.GetSourcesLinks(ctx, sourceID.String(), page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list sources links"))
+	}
+	var links []*shared.Link
+	for _, dbl := range dbLinks {
+		l, err := dbl.ToGRPC()
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to transform dblink").Error())
+			return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
 		}
-		posts = append(posts, p)
 		links = append(links, l)
 	}
-	nextToken, err := pagToken.EncodeNextToken()
+	return &pb.ListLinksBySourceResponse{
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// ListPostsBySource lists the posts about links a source is a source head of
+func (h *Handler) ListPostsBySource(ctx context.Context, req *pb.ListPostsBySourceRequest) (*pb.ListPostsBySourceResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	sourceID, err := uuid.FromBytes(req.SourceUuid)
 	if err != nil {
-		return nil, status.Error(codes.Internal, errors.Wrap(err, "failed to get next token").Error())
+		return nil, statusError(invalidUUID("source_uuid"))
 	}
-	return &pb.ListUsersPostsResponse{
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	dbPosts, dbLinks, pageInfo, err := h.datarepo.GetSourcesPosts(ctx, sourceID.String(), viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list sources posts"))
+	}
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListPostsBySourceResponse{
 		Posts:         posts,
 		Links:         links,
-		NextPageToken: nextToken,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
 	}, nil
 }
 
-// CreateLink is the handler for creating posts
-func (h *Handler) CreateLink(ctx context.Context, req *pb.CreateLinkRequest) (*pb.CreateLinkResponse, error) {
-	dbLink, err := HydrateLinkModelForCreate(req)
+// ListHomeFeed lists the posts by the users and about the links from the sources a user follows
+func (h *Handler) ListHomeFeed(ctx context.Context, req *pb.ListHomeFeedRequest) (*pb.ListHomeFeedResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.FromBytes(req.UserUuid)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to hydrate link for create").Error())
+		return nil, statusError(invalidUUID("user_uuid"))
 	}
-	if err := h.datarepo.CreateLink(ctx, dbLink); err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to create link").Error())
+	requestedUsers, err := uuidsToStrings(req.FollowedUserUuids)
+	if err != nil {
+		return nil, statusError(invalidUUID("followed_user_uuids"))
 	}
-	hydratedPBLink, err := dbLink.ToGRPC()
+	requestedSources, err := uuidsToStrings(req.FollowedSourceUuids)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "something ridiculos").Error())
+		return nil, statusError(invalidUUID("followed_source_uuids"))
 	}
-	return &pb.CreateLinkResponse{
-		Link: hydratedPBLink,
+	// without a follow graph the feed is of the follows in the request, which cannot be trusted to see followers
+	// only posts; with one, follows and what they see come from the graph and a request can only narrow them
+	followedUsers, followedSources := requestedUsers, requestedSources
+	viewer := &Viewer{UserUUID: userID.String()}
+	if h.config.FollowGraph != nil {
+		graphUsers, graphSources, err := h.config.FollowGraph.Following(ctx, userID.String())
+		if err != nil {
+			return nil, statusError(&UnavailableError{Dependency: "follow graph", Err: err})
+		}
+		// like viewerOf, a user following more than a feed can hold gets a feed of the first of their follows
+		if len(graphUsers) > h.config.MaxFeedFollows {
+			graphUsers = graphUsers[:h.config.MaxFeedFollows]
+		}
+		if len(graphSources) > h.config.MaxFeedFollows-len(graphUsers) {
+			graphSources = graphSources[:h.config.MaxFeedFollows-len(graphUsers)]
+		}
+		viewer.FollowingUUIDs = graphUsers
+		followedUsers, followedSources = graphUsers, graphSources
+		if len(requestedUsers) > 0 || len(requestedSources) > 0 {
+			followedUsers = onlyFollowed(requestedUsers, graphUsers)
+			followedSources = onlyFollowed(requestedSources, graphSources)
+		}
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	dbPosts, dbLinks, pageInfo, err := h.datarepo.GetFeedPosts(ctx, followedUsers, followedSources, viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list feed posts"))
+	}
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListHomeFeedResponse{
+		Posts:         posts,
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
 	}, nil
 }
 
-// CreatePost is the handler for creating posts
-func (h *Handler) CreatePost(ctx context.Context, req *pb.CreatePostRequest) (*pb.CreatePostResponse, error) {
-	fmt.Print("Creating Post: %+v\n")
-	dbPost, err := HydratePostModelForCreate(req)
+// ListPostsByTag lists the posts tagged with a hashtag, newest first
+func (h *Handler) ListPostsByTag(ctx context.Context, req *pb.ListPostsByTagRequest) (*pb.ListPostsByTagResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	tag := hashtag.Normalize(req.Tag)
+	page, err := h.page(req, pageOrderNewest)
 	if err != nil {
-		fmt.Printf("Failed to hydrate: %+v\n", err)
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to hydrate post for create").Error())
+		return nil, err
 	}
-	if err := h.datarepo.CreatePost(ctx, dbPost); err != nil {
-		fmt.Printf("Failed to create post: %+v\n", err)
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to create link").Error())
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
 	}
-	hydratedPBPost, err := dbPost.ToGRPC()
+	dbPosts, dbLinks, pageInfo, err := h.datarepo.GetTagsPosts(ctx, tag, viewer, page)
 	if err != nil {
-		fmt.Printf("Failed to grpc: %+v\n", err)
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "something ridiculos").Error())
+		return nil, statusError(errors.Wrap(err, "failed to list tags posts"))
 	}
-	fmt.Printf("Returning from Create Post\n")
-	return &pb.CreatePostResponse{
-		Post: hydratedPBPost,
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListPostsByTagResponse{
+		Posts:         posts,
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
 	}, nil
 }
 
-// DeletePost deletes a post
-func (h *Handler) DeletePost(ctx context.Context, req *pb.DeletePostRequest) (*pb.DeletePostResponse, error) {
+// ListPostsMentioningUser lists the posts mentioning a user, newest first
+func (h *Handler) ListPostsMentioningUser(ctx context.Context, req *pb.ListPostsMentioningUserRequest) (*pb.ListPostsMentioningUserResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("user_uuid"))
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	dbPosts, dbLinks, pageInfo, err := h.datarepo.GetMentioningPosts(ctx, userID.String(), viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list posts mentioning user"))
+	}
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListPostsMentioningUserResponse{
+		Posts:         posts,
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// ListReplies lists the replies under a post, oldest first, either as a tree of the direct replies and
+// their replies down to a depth or as a flat thread of every reply, deleted replies are tombstones
+func (h *Handler) ListReplies(ctx context.Context, req *pb.ListRepliesRequest) (*pb.ListRepliesResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	maxDepth := int(req.MaxDepth)
+	if maxDepth <= 0 || maxDepth > h.config.MaxThreadDepth {
+		maxDepth = h.config.MaxThreadDepth
+	}
+	page, err := h.page(req, pageOrderOldest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, postID.String()); err != nil {
+		return nil, err
+	}
+	var threaded []*pb.ThreadedPost
+	var pageInfo *keyset.PageInfo
+	if req.View == pb.ListRepliesRequest_FLAT {
+		var dbPosts []*DBPost
+		dbPosts, pageInfo, err = h.datarepo.GetThread(ctx, postID.String(), maxDepth, viewer, page)
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to list thread"))
+		}
+		for _, dbp := range dbPosts {
+			p, err := dbp.ToGRPC()
+			if err != nil {
+				return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
+			}
+			threaded = append(threaded, &pb.ThreadedPost{Post: p})
+		}
+	} else {
+		var replies []*DBPost
+		replies, pageInfo, err = h.datarepo.GetReplies(ctx, postID.String(), viewer, page)
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to list replies"))
+		}
+		replyIDs := make([]string, len(replies))
+		for i, r := range replies {
+			replyIDs[i] = r.UUID
+		}
+		descendants, err := h.datarepo.GetDescendants(ctx, replyIDs, maxDepth-1, viewer)
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to list descendants"))
+		}
+		threaded, err = replyTree(replies, descendants)
+		if err != nil {
+			return nil, statusError(err)
+		}
+	}
+	return &pb.ListRepliesResponse{
+		Replies:       threaded,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// replyTree orders replies and their descendants depth first, each post followed by its replies oldest first
+func replyTree(replies []*DBPost, descendants []*DBPost) ([]*pb.ThreadedPost, error) {
+	children := map[string][]*DBPost{}
+	for _, d := range descendants {
+		children[d.ParentPostUUID.String] = append(children[d.ParentPostUUID.String], d)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool {
+			if c[i].CreatedAt != c[j].CreatedAt {
+				return c[i].CreatedAt < c[j].CreatedAt
+			}
+			return c[i].UUID < c[j].UUID
+		})
+	}
+	var threaded []*pb.ThreadedPost
+	var walk func(post *DBPost, depth int32) error
+	walk = func(post *DBPost, depth int32) error {
+		p, err := post.ToGRPC()
+		if err != nil {
+			return errors.Wrap(err, "failed to transform dbpost")
+		}
+		threaded = append(threaded, &pb.ThreadedPost{Post: p, Depth: depth})
+		for _, c := range children[post.UUID] {
+			if err := walk(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, r := range replies {
+		if err := walk(r, 1); err != nil {
+			return nil, err
+		}
+	}
+	return threaded, nil
+}
+
+// AddReaction adds a user's reaction to a post, adding a reaction the user already made is a no-op
+func (h *Handler) AddReaction(ctx context.Context, req *pb.AddReactionRequest) (*pb.AddReactionResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbReaction, err := HydrateReactionModelForAdd(req)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate reaction for add"))
+	}
+	viewer, err := h.viewerOf(ctx, dbReaction.UserUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, dbReaction.PostUUID); err != nil {
+		return nil, err
+	}
+	if err := h.datarepo.AddReaction(ctx, dbReaction); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to add reaction"))
+	}
+	pbPost, err := h.reactedPost(ctx, viewer, dbReaction.PostUUID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AddReactionResponse{Post: pbPost}, nil
+}
+
+// RemoveReaction removes a user's reaction from a post, removing a reaction the user did not make is a no-op
+func (h *Handler) RemoveReaction(ctx context.Context, req *pb.RemoveReactionRequest) (*pb.RemoveReactionResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	userID, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("user_uuid"))
+	}
+	viewer, err := h.viewerOf(ctx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, postID.String()); err != nil {
+		return nil, err
+	}
+	if err := h.datarepo.RemoveReaction(ctx, postID.String(), userID.String(), req.Kind); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to remove reaction"))
+	}
+	pbPost, err := h.reactedPost(ctx, viewer, postID.String())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RemoveReactionResponse{Post: pbPost}, nil
+}
+
+// ListReactions lists the reactions to a post, newest first, only of a kind when the request says
+func (h *Handler) ListReactions(ctx context.Context, req *pb.ListReactionsRequest) (*pb.ListReactionsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, postID.String()); err != nil {
+		return nil, err
+	}
+	dbReactions, pageInfo, err := h.datarepo.ListReactions(ctx, postID.String(), req.Kind, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list reactions"))
+	}
+	var reactions []*pb.Reaction
+	for _, dbr := range dbReactions {
+		r, err := dbr.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dbreaction"))
+		}
+		reactions = append(reactions, r)
+	}
+	return &pb.ListReactionsResponse{
+		Reactions:     reactions,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// BookmarkPost bookmarks a post for a user, bookmarking a post the user already bookmarked is a no-op
+func (h *Handler) BookmarkPost(ctx context.Context, req *pb.BookmarkPostRequest) (*pb.BookmarkPostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbBookmark, err := HydrateBookmarkModelForCreate(req)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate bookmark for create"))
+	}
+	viewer, err := h.viewerOf(ctx, dbBookmark.UserUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, dbBookmark.PostUUID); err != nil {
+		return nil, err
+	}
+	if err := h.datarepo.CreateBookmark(ctx, dbBookmark); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to bookmark post"))
+	}
+	bookmark, err := dbBookmark.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dbbookmark"))
+	}
+	return &pb.BookmarkPostResponse{Bookmark: bookmark}, nil
+}
 
-	return nil, errors.New("not implemented")
+// UnbookmarkPost removes a user's bookmark of a post, removing a bookmark the user does not have is a no-op
+func (h *Handler) UnbookmarkPost(ctx context.Context, req *pb.UnbookmarkPostRequest) (*pb.UnbookmarkPostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	userID, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("user_uuid"))
+	}
+	if err := h.datarepo.DeleteBookmark(ctx, userID.String(), postID.String()); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to unbookmark post"))
+	}
+	return &pb.UnbookmarkPostResponse{}, nil
+}
+
+// ListBookmarks lists a user's bookmarked posts with their links, most recently bookmarked first,
+// bookmarked posts that have since been deleted are listed as tombstones
+func (h *Handler) ListBookmarks(ctx context.Context, req *pb.ListBookmarksRequest) (*pb.ListBookmarksResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("user_uuid"))
+	}
+	page, err := h.page(req, pageOrderNewest)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := h.viewerOf(ctx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	dbBookmarks, dbPosts, dbLinks, pageInfo, err := h.datarepo.ListBookmarks(ctx, userID.String(), viewer, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list bookmarks"))
+	}
+	var bookmarks []*pb.Bookmark
+	for _, dbb := range dbBookmarks {
+		b, err := dbb.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dbbookmark"))
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	posts, links, err := postsWithLinksToGRPC(dbPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListBookmarksResponse{
+		Bookmarks:     bookmarks,
+		Posts:         posts,
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// reactionKind is whether a kind is one of the configured reaction kinds
+func (h *Handler) reactionKind(kind string) bool {
+	for _, k := range h.config.ReactionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// reactedPost gets a post for the user who reacted to it after a reaction changed so its counts are current
+func (h *Handler) reactedPost(ctx context.Context, viewer *Viewer, postUUID string) (*shared.Post, error) {
+	dbPost, err := h.datarepo.GetPost(ctx, postUUID, viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get reacted post"))
+	}
+	pbPost, err := dbPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform reacted post"))
+	}
+	return pbPost, nil
+}
+
+// ListTrendingTags lists the tags on the most posts created within a window
+func (h *Handler) ListTrendingTags(ctx context.Context, req *pb.ListTrendingTagsRequest) (*pb.ListTrendingTagsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	window := h.config.TrendingTagsWindow
+	if req.WindowSeconds > 0 {
+		window = time.Duration(req.WindowSeconds) * time.Second
+	}
+	limit := keyset.Size(req.Limit, h.config.MaxTrendingTags, h.config.MaxTrendingTags)
+	dbTags, err := h.datarepo.ListTrendingTags(ctx, time.Now().Add(-window).Unix(), limit)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list trending tags"))
+	}
+	var tags []*pb.TrendingTag
+	for _, dbt := range dbTags {
+		tags = append(tags, dbt.ToGRPC())
+	}
+	return &pb.ListTrendingTagsResponse{Tags: tags}, nil
+}
+
+// SearchPosts finds the posts matching a search, along with their links
+func (h *Handler) SearchPosts(ctx context.Context, req *pb.SearchPostsRequest) (*pb.ListUsersPostsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	q := search.ParseQuery(req.Query)
+	if len(req.UserUuid) > 0 {
+		userID, err := uuid.FromBytes(req.UserUuid)
+		if err != nil {
+			return nil, statusError(invalidUUID("user_uuid"))
+		}
+		q.UserUUID = userID.String()
+	}
+	if len(req.SourceUuid) > 0 {
+		sourceID, err := uuid.FromBytes(req.SourceUuid)
+		if err != nil {
+			return nil, statusError(invalidUUID("source_uuid"))
+		}
+		q.SourceUUID = sourceID.String()
+	}
+	if req.Domain != "" {
+		domain, err := canonical.Host(req.Domain)
+		if err != nil {
+			return nil, statusError(&FieldError{Field: "domain", Description: "must be a host name"})
+		}
+		q.Domain = domain
+	}
+	q.CreatedAfter = req.CreatedAfter
+	q.CreatedBefore = req.CreatedBefore
+	if req.OrderBy == pb.SearchPostsRequest_RECENCY {
+		q.Order = search.OrderRecency
+	}
+	offset, err := search.DecodePageToken(req.PageToken)
+	if err != nil {
+		return nil, statusError(&FieldError{Field: "page_token", Description: "is not a search page token"})
+	}
+	pageSize := keyset.Size(req.PageSize, h.config.DefaultPageSize, h.config.MaxPageSize)
+	q.Offset = offset
+	q.Limit = pageSize
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.search.Search(ctx, q)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to search posts"))
+	}
+	dbPosts, err := h.datarepo.GetPostsByUUIDs(ctx, result.PostUUIDs, viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get matching posts"))
+	}
+	var foundPosts []*DBPost
+	var linkIDs []string
+	for _, dbp := range dbPosts {
+		// a post deleted since it was indexed is left out
+		if dbp == nil {
+			continue
+		}
+		foundPosts = append(foundPosts, dbp)
+		linkIDs = append(linkIDs, dbp.LinkUUID)
+	}
+	dbLinks, err := h.datarepo.GetLinksByUUIDs(ctx, linkIDs)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get matching posts links"))
+	}
+	posts, links, err := postsWithLinksToGRPC(foundPosts, dbLinks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &pb.ListUsersPostsResponse{
+		Posts:   posts,
+		Links:   links,
+		HasMore: result.HasMore,
+	}
+	if result.HasMore {
+		resp.NextPageToken = search.EncodePageToken(offset + pageSize)
+	}
+	if offset > 0 {
+		prevOffset := offset - pageSize
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		resp.PrevPageToken = search.EncodePageToken(prevOffset)
+	}
+	return resp, nil
+}
+
+// page orders name the orders lists are sorted in, a page token is only good for a list in the same order
+const (
+	pageOrderNewest     = "newest"
+	pageOrderOldest     = "oldest"
+	pageOrderEngagement = "engagement"
+	pageOrderChecked    = "checked"
+)
+
+// page gets the page a list request asks for of a list sorted in an order
+func (h *Handler) page(req keyset.Request, order string) (*keyset.Page, error) {
+	page, err := keyset.NewPage(req, order, h.config.DefaultPageSize, h.config.MaxPageSize)
+	if errors.Cause(err) == keyset.ErrOrderMismatch {
+		return nil, statusError(&FieldError{Field: "page_token", Description: "is for a list in another order"})
+	}
+	if err != nil {
+		return nil, statusError(&FieldError{Field: "page_token", Description: "is not a page token"})
+	}
+	return page, nil
+}
+
+// viewer looks up who a request is read for, a request without a viewer uuid is read anonymously
+func (h *Handler) viewer(ctx context.Context, rawUUID []byte) (*Viewer, error) {
+	if len(rawUUID) == 0 {
+		return &Viewer{}, nil
+	}
+	viewerID, err := uuid.FromBytes(rawUUID)
+	if err != nil {
+		return nil, statusError(invalidUUID("viewer_uuid"))
+	}
+	return h.viewerOf(ctx, viewerID.String())
+}
+
+// viewerOf looks up what a user can see, without a follow graph users only see the followers only posts they wrote
+func (h *Handler) viewerOf(ctx context.Context, userUUID string) (*Viewer, error) {
+	viewer := &Viewer{UserUUID: userUUID}
+	if h.config.FollowGraph == nil {
+		return viewer, nil
+	}
+	following, _, err := h.config.FollowGraph.Following(ctx, userUUID)
+	if err != nil {
+		return nil, statusError(&UnavailableError{Dependency: "follow graph", Err: err})
+	}
+	if len(following) > h.config.MaxFeedFollows {
+		following = following[:h.config.MaxFeedFollows]
+	}
+	viewer.FollowingUUIDs = following
+	return viewer, nil
+}
+
+// isModerator is whether a user can delete and restore other users' posts
+func (h *Handler) isModerator(userID uuid.UUID) bool {
+	for _, moderatorUUID := range h.config.ModeratorUUIDs {
+		if uuid.FromStringOrNil(moderatorUUID) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// requireVisible checks a post exists and the viewer can see it, deleted posts are seen as their tombstones
+func (h *Handler) requireVisible(ctx context.Context, viewer *Viewer, postUUID string) error {
+	dbPosts, err := h.datarepo.GetAnyPostsByUUIDs(ctx, []string{postUUID}, viewer)
+	if err != nil {
+		return statusError(errors.Wrap(err, "failed to get post"))
+	}
+	if dbPosts[0] == nil {
+		return statusError(aboutResource(ErrPostNotFound, "post", postUUID))
+	}
+	return nil
+}
+
+// uuidsToStrings converts raw uuids to their string form
+func uuidsToStrings(rawUUIDs [][]byte) ([]string, error) {
+	ids := make([]string, len(rawUUIDs))
+	for i, raw := range rawUUIDs {
+		id, err := uuid.FromBytes(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert uuid %d", i)
+		}
+		ids[i] = id.String()
+	}
+	return ids, nil
+}
+
+// onlyFollowed keeps the requested uuids that are followed
+func onlyFollowed(requested []string, followed []string) []string {
+	following := make(map[string]bool, len(followed))
+	for _, f := range followed {
+		following[f] = true
+	}
+	var kept []string
+	for _, r := range requested {
+		if following[r] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// postsWithLinksToGRPC transforms posts and the links they are about, which are in the same order
+func postsWithLinksToGRPC(dbPosts []*DBPost, dbLinks []*DBLink) ([]*shared.Post, []*shared.Link, error) {
+	var posts []*shared.Post
+	var links []*shared.Link
+	for i, dbp := range dbPosts {
+		p, err := dbp.ToGRPC()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to transform dbpost")
+		}
+		l, err := dbLinks[i].ToGRPC()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to transform dblink")
+		}
+		posts = append(posts, p)
+		links = append(links, l)
+	}
+	return posts, links, nil
+}
+
+// embedReposts embeds the posts that reposts repost when the viewer can see them,
+// reposted posts that have since been deleted are embedded as tombstones
+func (h *Handler) embedReposts(ctx context.Context, viewer *Viewer, posts []*shared.Post, dbPosts []*DBPost) error {
+	var repostOfUUIDs []string
+	var reposts []*shared.Post
+	for i, dbp := range dbPosts {
+		if dbp.RepostOfUUID.Valid && !dbp.DeletedAt.Valid {
+			repostOfUUIDs = append(repostOfUUIDs, dbp.RepostOfUUID.String)
+			reposts = append(reposts, posts[i])
+		}
+	}
+	if len(reposts) == 0 {
+		return nil
+	}
+	dbReposted, err := h.datarepo.GetAnyPostsByUUIDs(ctx, repostOfUUIDs, viewer)
+	if err != nil {
+		return errors.Wrap(err, "failed to get reposted posts")
+	}
+	for i, dbp := range dbReposted {
+		if dbp == nil {
+			continue
+		}
+		p, err := dbp.ToGRPC()
+		if err != nil {
+			return errors.Wrap(err, "failed to transform reposted dbpost")
+		}
+		reposts[i].RepostOf = p
+	}
+	return nil
+}
+
+// ListDeadLinks lists the links the health checker found to be dead
+func (h *Handler) ListDeadLinks(ctx context.Context, req *pb.ListDeadLinksRequest) (*pb.ListDeadLinksResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	page, err := h.page(req, pageOrderChecked)
+	if err != nil {
+		return nil, err
+	}
+	dbLinks, pageInfo, err := h.datarepo.ListDeadLinks(ctx, page)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list dead links"))
+	}
+	var links []*shared.Link
+	for _, dbl := range dbLinks {
+		l, err := dbl.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
+		}
+		links = append(links, l)
+	}
+	return &pb.ListDeadLinksResponse{
+		Links:         links,
+		NextPageToken: pageInfo.NextToken,
+		PrevPageToken: pageInfo.PrevToken,
+		HasMore:       pageInfo.HasMore,
+	}, nil
+}
+
+// CreateLink is the handler for creating posts
+func (h *Handler) CreateLink(ctx context.Context, req *pb.CreateLinkRequest) (*pb.CreateLinkResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbLink, err := HydrateLinkModelForCreate(req)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate link for create"))
+	}
+	h.resolveLink(ctx, dbLink)
+	if err := h.datarepo.CreateLink(ctx, dbLink); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to create link"))
+	}
+	// the link may have been merged into an existing link with the same canonical url
+	createdLink, err := h.datarepo.GetLinkByUUID(ctx, dbLink.UUID)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get created link"))
+	}
+	hydratedPBLink, err := createdLink.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
+	}
+	if createdLink.Metadata == nil {
+		h.unfurlInBackground(createdLink.UUID, createdLink.URL)
+	}
+	return &pb.CreateLinkResponse{
+		Link: hydratedPBLink,
+	}, nil
+}
+
+// CreatePost is the handler for creating posts
+func (h *Handler) CreatePost(ctx context.Context, req *pb.CreatePostRequest) (*pb.CreatePostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbPost, err := HydratePostModelForCreate(req)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate post for create"))
+	}
+	if err := h.resolveMentions(ctx, dbPost); err != nil {
+		return nil, err
+	}
+	if dbPost.ParentPostUUID.Valid {
+		viewer, err := h.viewerOf(ctx, dbPost.UserUUID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := h.datarepo.GetPost(ctx, dbPost.ParentPostUUID.String, viewer); err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, statusError(aboutResource(ErrParentPostNotFound, "post", dbPost.ParentPostUUID.String))
+			}
+			return nil, statusError(errors.Wrap(err, "failed to get parent post"))
+		}
+	}
+	if err := h.datarepo.CreatePost(ctx, dbPost); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to create post"))
+	}
+	h.indexPost(ctx, dbPost.UUID)
+	h.notifyMentions(ctx, dbPost, nil)
+	hydratedPBPost, err := dbPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
+	}
+	return &pb.CreatePostResponse{
+		Post: hydratedPBPost,
+	}, nil
+}
+
+// CreatePostWithLink creates a post along with the link it is about in one transaction, the link is merged into an
+// existing link with the same canonical url, so no link is left behind when the post cannot be created
+func (h *Handler) CreatePostWithLink(ctx context.Context, req *pb.CreatePostWithLinkRequest) (*pb.CreatePostWithLinkResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbLink, err := HydrateLinkModelForCreate(&pb.CreateLinkRequest{
+		Url:             req.Url,
+		SourceHeadUuids: req.SourceHeadUuids,
+	})
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate link for create"))
+	}
+	h.resolveLink(ctx, dbLink)
+	// the post is pointed at whichever link the repository finds or creates
+	dbPost, err := HydratePostModelForCreate(&pb.CreatePostRequest{
+		UserUuid:   req.UserUuid,
+		LinkUuid:   uuid.FromStringOrNil(dbLink.UUID).Bytes(),
+		Title:      req.Title,
+		Comment:    req.Comment,
+		Visibility: req.Visibility,
+		Draft:      req.Draft,
+	})
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate post for create"))
+	}
+	if err := h.resolveMentions(ctx, dbPost); err != nil {
+		return nil, err
+	}
+	if err := h.datarepo.CreatePostWithLink(ctx, dbLink, dbPost); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to create post with link"))
+	}
+	h.indexPost(ctx, dbPost.UUID)
+	h.notifyMentions(ctx, dbPost, nil)
+	createdLink, err := h.datarepo.GetLinkByUUID(ctx, dbLink.UUID)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get created link"))
+	}
+	if createdLink.Metadata == nil {
+		h.unfurlInBackground(createdLink.UUID, createdLink.URL)
+	}
+	hydratedPBPost, err := dbPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dbpost"))
+	}
+	hydratedPBLink, err := createdLink.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform dblink"))
+	}
+	return &pb.CreatePostWithLinkResponse{
+		Post: hydratedPBPost,
+		Link: hydratedPBLink,
+	}, nil
+}
+
+// UpdatePost edits the title and comment of a post, keeping its prior version as a revision
+func (h *Handler) UpdatePost(ctx context.Context, req *pb.UpdatePostRequest) (*pb.UpdatePostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	dbPost, err := HydratePostModelForUpdate(req)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to hydrate post for update"))
+	}
+	viewer, err := h.viewerOf(ctx, dbPost.UpdatedByUUID.String)
+	if err != nil {
+		return nil, err
+	}
+	// the prior post says which fields the update must keep and who is newly mentioned,
+	// anyone but its author is left for the repository to deny rather than told what they got wrong
+	priorPost, err := h.datarepo.GetPost(ctx, dbPost.UUID, viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get post to update"))
+	}
+	if priorPost.UserUUID == dbPost.UpdatedByUUID.String {
+		if err := h.validateUpdate(priorPost, req); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.resolveMentions(ctx, dbPost); err != nil {
+		return nil, err
+	}
+	if err := h.datarepo.UpdatePost(ctx, dbPost); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to update post"))
+	}
+	updatedPost, err := h.datarepo.GetPost(ctx, dbPost.UUID, viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get updated post"))
+	}
+	h.indexPost(ctx, updatedPost.UUID)
+	h.notifyMentions(ctx, updatedPost, priorPost.Mentions)
+	pbPost, err := updatedPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform updated post"))
+	}
+	return &pb.UpdatePostResponse{Post: pbPost}, nil
+}
+
+// ListPostRevisions lists the prior versions of a post, newest first
+func (h *Handler) ListPostRevisions(ctx context.Context, req *pb.ListPostRevisionsRequest) (*pb.ListPostRevisionsResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	viewer, err := h.viewer(ctx, req.ViewerUuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.requireVisible(ctx, viewer, postID.String()); err != nil {
+		return nil, err
+	}
+	dbRevisions, err := h.datarepo.ListPostRevisions(ctx, postID.String())
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to list post revisions"))
+	}
+	var revisions []*pb.PostRevision
+	for _, dbr := range dbRevisions {
+		r, err := dbr.ToGRPC()
+		if err != nil {
+			return nil, statusError(errors.Wrap(err, "failed to transform dbrevision"))
+		}
+		revisions = append(revisions, r)
+	}
+	return &pb.ListPostRevisionsResponse{Revisions: revisions}, nil
+}
+
+// DeletePost soft deletes a post, it can be restored until the restore grace period passes
+func (h *Handler) DeletePost(ctx context.Context, req *pb.DeletePostRequest) (*pb.DeletePostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	deletedByID, err := uuid.FromBytes(req.DeletedByUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("deleted_by_uuid"))
+	}
+	if err := h.datarepo.DeletePost(ctx, postID.String(), deletedByID.String(), h.isModerator(deletedByID), req.ExpectedVersion); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to delete post"))
+	}
+	if err := h.search.Remove(ctx, postID.String()); err != nil {
+		log.Printf("Failed to remove post %s from search: %+v\n", postID.String(), err)
+	}
+	return &pb.DeletePostResponse{}, nil
+}
+
+// RestorePost restores a deleted post within the restore grace period
+func (h *Handler) RestorePost(ctx context.Context, req *pb.RestorePostRequest) (*pb.RestorePostResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	restoredByID, err := uuid.FromBytes(req.RestoredByUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("restored_by_uuid"))
+	}
+	deletedSince := time.Now().Add(-h.config.RestoreGracePeriod).Unix()
+	if err := h.datarepo.RestorePost(ctx, postID.String(), restoredByID.String(), h.isModerator(restoredByID), deletedSince); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to restore post"))
+	}
+	viewer, err := h.viewerOf(ctx, restoredByID.String())
+	if err != nil {
+		return nil, err
+	}
+	dbPost, err := h.datarepo.GetPost(ctx, postID.String(), viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get restored post"))
+	}
+	h.indexPost(ctx, dbPost.UUID)
+	pbPost, err := dbPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform restored post"))
+	}
+	return &pb.RestorePostResponse{Post: pbPost}, nil
+}
+
+// PublishDraft publishes a draft post so it can be seen as its visibility allows
+func (h *Handler) PublishDraft(ctx context.Context, req *pb.PublishDraftRequest) (*pb.PublishDraftResponse, error) {
+	if err := h.validate(req); err != nil {
+		return nil, err
+	}
+	postID, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("post_uuid"))
+	}
+	publishedByID, err := uuid.FromBytes(req.PublishedByUuid)
+	if err != nil {
+		return nil, statusError(invalidUUID("published_by_uuid"))
+	}
+	if err := h.datarepo.PublishDraft(ctx, postID.String(), publishedByID.String(), req.ExpectedVersion); err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to publish draft"))
+	}
+	viewer, err := h.viewerOf(ctx, publishedByID.String())
+	if err != nil {
+		return nil, err
+	}
+	dbPost, err := h.datarepo.GetPost(ctx, postID.String(), viewer)
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to get published post"))
+	}
+	h.indexPost(ctx, dbPost.UUID)
+	h.notifyMentions(ctx, dbPost, nil)
+	pbPost, err := dbPost.ToGRPC()
+	if err != nil {
+		return nil, statusError(errors.Wrap(err, "failed to transform published post"))
+	}
+	return &pb.PublishDraftResponse{Post: pbPost}, nil
+}
+
+// resolveMentions finds the users mentioned in a post's comment
+func (h *Handler) resolveMentions(ctx context.Context, post *DBPost) error {
+	mentions := mention.Extract(post.Comment)
+	var usernames []string
+	for _, m := range mentions {
+		if m.Username != "" {
+			usernames = append(usernames, m.Username)
+		}
+	}
+	resolved := map[string]string{}
+	if len(usernames) > 0 && h.config.UserResolver != nil {
+		var err error
+		resolved, err = h.config.UserResolver.ResolveUsernames(ctx, usernames)
+		if err != nil {
+			return statusError(&UnavailableError{Dependency: "user resolver", Err: err})
+		}
+	}
+	post.Mentions = HydratePostMentions(mentions, resolved)
+	return nil
+}
+
+// notifyMentions tells the notifier about the users mentioned in a post that were not in its prior mentions,
+// a failure to notify is logged since the post is already saved
+func (h *Handler) notifyMentions(ctx context.Context, post *DBPost, priorMentions []*DBPostMention) {
+	// the users mentioned in a draft are notified when it is published
+	if h.config.Notifier == nil || post.Draft {
+		return
+	}
+	notified := map[string]bool{post.UserUUID: true}
+	for _, m := range priorMentions {
+		notified[m.UserUUID] = true
+	}
+	event := &MentionEvent{
+		PostUUID:    post.UUID,
+		AuthorUUID:  post.UserUUID,
+		MentionedAt: time.Now().Unix(),
+	}
+	for _, m := range post.Mentions {
+		if notified[m.UserUUID] {
+			continue
+		}
+		notified[m.UserUUID] = true
+		event.MentionedUserUUIDs = append(event.MentionedUserUUIDs, m.UserUUID)
+	}
+	if len(event.MentionedUserUUIDs) == 0 {
+		return
+	}
+	if err := h.config.Notifier.NotifyMentions(ctx, event); err != nil {
+		log.Printf("Failed to notify mentions in post %s: %+v\n", post.UUID, err)
+	}
+}
+
+// indexPost indexes a post for search along with its link, an index that searches the stored posts needs nothing indexed;
+// a post that fails to index is logged and left out of search until it is next indexed
+func (h *Handler) indexPost(ctx context.Context, postUUID string) {
+	if _, ok := h.search.(storedSearchIndex); ok {
+		return
+	}
+	dbPost, err := h.datarepo.GetPost(ctx, postUUID, nil)
+	if err != nil {
+		log.Printf("Failed to get post %s to index: %+v\n", postUUID, err)
+		return
+	}
+	// only public posts are searchable, drafts are indexed when they are published
+	if dbPost.Draft || dbPost.Visibility != VisibilityPublic {
+		return
+	}
+	dbLink, err := h.datarepo.GetLinkByUUID(ctx, dbPost.LinkUUID)
+	if err != nil {
+		log.Printf("Failed to get link %s to index: %+v\n", dbPost.LinkUUID, err)
+		return
+	}
+	doc := &search.Document{
+		PostUUID:    dbPost.UUID,
+		UserUUID:    dbPost.UserUUID,
+		SourceUUIDs: dbLink.SourceHeadUUIDs,
+		CreatedAt:   dbPost.CreatedAt,
+		Title:       dbPost.Title,
+		Comment:     dbPost.Comment,
+	}
+	if u, err := url.Parse(dbLink.CanonicalURL); err == nil {
+		doc.Domain = u.Host
+	}
+	if dbLink.Metadata != nil {
+		doc.LinkTitle = dbLink.Metadata.Title
+		doc.LinkDescription = dbLink.Metadata.Description
+	}
+	if err := h.search.Index(ctx, doc); err != nil {
+		log.Printf("Failed to index post %s: %+v\n", postUUID, err)
+	}
+}
+
+// rebuildBatchSize is how many posts are read at a time while rebuilding the search index
+const rebuildBatchSize = 500
+
+// RebuildSearchIndex indexes every searchable post in storage, since an in-memory index is empty when the service
+// starts; it does nothing for other indexes or for a data repository that cannot list its posts
+func (h *Handler) RebuildSearchIndex(ctx context.Context) error {
+	if _, ok := h.search.(*search.MemoryIndex); !ok {
+		return nil
+	}
+	lister, ok := h.datarepo.(SearchablePostLister)
+	if !ok {
+		return nil
+	}
+	var indexed int
+	after := keyset.Key{Value: -1}
+	for {
+		keys, err := lister.ListSearchablePosts(ctx, after, rebuildBatchSize)
+		if err != nil {
+			return errors.Wrapf(err, "failed after indexing %d posts", indexed)
+		}
+		for _, key := range keys {
+			h.indexPost(ctx, key.UUID)
+		}
+		indexed += len(keys)
+		if len(keys) < rebuildBatchSize {
+			log.Printf("Rebuilt search index of %d posts\n", indexed)
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// resolveLink follows a new link's redirects to find the url it finally points at,
+// a link that cannot be resolved is kept as pointing at itself
+func (h *Handler) resolveLink(ctx context.Context, link *DBLink) {
+	ctx, cancel := context.WithTimeout(ctx, h.config.RedirectTimeout)
+	defer cancel()
+	chain, err := h.resolver.Resolve(ctx, link.URL)
+	if err != nil {
+		log.Printf("Failed to resolve link %s: %+v\n", link.URL, err)
+		return
+	}
+	resolvedURL, err := canonical.URL(chain.Final())
+	if err != nil {
+		log.Printf("Failed to canonicalize resolved url %s: %+v\n", chain.Final(), err)
+		return
+	}
+	link.ResolvedURL = resolvedURL
+}
+
+// unfurlInBackground unfurls a link in the background after it is created, unless unfurls were stopped
+func (h *Handler) unfurlInBackground(linkUUID string, url string) {
+	h.unfurlsMu.Lock()
+	defer h.unfurlsMu.Unlock()
+	if h.unfurlsStopped {
+		return
+	}
+	h.unfurls.Add(1)
+	go func() {
+		defer h.unfurls.Done()
+		h.unfurlLink(linkUUID, url)
+	}()
+}
+
+// StopUnfurls stops unfurling the links created from now on and waits for the running unfurls to finish,
+// which each take at most twice the unfurl timeout; it is called on shutdown before the database is closed
+func (h *Handler) StopUnfurls() error {
+	h.unfurlsMu.Lock()
+	h.unfurlsStopped = true
+	h.unfurlsMu.Unlock()
+	h.unfurls.Wait()
+	return nil
+}
+
+// unfurlLink fetches a link's page and stores its metadata, fetching and storing are each bounded by the unfurl timeout
+func (h *Handler) unfurlLink(linkUUID string, url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.UnfurlTimeout)
+	defer cancel()
+	meta, err := h.unfurler.Unfurl(ctx, url)
+	if err != nil {
+		log.Printf("Failed to unfurl link %s: %+v\n", linkUUID, err)
+		return
+	}
+	dbMeta := NewDBLinkMetadata(linkUUID, meta, time.Now().Unix())
+	storeCtx, cancelStore := context.WithTimeout(context.Background(), h.config.UnfurlTimeout)
+	defer cancelStore()
+	if err := h.datarepo.UpsertLinkMetadata(storeCtx, dbMeta); err != nil {
+		log.Printf("Failed to store metadata for link %s: %+v\n", linkUUID, err)
+	}
 }
@@ -1 +1,552 @@
 package service_test
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/service"
+	pb "github.com/srcabl/protos/posts"
+	"github.com/srcabl/services/pkg/db/mysql"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingRepository fails to get posts with an error describing the post, as a database driver might
+type failingRepository struct {
+	service.DataRepository
+}
+
+func (r *failingRepository) GetPost(ctx context.Context, uuid string, viewer *service.Viewer) (*service.DBPost, error) {
+	return nil, errors.Errorf("failed to scan row &{UUID:%s Title:secret title}", uuid)
+}
+
+// erroringRepository fails to get posts with a database error
+type erroringRepository struct {
+	service.DataRepository
+	err error
+}
+
+func (r *erroringRepository) GetPost(ctx context.Context, uuid string, viewer *service.Viewer) (*service.DBPost, error) {
+	return nil, errors.Wrapf(r.err, "failed to get post %s", uuid)
+}
+
+func newHandler(t *testing.T, repo service.DataRepository) *service.Handler {
+	t.Helper()
+	h, err := service.New(repo, nil)
+	if err != nil {
+		t.Fatalf("failed to new up handler: %+v", err)
+	}
+	return h
+}
+
+func uuidBytes(id string) []byte {
+	return uuid.FromStringOrNil(id).Bytes()
+}
+
+// wantStatus checks an error is a status with the code, returning its details
+func wantStatus(t *testing.T, err error, code codes.Code) []interface{} {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("error %v is not a status", err)
+	}
+	if st.Code() != code {
+		t.Fatalf("status code = %s (%s), want %s", st.Code(), st.Message(), code)
+	}
+	return st.Details()
+}
+
+// wantResourceInfo checks the details of a status name the resource
+func wantResourceInfo(t *testing.T, details []interface{}, resourceType string, resourceName string) {
+	t.Helper()
+	for _, d := range details {
+		if info, ok := d.(*errdetails.ResourceInfo); ok {
+			if info.ResourceType != resourceType || info.ResourceName != resourceName {
+				t.Errorf("resource info = %s %s, want %s %s", info.ResourceType, info.ResourceName, resourceType, resourceName)
+			}
+			return
+		}
+	}
+	t.Errorf("details %v have no resource info", details)
+}
+
+func TestHandlerErrorStatuses(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	h := newHandler(t, repo)
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author := newUUID(t)
+	post := f.post(author, f.link("https://example.com/statuses"), nil)
+
+	t.Run("missing post is not found", func(t *testing.T) {
+		missing := newUUID(t)
+		_, err := h.GetPost(ctx, &pb.GetPostRequest{PostUuid: uuidBytes(missing)})
+		wantResourceInfo(t, wantStatus(t, err, codes.NotFound), "post", missing)
+	})
+
+	t.Run("missing link is not found", func(t *testing.T) {
+		missing := newUUID(t)
+		_, err := h.GetLink(ctx, &pb.GetLinkRequest{GetBy: pb.GetLinkRequest_UUID, LinkUuid: uuidBytes(missing)})
+		wantResourceInfo(t, wantStatus(t, err, codes.NotFound), "link", missing)
+	})
+
+	t.Run("malformed uuid is a field violation", func(t *testing.T) {
+		_, err := h.GetPost(ctx, &pb.GetPostRequest{PostUuid: []byte("short")})
+		details := wantStatus(t, err, codes.InvalidArgument)
+		if len(details) != 1 {
+			t.Fatalf("details = %v, want a bad request", details)
+		}
+		badRequest, ok := details[0].(*errdetails.BadRequest)
+		if !ok || len(badRequest.FieldViolations) != 1 || badRequest.FieldViolations[0].Field != "post_uuid" {
+			t.Errorf("details = %v, want a violation of post_uuid", details)
+		}
+	})
+
+	t.Run("stale version is aborted", func(t *testing.T) {
+		_, err := h.UpdatePost(ctx, &pb.UpdatePostRequest{
+			PostUuid:        uuidBytes(post.UUID),
+			UpdatedByUuid:   uuidBytes(author),
+			Title:           "edited",
+			ExpectedVersion: post.Version + 1,
+		})
+		wantResourceInfo(t, wantStatus(t, err, codes.Aborted), "post", post.UUID)
+	})
+
+	t.Run("publishing a published post is a failed precondition", func(t *testing.T) {
+		_, err := h.PublishDraft(ctx, &pb.PublishDraftRequest{PostUuid: uuidBytes(post.UUID), PublishedByUuid: uuidBytes(author)})
+		wantStatus(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("editing another user's post is permission denied", func(t *testing.T) {
+		_, err := h.UpdatePost(ctx, &pb.UpdatePostRequest{
+			PostUuid:      uuidBytes(post.UUID),
+			UpdatedByUuid: uuidBytes(newUUID(t)),
+			Title:         "edited",
+		})
+		wantResourceInfo(t, wantStatus(t, err, codes.PermissionDenied), "post", post.UUID)
+	})
+
+	t.Run("a page token for another order is a field violation", func(t *testing.T) {
+		link := f.link("https://example.com/ordered")
+		f.post(author, link, nil)
+		f.post(author, link, nil)
+		req := &pb.ListPostsForLinkRequest{LinkUuid: uuidBytes(link.UUID), PageSize: 1}
+		res, err := h.ListPostsForLink(ctx, req)
+		if err != nil {
+			t.Fatalf("failed to list links posts: %+v", err)
+		}
+		req.PageToken, req.SortBy = res.NextPageToken, pb.ListPostsForLinkRequest_ENGAGEMENT
+		_, err = h.ListPostsForLink(ctx, req)
+		wantViolations(t, err, "page_token")
+	})
+
+	t.Run("reposting twice already exists", func(t *testing.T) {
+		reposter := newUUID(t)
+		req := &pb.CreatePostRequest{UserUuid: uuidBytes(reposter), RepostOfUuid: uuidBytes(post.UUID)}
+		if _, err := h.CreatePost(ctx, req); err != nil {
+			t.Fatalf("failed to repost: %+v", err)
+		}
+		_, err := h.CreatePost(ctx, req)
+		wantResourceInfo(t, wantStatus(t, err, codes.AlreadyExists), "post", post.UUID)
+	})
+
+	databaseErrors := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"mysql duplicate entry", errors.New("Error 1062 (23000): Duplicate entry 'x' for key 'canonical_url_hash'"), codes.AlreadyExists},
+		{"sqlite unique constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, codes.AlreadyExists},
+		{"mysql invalid connection", errors.New("invalid connection"), codes.Unavailable},
+		{"mysql too many connections", errors.New("Error 1040: Too many connections"), codes.Unavailable},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, codes.Unavailable},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, codes.Unavailable},
+		{"mysql syntax", errors.New("Error 1064 (42000): You have an error in your SQL syntax"), codes.Internal},
+	}
+	for _, tt := range databaseErrors {
+		t.Run(tt.name+" is "+tt.want.String(), func(t *testing.T) {
+			h := newHandler(t, &erroringRepository{DataRepository: repo, err: tt.err})
+			_, err := h.GetPost(ctx, &pb.GetPostRequest{PostUuid: uuidBytes(post.UUID)})
+			wantStatus(t, err, tt.want)
+		})
+	}
+
+	t.Run("internal errors do not reach clients", func(t *testing.T) {
+		h := newHandler(t, &failingRepository{DataRepository: repo})
+		_, err := h.GetPost(ctx, &pb.GetPostRequest{PostUuid: uuidBytes(post.UUID)})
+		wantStatus(t, err, codes.Internal)
+		if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), post.UUID) {
+			t.Errorf("internal error %q leaks its cause", err.Error())
+		}
+	})
+}
+
+// wantViolations checks the details of a status are a bad request violating exactly the fields
+func wantViolations(t *testing.T, err error, fields ...string) {
+	t.Helper()
+	details := wantStatus(t, err, codes.InvalidArgument)
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want a bad request", details)
+	}
+	badRequest, ok := details[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("details = %v, want a bad request", details)
+	}
+	var got []string
+	for _, v := range badRequest.FieldViolations {
+		got = append(got, v.Field)
+	}
+	if strings.Join(got, ",") != strings.Join(fields, ",") {
+		t.Errorf("violated fields = %v, want %v", got, fields)
+	}
+}
+
+func TestHandlerValidation(t *testing.T) {
+	ctx := context.Background()
+	cfg := service.DefaultConfig()
+	cfg.MaxSourceHeads = 2
+	h, err := service.New(service.NewMemoryDataRepository(), cfg)
+	if err != nil {
+		t.Fatalf("failed to new up handler: %+v", err)
+	}
+	user := uuidBytes(newUUID(t))
+
+	t.Run("every invalid field of a post is returned at once", func(t *testing.T) {
+		_, err := h.CreatePost(ctx, &pb.CreatePostRequest{
+			UserUuid: user,
+			LinkUuid: []byte("short"),
+			Comment:  strings.Repeat("c", cfg.MaxCommentLength+1),
+		})
+		wantViolations(t, err, "link_uuid", "title", "comment")
+	})
+
+	t.Run("titles are at most the max title length", func(t *testing.T) {
+		_, err := h.CreatePost(ctx, &pb.CreatePostRequest{
+			UserUuid: user,
+			LinkUuid: uuidBytes(newUUID(t)),
+			Title:    strings.Repeat("é", cfg.MaxTitleLength+1),
+		})
+		wantViolations(t, err, "title")
+	})
+
+	t.Run("a reply needs a title or a comment", func(t *testing.T) {
+		_, err := h.CreatePost(ctx, &pb.CreatePostRequest{UserUuid: user, ParentPostUuid: uuidBytes(newUUID(t))})
+		wantViolations(t, err, "comment")
+	})
+
+	t.Run("links only have the allowed schemes", func(t *testing.T) {
+		_, err := h.CreateLink(ctx, &pb.CreateLinkRequest{Url: "javascript:alert(1)"})
+		wantViolations(t, err, "url")
+	})
+
+	t.Run("links are at most the max url length and source heads", func(t *testing.T) {
+		_, err := h.CreateLink(ctx, &pb.CreateLinkRequest{
+			Url:             "https://example.com/" + strings.Repeat("a", cfg.MaxURLLength),
+			SourceHeadUuids: [][]byte{uuidBytes(newUUID(t)), uuidBytes(newUUID(t)), uuidBytes(newUUID(t))},
+		})
+		wantViolations(t, err, "url", "source_head_uuids")
+	})
+
+	t.Run("a post with a link needs a url and a title", func(t *testing.T) {
+		_, err := h.CreatePostWithLink(ctx, &pb.CreatePostWithLinkRequest{UserUuid: user, Comment: "comment"})
+		wantViolations(t, err, "url", "title")
+	})
+
+	t.Run("batch items are uuids", func(t *testing.T) {
+		_, err := h.BatchGetPosts(ctx, &pb.BatchGetPostsRequest{PostUuids: [][]byte{uuidBytes(newUUID(t)), []byte("short")}})
+		wantViolations(t, err, "post_uuids[1]")
+	})
+
+	t.Run("reaction kinds are configured", func(t *testing.T) {
+		_, err := h.AddReaction(ctx, &pb.AddReactionRequest{PostUuid: uuidBytes(newUUID(t)), UserUuid: user, Kind: "shrug"})
+		wantViolations(t, err, "kind")
+	})
+}
+
+func TestHandlerUpdateValidation(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	h := newHandler(t, repo)
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author := newUUID(t)
+	post := f.post(author, f.link("https://example.com/update-validation"), nil)
+	quote := f.post(author, nil, func(p *service.DBPost) {
+		p.RepostOfUUID = sql.NullString{Valid: true, String: post.UUID}
+	})
+
+	t.Run("a post keeps its title", func(t *testing.T) {
+		_, err := h.UpdatePost(ctx, &pb.UpdatePostRequest{PostUuid: uuidBytes(post.UUID), UpdatedByUuid: uuidBytes(author), Comment: "edited"})
+		wantViolations(t, err, "title")
+	})
+
+	t.Run("a quote post cannot be blanked into a plain repost", func(t *testing.T) {
+		_, err := h.UpdatePost(ctx, &pb.UpdatePostRequest{PostUuid: uuidBytes(quote.UUID), UpdatedByUuid: uuidBytes(author)})
+		wantViolations(t, err, "comment")
+	})
+
+	t.Run("a quote post can drop its title for a comment", func(t *testing.T) {
+		_, err := h.UpdatePost(ctx, &pb.UpdatePostRequest{PostUuid: uuidBytes(quote.UUID), UpdatedByUuid: uuidBytes(author), Comment: "edited"})
+		if err != nil {
+			t.Errorf("failed to update quote post: %+v", err)
+		}
+	})
+}
+
+// followGraph is a follow graph of who each user follows
+type followGraph map[string][]string
+
+func (g followGraph) Following(ctx context.Context, userUUID string) ([]string, []string, error) {
+	return g[userUUID], nil, nil
+}
+
+func TestHandlerHomeFeed(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author, follower, stranger := newUUID(t), newUUID(t), newUUID(t)
+	link := f.link("https://example.com/feed")
+	public := f.post(author, link, nil)
+	followersOnly := f.post(author, f.link("https://example.com/followers"), func(p *service.DBPost) {
+		p.Visibility = service.VisibilityFollowers
+	})
+	cfg := service.DefaultConfig()
+	cfg.FollowGraph = followGraph{follower: {author}}
+	h, err := service.New(repo, cfg)
+	if err != nil {
+		t.Fatalf("failed to new up handler: %+v", err)
+	}
+	feed := func(t *testing.T, user string, requested ...string) []string {
+		t.Helper()
+		req := &pb.ListHomeFeedRequest{UserUuid: uuidBytes(user)}
+		for _, r := range requested {
+			req.FollowedUserUuids = append(req.FollowedUserUuids, uuidBytes(r))
+		}
+		res, err := h.ListHomeFeed(ctx, req)
+		if err != nil {
+			t.Fatalf("failed to list home feed: %+v", err)
+		}
+		var got []string
+		for _, p := range res.Posts {
+			got = append(got, uuid.FromBytesOrNil(p.Uuid).String())
+		}
+		return got
+	}
+
+	t.Run("followers see followers only posts", func(t *testing.T) {
+		wantUUIDs(t, "feed", feed(t, follower), followersOnly.UUID, public.UUID)
+	})
+
+	t.Run("requested follows do not add to the follow graph", func(t *testing.T) {
+		wantUUIDs(t, "feed", feed(t, stranger, author))
+	})
+
+	t.Run("requested follows narrow the feed", func(t *testing.T) {
+		wantUUIDs(t, "feed", feed(t, follower, stranger))
+	})
+
+	t.Run("without a follow graph the requested follows are the feed", func(t *testing.T) {
+		res, err := newHandler(t, repo).ListHomeFeed(ctx, &pb.ListHomeFeedRequest{
+			UserUuid:          uuidBytes(stranger),
+			FollowedUserUuids: [][]byte{uuidBytes(author)},
+		})
+		if err != nil {
+			t.Fatalf("failed to list home feed: %+v", err)
+		}
+		var got []string
+		for _, p := range res.Posts {
+			got = append(got, uuid.FromBytesOrNil(p.Uuid).String())
+		}
+		wantUUIDs(t, "feed", got, public.UUID)
+	})
+
+	t.Run("follows over the max are left out of the feed", func(t *testing.T) {
+		cfg := service.DefaultConfig()
+		cfg.MaxFeedFollows = 1
+		cfg.FollowGraph = followGraph{follower: {author, stranger}}
+		h, err := service.New(repo, cfg)
+		if err != nil {
+			t.Fatalf("failed to new up handler: %+v", err)
+		}
+		res, err := h.ListHomeFeed(ctx, &pb.ListHomeFeedRequest{UserUuid: uuidBytes(follower)})
+		if err != nil {
+			t.Fatalf("failed to list home feed: %+v", err)
+		}
+		if len(res.Posts) != 2 {
+			t.Errorf("feed of the first follow has %d posts, want 2", len(res.Posts))
+		}
+	})
+}
+
+func TestHandlerHidesPostsFromActors(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	h := newHandler(t, repo)
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author, stranger := newUUID(t), newUUID(t)
+	private := f.post(author, f.link("https://example.com/private"), func(p *service.DBPost) {
+		p.Visibility = service.VisibilityPrivate
+	})
+
+	t.Run("removing a reaction to a post the user cannot see is not found", func(t *testing.T) {
+		_, err := h.RemoveReaction(ctx, &pb.RemoveReactionRequest{PostUuid: uuidBytes(private.UUID), UserUuid: uuidBytes(stranger), Kind: "like"})
+		wantResourceInfo(t, wantStatus(t, err, codes.NotFound), "post", private.UUID)
+	})
+
+	t.Run("the author still sees their reacted post", func(t *testing.T) {
+		res, err := h.RemoveReaction(ctx, &pb.RemoveReactionRequest{PostUuid: uuidBytes(private.UUID), UserUuid: uuidBytes(author), Kind: "like"})
+		if err != nil {
+			t.Fatalf("failed to remove reaction: %+v", err)
+		}
+		if got := uuid.FromBytesOrNil(res.Post.Uuid).String(); got != private.UUID {
+			t.Errorf("reacted post = %s, want %s", got, private.UUID)
+		}
+	})
+}
+
+func TestHandlerModeratesPosts(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author, moderator, stranger := newUUID(t), newUUID(t), newUUID(t)
+	post := f.post(author, f.link("https://example.com/moderated"), nil)
+	cfg := service.DefaultConfig()
+	cfg.ModeratorUUIDs = []string{strings.ToUpper(moderator)}
+	h, err := service.New(repo, cfg)
+	if err != nil {
+		t.Fatalf("failed to new up handler: %+v", err)
+	}
+
+	t.Run("a stranger cannot delete the post", func(t *testing.T) {
+		_, err := h.DeletePost(ctx, &pb.DeletePostRequest{PostUuid: uuidBytes(post.UUID), DeletedByUuid: uuidBytes(stranger)})
+		wantResourceInfo(t, wantStatus(t, err, codes.PermissionDenied), "post", post.UUID)
+	})
+
+	t.Run("a moderator removes the post and its author cannot restore it", func(t *testing.T) {
+		if _, err := h.DeletePost(ctx, &pb.DeletePostRequest{PostUuid: uuidBytes(post.UUID), DeletedByUuid: uuidBytes(moderator)}); err != nil {
+			t.Fatalf("failed to remove post: %+v", err)
+		}
+		_, err := h.RestorePost(ctx, &pb.RestorePostRequest{PostUuid: uuidBytes(post.UUID), RestoredByUuid: uuidBytes(author)})
+		wantResourceInfo(t, wantStatus(t, err, codes.PermissionDenied), "post", post.UUID)
+	})
+
+	t.Run("a moderator restores the post", func(t *testing.T) {
+		if _, err := h.RestorePost(ctx, &pb.RestorePostRequest{PostUuid: uuidBytes(post.UUID), RestoredByUuid: uuidBytes(moderator)}); err != nil {
+			t.Fatalf("failed to restore post: %+v", err)
+		}
+	})
+}
+
+func TestHandlerBatchGetEmbedsReposts(t *testing.T) {
+	ctx := context.Background()
+	repo := service.NewMemoryDataRepository()
+	h := newHandler(t, repo)
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	author, reposter := newUUID(t), newUUID(t)
+	original := f.post(author, f.link("https://example.com/batch"), nil)
+	repost := f.post(reposter, nil, func(p *service.DBPost) {
+		p.Title, p.Comment = "", ""
+		p.RepostOfUUID = sql.NullString{Valid: true, String: original.UUID}
+	})
+	res, err := h.BatchGetPosts(ctx, &pb.BatchGetPostsRequest{PostUuids: [][]byte{uuidBytes(newUUID(t)), uuidBytes(repost.UUID)}})
+	if err != nil {
+		t.Fatalf("failed to batch get posts: %+v", err)
+	}
+	if len(res.Results) != 2 || !res.Results[0].NotFound || res.Results[1].Post == nil {
+		t.Fatalf("results = %+v, want a missing post then the repost", res.Results)
+	}
+	if embedded := res.Results[1].Post.RepostOf; embedded == nil || uuid.FromBytesOrNil(embedded.Uuid).String() != original.UUID {
+		t.Errorf("embedded repost = %+v, want %s", embedded, original.UUID)
+	}
+}
+
+func TestHandlerRebuildsSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepository(t)
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	link := f.link("https://example.com/rebuilt")
+	author := newUUID(t)
+	public := f.post(author, link, nil)
+	f.post(author, link, func(p *service.DBPost) { p.Visibility = service.VisibilityPrivate })
+	f.post(author, link, func(p *service.DBPost) { p.Draft = true })
+	deleted := f.post(author, link, nil)
+	if err := repo.DeletePost(ctx, deleted.UUID, author, false, 0); err != nil {
+		t.Fatalf("failed to delete post: %+v", err)
+	}
+
+	// a new handler searches an empty in-memory index, as it does after a restart
+	h := newHandler(t, repo)
+	if err := h.RebuildSearchIndex(ctx); err != nil {
+		t.Fatalf("failed to rebuild search index: %+v", err)
+	}
+	res, err := h.SearchPosts(ctx, &pb.SearchPostsRequest{Query: "comment"})
+	if err != nil {
+		t.Fatalf("failed to search posts: %+v", err)
+	}
+	var got []string
+	for _, p := range res.Posts {
+		got = append(got, uuid.FromBytesOrNil(p.Uuid).String())
+	}
+	if len(got) != 1 || got[0] != public.UUID {
+		t.Errorf("searched posts = %v, want only the public post %s", got, public.UUID)
+	}
+}
+
+// linkCountingRepository counts how many times links are got by uuid
+type linkCountingRepository struct {
+	service.DataRepository
+	gets int
+}
+
+func (r *linkCountingRepository) GetLinkByUUID(ctx context.Context, uuid string) (*service.DBLink, error) {
+	r.gets++
+	return r.DataRepository.GetLinkByUUID(ctx, uuid)
+}
+
+func TestHandlerDoesNotIndexForStoredSearch(t *testing.T) {
+	ctx := context.Background()
+	repo := &linkCountingRepository{DataRepository: service.NewMemoryDataRepository()}
+	f := &fixture{t: t, repo: repo, ctx: ctx, now: 1000}
+	link := f.link("https://example.com/stored-search")
+	cfg := service.DefaultConfig()
+	cfg.SearchIndex = service.NewMySQLSearchIndex(&mysql.Client{})
+	h, err := service.New(repo, cfg)
+	if err != nil {
+		t.Fatalf("failed to new up handler: %+v", err)
+	}
+	if _, err := h.CreatePost(ctx, &pb.CreatePostRequest{UserUuid: uuidBytes(newUUID(t)), LinkUuid: uuidBytes(link.UUID), Title: "title"}); err != nil {
+		t.Fatalf("failed to create post: %+v", err)
+	}
+	if repo.gets != 0 {
+		t.Errorf("got the link %d times to index a post for a search of stored posts, want 0", repo.gets)
+	}
+}
+
+func TestHandlerStopsUnfurls(t *testing.T) {
+	ctx := context.Background()
+	h := newHandler(t, service.NewMemoryDataRepository())
+	// loopback links are refused by the fetch client, so their unfurls fail without leaving the machine
+	if _, err := h.CreateLink(ctx, &pb.CreateLinkRequest{Url: "http://127.0.0.1:1/before"}); err != nil {
+		t.Fatalf("failed to create link: %+v", err)
+	}
+	stopped := make(chan error)
+	go func() { stopped <- h.StopUnfurls() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("failed to stop unfurls: %+v", err)
+		}
+	case <-time.After(2 * service.DefaultConfig().UnfurlTimeout):
+		t.Fatal("stopping unfurls hung past the unfurl timeouts")
+	}
+	if _, err := h.CreateLink(ctx, &pb.CreateLinkRequest{Url: "http://127.0.0.1:1/after"}); err != nil {
+		t.Errorf("creating a link after unfurls stopped = %v, want it created without an unfurl", err)
+	}
+}
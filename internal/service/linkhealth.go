@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/fetch"
+	"github.com/srcabl/posts/internal/linkcheck"
+)
+
+// LinkHealthWorker periodically re-checks links and records whether they are alive, redirected or dead
+type LinkHealthWorker struct {
+	config   *Config
+	datarepo DataRepository
+	checker  *linkcheck.Checker
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewLinkHealthWorker news up a link health worker
+func NewLinkHealthWorker(dataRepo DataRepository, cfg *Config) (*LinkHealthWorker, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return &LinkHealthWorker{
+		config:   cfg,
+		datarepo: dataRepo,
+		checker:  linkcheck.New(fetch.NewClient(cfg.LinkCheckTimeout), cfg.LinkCheckPerHostConcurrency, cfg.LinkCheckTimeout),
+	}, nil
+}
+
+// Run starts checking links in the background, the returned func stops the worker
+func (w *LinkHealthWorker) Run() (func() error, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.loop(ctx)
+	log.Printf("Checking link health every %s\n", w.config.LinkCheckInterval)
+	return w.shutdown, nil
+}
+
+func (w *LinkHealthWorker) shutdown() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+func (w *LinkHealthWorker) loop(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.LinkCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.checkDueLinks(ctx); err != nil {
+			log.Printf("Failed to check link health: %+v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDueLinks checks a batch of the links that have gone the longest without a check
+func (w *LinkHealthWorker) checkDueLinks(ctx context.Context) error {
+	checkedBefore := time.Now().Add(-w.config.LinkRecheckAge).Unix()
+	links, err := w.datarepo.ListLinksToCheck(ctx, checkedBefore, w.config.LinkCheckBatchSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to list links to check")
+	}
+	queue := make(chan *DBLink)
+	var wg sync.WaitGroup
+	for i := 0; i < w.config.LinkCheckConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range queue {
+				if err := w.checkLink(ctx, link); err != nil {
+					log.Printf("Failed to check link %s: %+v\n", link.UUID, err)
+				}
+			}
+		}()
+	}
+	for _, link := range links {
+		queue <- link
+	}
+	close(queue)
+	wg.Wait()
+	return nil
+}
+
+// checkLink checks a link and records the check, the checker bounds the check by the link check timeout
+// once it has a slot to request the link's host so waiting on a busy host is not recorded as a failure
+func (w *LinkHealthWorker) checkLink(ctx context.Context, link *DBLink) error {
+	result := w.checker.Check(ctx, link.URL)
+	if ctx.Err() != nil {
+		// the worker is stopping, a cancelled check or wait says nothing about the link
+		return ctx.Err()
+	}
+	check, err := HydrateLinkCheckModel(link.UUID, result, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to hydrate link check")
+	}
+	if err := w.datarepo.RecordLinkCheck(ctx, check, w.config.LinkDeadAfterFailures); err != nil {
+		return errors.Wrap(err, "failed to record link check")
+	}
+	return nil
+}
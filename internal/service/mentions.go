@@ -0,0 +1,22 @@
+package service
+
+import "context"
+
+// UserResolver looks up users by username, it is backed by whichever service owns users
+type UserResolver interface {
+	// ResolveUsernames returns the uuids of the users with the usernames, usernames without a user are left out
+	ResolveUsernames(ctx context.Context, usernames []string) (map[string]string, error)
+}
+
+// MentionEvent is emitted when users are newly mentioned in a post
+type MentionEvent struct {
+	PostUUID           string
+	AuthorUUID         string
+	MentionedUserUUIDs []string
+	MentionedAt        int64
+}
+
+// Notifier is told about mentions so users can be notified, e.g. by the notifications service
+type Notifier interface {
+	NotifyMentions(ctx context.Context, event *MentionEvent) error
+}
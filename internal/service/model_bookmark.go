@@ -0,0 +1,56 @@
+package service
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	postspb "github.com/srcabl/protos/posts"
+)
+
+// DBBookmark is the database model of a user's bookmark of a post
+type DBBookmark struct {
+	UUID      string
+	UserUUID  string
+	PostUUID  string
+	CreatedAt int64
+}
+
+// ToGRPC transforms the dbbookmark to proto bookmark
+func (b *DBBookmark) ToGRPC() (*postspb.Bookmark, error) {
+	postid, err := uuid.FromString(b.PostUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform post uuid: %s", b.PostUUID)
+	}
+	userid, err := uuid.FromString(b.UserUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform user uuid: %s", b.UserUUID)
+	}
+	return &postspb.Bookmark{
+		PostUuid:  postid.Bytes(),
+		UserUuid:  userid.Bytes(),
+		CreatedAt: b.CreatedAt,
+	}, nil
+}
+
+// HydrateBookmarkModelForCreate creates a db bookmark from a proto bookmark post request
+func HydrateBookmarkModelForCreate(req *postspb.BookmarkPostRequest) (*DBBookmark, error) {
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate uuid for bookmark")
+	}
+	postid, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, invalidUUID("post_uuid")
+	}
+	userid, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, invalidUUID("user_uuid")
+	}
+	return &DBBookmark{
+		UUID:      newUUID.String(),
+		UserUUID:  userid.String(),
+		PostUUID:  postid.String(),
+		CreatedAt: time.Now().Unix(),
+	}, nil
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/canonical"
+	"github.com/srcabl/posts/internal/linkcheck"
 	postspb "github.com/srcabl/protos/posts"
 	pb "github.com/srcabl/protos/shared"
 	"github.com/srcabl/services/pkg/proto"
@@ -15,11 +17,17 @@ import (
 type DBLink struct {
 	UUID            string
 	URL             string
+	CanonicalURL    string
+	ResolvedURL     string
 	SourceHeadUUIDs []string
 	CreatedByUUID   string
 	CreatedAt       int64
 	UpdatedByUUID   sql.NullString
 	UpdatedAt       sql.NullInt64
+	Version         int64
+	Status          linkcheck.Status
+	StatusCheckedAt sql.NullInt64
+	Metadata        *DBLinkMetadata
 }
 
 // CreatedByUUIDString satisfies the services helper to transform db auditfields to grpc auditfields
@@ -60,16 +68,44 @@ func (l *DBLink) ToGRPC() (*pb.Link, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to transform auditfields")
 	}
+	var metadata *pb.LinkMetadata
+	if l.Metadata != nil {
+		metadata = l.Metadata.ToGRPC()
+	}
 	return &pb.Link{
-		Uuid:        id.Bytes(),
-		SourceHeads: srcUUIDs,
-		Url:         l.URL,
-		AuditFields: auditFields,
+		Uuid:            id.Bytes(),
+		SourceHeads:     srcUUIDs,
+		Url:             l.URL,
+		CanonicalUrl:    l.CanonicalURL,
+		ResolvedUrl:     l.ResolvedURL,
+		AuditFields:     auditFields,
+		Version:         l.Version,
+		Metadata:        metadata,
+		Status:          linkStatusToGRPC(l.Status),
+		StatusCheckedAt: l.StatusCheckedAt.Int64,
 	}, nil
 }
 
-// HydrateLinkModelForCreate creates a db post from a proto post and fills in any missing data
+func linkStatusToGRPC(status linkcheck.Status) pb.LinkStatus {
+	switch status {
+	case linkcheck.StatusAlive:
+		return pb.LinkStatus_ALIVE
+	case linkcheck.StatusRedirected:
+		return pb.LinkStatus_REDIRECTED
+	case linkcheck.StatusDead:
+		return pb.LinkStatus_DEAD
+	default:
+		return pb.LinkStatus_UNKNOWN
+	}
+}
+
+// HydrateLinkModelForCreate creates a db post from a proto post and fills in any missing data,
+// the link is assumed to resolve to itself until its redirects are followed
 func HydrateLinkModelForCreate(req *postspb.CreateLinkRequest) (*DBLink, error) {
+	canonicalURL, err := canonical.URL(req.Url)
+	if err != nil {
+		return nil, &FieldError{Field: "url", Description: "must be an absolute url"}
+	}
 	newUUID, err := uuid.NewV4()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate uuid for link")
@@ -78,7 +114,7 @@ func HydrateLinkModelForCreate(req *postspb.CreateLinkRequest) (*DBLink, error)
 	for _, s := range req.SourceHeadUuids {
 		sUUID, err := uuid.FromBytes(s)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to transform uuid for source head")
+			return nil, invalidUUID("source_head_uuids")
 		}
 		sourceHeadUUIDs = append(sourceHeadUUIDs, sUUID.String())
 	}
@@ -86,10 +122,13 @@ func HydrateLinkModelForCreate(req *postspb.CreateLinkRequest) (*DBLink, error)
 	return &DBLink{
 		UUID:            newUUID.String(),
 		URL:             req.Url,
+		CanonicalURL:    canonicalURL,
+		ResolvedURL:     canonicalURL,
 		SourceHeadUUIDs: sourceHeadUUIDs,
 		CreatedByUUID:   newUUID.String(),
 		CreatedAt:       now,
 		UpdatedByUUID:   sql.NullString{Valid: true, String: newUUID.String()},
 		UpdatedAt:       sql.NullInt64{Valid: true, Int64: now},
+		Version:         1,
 	}, nil
 }
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/linkcheck"
+)
+
+const maxLinkCheckErrorLength = 512
+
+// DBLinkCheck is the database model of a single check of a link's health
+type DBLinkCheck struct {
+	UUID       string
+	LinkUUID   string
+	CheckedAt  int64
+	OK         bool
+	Redirected bool
+	// Status is the link's status after this check
+	Status     linkcheck.Status
+	HTTPStatus sql.NullInt64
+	FinalURL   sql.NullString
+	Error      sql.NullString
+}
+
+// HydrateLinkCheckModel creates a db link check from the result of checking a link
+func HydrateLinkCheckModel(linkUUID string, result *linkcheck.Result, checkedAt time.Time) (*DBLinkCheck, error) {
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate uuid for link check")
+	}
+	check := &DBLinkCheck{
+		UUID:       newUUID.String(),
+		LinkUUID:   linkUUID,
+		CheckedAt:  checkedAt.Unix(),
+		OK:         result.OK,
+		Redirected: result.Redirected,
+	}
+	if result.HTTPStatus != 0 {
+		check.HTTPStatus = sql.NullInt64{Valid: true, Int64: int64(result.HTTPStatus)}
+	}
+	if result.FinalURL != "" {
+		check.FinalURL = sql.NullString{Valid: true, String: dropIfLonger(result.FinalURL, maxLinkMetadataURLLength)}
+	}
+	if result.Err != nil {
+		check.Error = sql.NullString{Valid: true, String: truncate(result.Err.Error(), maxLinkCheckErrorLength)}
+	}
+	return check, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"database/sql"
+
+	"github.com/srcabl/posts/internal/unfurl"
+	sharedpb "github.com/srcabl/protos/shared"
+)
+
+const (
+	maxLinkMetadataTitleLength       = 512
+	maxLinkMetadataDescriptionLength = 4096
+	maxLinkMetadataSiteNameLength    = 255
+	maxLinkMetadataURLLength         = 2048
+)
+
+// DBLinkMetadata is the database model of the metadata unfurled from a link's page
+type DBLinkMetadata struct {
+	LinkUUID     string
+	Title        string
+	Description  string
+	CanonicalURL string
+	SiteName     string
+	ImageURL     string
+	PublishedAt  sql.NullInt64
+	FetchedAt    int64
+}
+
+// NewDBLinkMetadata creates db link metadata from unfurled metadata, trimming it to fit its columns
+func NewDBLinkMetadata(linkUUID string, meta *unfurl.Metadata, fetchedAt int64) *DBLinkMetadata {
+	dbMeta := &DBLinkMetadata{
+		LinkUUID:     linkUUID,
+		Title:        truncate(meta.Title, maxLinkMetadataTitleLength),
+		Description:  truncate(meta.Description, maxLinkMetadataDescriptionLength),
+		CanonicalURL: dropIfLonger(meta.CanonicalURL, maxLinkMetadataURLLength),
+		SiteName:     truncate(meta.SiteName, maxLinkMetadataSiteNameLength),
+		ImageURL:     dropIfLonger(meta.ImageURL, maxLinkMetadataURLLength),
+		FetchedAt:    fetchedAt,
+	}
+	if !meta.PublishedAt.IsZero() {
+		dbMeta.PublishedAt = sql.NullInt64{Valid: true, Int64: meta.PublishedAt.Unix()}
+	}
+	return dbMeta
+}
+
+// ToGRPC transforms the db link metadata to proto link metadata
+func (m *DBLinkMetadata) ToGRPC() *sharedpb.LinkMetadata {
+	return &sharedpb.LinkMetadata{
+		Title:        m.Title,
+		Description:  m.Description,
+		CanonicalUrl: m.CanonicalURL,
+		SiteName:     m.SiteName,
+		ImageUrl:     m.ImageURL,
+		PublishedAt:  m.PublishedAt.Int64,
+		FetchedAt:    m.FetchedAt,
+	}
+}
+
+// truncate shortens s to at most max runes
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// dropIfLonger empties values like urls that are useless once truncated
+func dropIfLonger(s string, max int) string {
+	if len(s) > max {
+		return ""
+	}
+	return s
+}
+
+// nullLinkMetadata holds left joined link metadata columns, they are all null for links that were never unfurled
+type nullLinkMetadata struct {
+	LinkUUID     sql.NullString
+	Title        sql.NullString
+	Description  sql.NullString
+	CanonicalURL sql.NullString
+	SiteName     sql.NullString
+	ImageURL     sql.NullString
+	PublishedAt  sql.NullInt64
+	FetchedAt    sql.NullInt64
+}
+
+// toDB returns the scanned metadata or nil when the link has none
+func (m *nullLinkMetadata) toDB() *DBLinkMetadata {
+	if !m.LinkUUID.Valid {
+		return nil
+	}
+	return &DBLinkMetadata{
+		LinkUUID:     m.LinkUUID.String,
+		Title:        m.Title.String,
+		Description:  m.Description.String,
+		CanonicalURL: m.CanonicalURL.String,
+		SiteName:     m.SiteName.String,
+		ImageURL:     m.ImageURL.String,
+		PublishedAt:  m.PublishedAt,
+		FetchedAt:    m.FetchedAt.Int64,
+	}
+}
@@ -6,11 +6,10 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/hashtag"
 	postspb "github.com/srcabl/protos/posts"
 	sharedpb "github.com/srcabl/protos/shared"
 	"github.com/srcabl/services/pkg/proto"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // DBPost is the database model of a post
@@ -24,6 +23,39 @@ type DBPost struct {
 	CreatedAt     int64
 	UpdatedByUUID sql.NullString
 	UpdatedAt     sql.NullInt64
+	DeletedByUUID sql.NullString
+	DeletedAt     sql.NullInt64
+	// DeletedByModerator is whether the post was removed by a moderator rather than deleted by its author
+	DeletedByModerator bool
+	Version            int64
+	// EngagementCount is how many replies, reactions and reposts the post has
+	EngagementCount int64
+	// Tags are the normalized hashtags in the post's comment
+	Tags []string
+	// Mentions are the users mentioned in the post's comment
+	Mentions []*DBPostMention
+	// ParentPostUUID is the post a reply replies to
+	ParentPostUUID sql.NullString
+	// RootPostUUID is the post at the top of a reply's thread
+	RootPostUUID sql.NullString
+	// ReplyCount is how many direct replies the post has that are not deleted, deleted replies are still listed
+	// as tombstones
+	ReplyCount int64
+	// ReactionCounts are how many of each kind of reaction the post has
+	ReactionCounts []*DBReactionCount
+	// RepostOfUUID is the post a repost or quote reposts
+	RepostOfUUID sql.NullString
+	// RepostCount is how many reposts and quotes of the post are not deleted
+	RepostCount int64
+	// Visibility is who can see the post, one of the Visibility constants
+	Visibility string
+	// Draft is whether the post is staged and only seen by its author until it is published
+	Draft bool
+}
+
+// IsPlainRepost is whether the post reposts another post without a title or comment of its own
+func (p *DBPost) IsPlainRepost() bool {
+	return p.RepostOfUUID.Valid && p.Title == "" && p.Comment == ""
 }
 
 // CreatedByUUIDString satisfies the services helper to transform db auditfields to grpc auditfields
@@ -46,12 +78,34 @@ func (p *DBPost) UpdatedAtUnixNullInt() sql.NullInt64 {
 	return p.UpdatedAt
 }
 
-// ToGRPC transforms the dbuser to proto user
+// ToGRPC transforms the dbuser to proto user, a deleted post is transformed to a tombstone
 func (p *DBPost) ToGRPC() (*sharedpb.Post, error) {
 	id, err := uuid.FromString(p.UUID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to transform uuid: %s", p.UUID)
 	}
+	parentid, err := nullUUIDBytes(p.ParentPostUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform parent post uuid: %s", p.UUID)
+	}
+	rootid, err := nullUUIDBytes(p.RootPostUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform root post uuid: %s", p.UUID)
+	}
+	repostofid, err := nullUUIDBytes(p.RepostOfUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform repost of uuid: %s", p.UUID)
+	}
+	if p.DeletedAt.Valid {
+		// tombstones keep their place in threads and lists without any of their content
+		return &sharedpb.Post{
+			Uuid:           id.Bytes(),
+			ParentPostUuid: parentid,
+			RootPostUuid:   rootid,
+			ReplyCount:     p.ReplyCount,
+			Deleted:        true,
+		}, nil
+	}
 	userid, err := uuid.FromString(p.UserUUID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to transform user uuid: %s", p.UUID)
@@ -64,6 +118,18 @@ func (p *DBPost) ToGRPC() (*sharedpb.Post, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to transform auditfields")
 	}
+	var mentions []*sharedpb.Mention
+	for _, m := range p.Mentions {
+		pbm, err := m.ToGRPC()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to transform mention")
+		}
+		mentions = append(mentions, pbm)
+	}
+	var reactionCounts []*sharedpb.ReactionCount
+	for _, c := range p.ReactionCounts {
+		reactionCounts = append(reactionCounts, c.ToGRPC())
+	}
 	return &sharedpb.Post{
 		Uuid:     id.Bytes(),
 		UserUuid: userid.Bytes(),
@@ -73,6 +139,18 @@ func (p *DBPost) ToGRPC() (*sharedpb.Post, error) {
 			PrimaryContent: p.Comment,
 		},
 		AuditFields: auditFields,
+		Version:     p.Version,
+		Tags:        p.Tags,
+		Mentions:    mentions,
+
+		ParentPostUuid: parentid,
+		RootPostUuid:   rootid,
+		ReplyCount:     p.ReplyCount,
+		ReactionCounts: reactionCounts,
+		RepostOfUuid:   repostofid,
+		RepostCount:    p.RepostCount,
+		Visibility:     visibilityToGRPC(p.Visibility),
+		Draft:          p.Draft,
 	}, nil
 }
 
@@ -80,26 +158,98 @@ func (p *DBPost) ToGRPC() (*sharedpb.Post, error) {
 func HydratePostModelForCreate(req *postspb.CreatePostRequest) (*DBPost, error) {
 	newUUID, err := uuid.NewV4()
 	if err != nil {
-		return nil, status.Error(codes.Internal, errors.Wrap(err, "failed to generate uuid for post").Error())
+		return nil, errors.Wrap(err, "failed to generate uuid for post")
 	}
 	userid, err := uuid.FromBytes(req.UserUuid)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to transform user uuid: %s", req.UserUuid)
+		return nil, invalidUUID("user_uuid")
+	}
+	var parentUUID sql.NullString
+	if len(req.ParentPostUuid) > 0 {
+		parentid, err := uuid.FromBytes(req.ParentPostUuid)
+		if err != nil {
+			return nil, invalidUUID("parent_post_uuid")
+		}
+		parentUUID = sql.NullString{Valid: true, String: parentid.String()}
+	}
+	var repostOfUUID sql.NullString
+	if len(req.RepostOfUuid) > 0 {
+		if parentUUID.Valid {
+			return nil, &FieldError{Field: "repost_of_uuid", Description: "a post cannot both reply to and repost a post"}
+		}
+		repostofid, err := uuid.FromBytes(req.RepostOfUuid)
+		if err != nil {
+			return nil, invalidUUID("repost_of_uuid")
+		}
+		repostOfUUID = sql.NullString{Valid: true, String: repostofid.String()}
+	}
+	if req.Draft && (parentUUID.Valid || repostOfUUID.Valid) {
+		return nil, &FieldError{Field: "draft", Description: "a reply or repost cannot be a draft"}
 	}
-	linkid, err := uuid.FromBytes(req.LinkUuid)
+	visibility, err := visibilityFromGRPC(req.Visibility)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to transform link uuid: %s", req.LinkUuid)
+		return nil, &FieldError{Field: "visibility", Description: err.Error()}
+	}
+	// a reply without a link is about its parent's link and a repost is about the reposted post's link,
+	// which are filled in when they are created
+	var linkUUID string
+	if !repostOfUUID.Valid && (len(req.LinkUuid) > 0 || !parentUUID.Valid) {
+		linkid, err := uuid.FromBytes(req.LinkUuid)
+		if err != nil {
+			return nil, invalidUUID("link_uuid")
+		}
+		linkUUID = linkid.String()
 	}
 	now := time.Now().Unix()
 	return &DBPost{
-		UUID:          newUUID.String(),
-		UserUUID:      userid.String(),
-		LinkUUID:      linkid.String(),
+		UUID:           newUUID.String(),
+		UserUUID:       userid.String(),
+		LinkUUID:       linkUUID,
+		Title:          req.Title,
+		Comment:        req.Comment,
+		CreatedByUUID:  newUUID.String(),
+		CreatedAt:      now,
+		UpdatedByUUID:  sql.NullString{Valid: true, String: newUUID.String()},
+		UpdatedAt:      sql.NullInt64{Valid: true, Int64: now},
+		Version:        1,
+		Tags:           hashtag.Extract(req.Comment),
+		ParentPostUUID: parentUUID,
+		RepostOfUUID:   repostOfUUID,
+		Visibility:     visibility,
+		Draft:          req.Draft,
+	}, nil
+}
+
+// nullUUIDBytes transforms a nullable uuid to its bytes, a null uuid has no bytes
+func nullUUIDBytes(id sql.NullString) ([]byte, error) {
+	if !id.Valid {
+		return nil, nil
+	}
+	u, err := uuid.FromString(id.String)
+	if err != nil {
+		return nil, err
+	}
+	return u.Bytes(), nil
+}
+
+// HydratePostModelForUpdate creates a db post holding the edited fields of a post,
+// its version is the version the update expects to replace
+func HydratePostModelForUpdate(req *postspb.UpdatePostRequest) (*DBPost, error) {
+	postid, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, invalidUUID("post_uuid")
+	}
+	updatedbyid, err := uuid.FromBytes(req.UpdatedByUuid)
+	if err != nil {
+		return nil, invalidUUID("updated_by_uuid")
+	}
+	return &DBPost{
+		UUID:          postid.String(),
 		Title:         req.Title,
 		Comment:       req.Comment,
-		CreatedByUUID: newUUID.String(),
-		CreatedAt:     now,
-		UpdatedByUUID: sql.NullString{Valid: true, String: newUUID.String()},
-		UpdatedAt:     sql.NullInt64{Valid: true, Int64: now},
+		UpdatedByUUID: sql.NullString{Valid: true, String: updatedbyid.String()},
+		UpdatedAt:     sql.NullInt64{Valid: true, Int64: time.Now().Unix()},
+		Version:       req.ExpectedVersion,
+		Tags:          hashtag.Extract(req.Comment),
 	}, nil
 }
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/mention"
+	sharedpb "github.com/srcabl/protos/shared"
+)
+
+// DBPostMention is the database model of a user mentioned in a post's comment,
+// Start and End are the byte offsets of the mention in the comment including its @
+type DBPostMention struct {
+	UserUUID string
+	Start    int
+	End      int
+}
+
+// ToGRPC transforms the dbpostmention to proto mention
+func (m *DBPostMention) ToGRPC() (*sharedpb.Mention, error) {
+	userid, err := uuid.FromString(m.UserUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform mentioned user uuid: %s", m.UserUUID)
+	}
+	return &sharedpb.Mention{
+		UserUuid: userid.Bytes(),
+		Start:    int32(m.Start),
+		End:      int32(m.End),
+	}, nil
+}
+
+// HydratePostMentions creates the db mentions of the mentions in a comment,
+// usernames are looked up in the resolved uuids and mentions of unknown usernames are dropped
+func HydratePostMentions(mentions []*mention.Mention, resolved map[string]string) []*DBPostMention {
+	var dbMentions []*DBPostMention
+	for _, m := range mentions {
+		userUUID := m.UserUUID
+		if userUUID == "" {
+			userUUID = resolved[m.Username]
+		}
+		if userUUID == "" {
+			continue
+		}
+		dbMentions = append(dbMentions, &DBPostMention{UserUUID: userUUID, Start: m.Start, End: m.End})
+	}
+	return dbMentions
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"database/sql"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	postspb "github.com/srcabl/protos/posts"
+	sharedpb "github.com/srcabl/protos/shared"
+	"github.com/srcabl/services/pkg/proto"
+)
+
+// DBPostRevision is the database model of a prior version of a post
+type DBPostRevision struct {
+	UUID          string
+	PostUUID      string
+	Revision      int64
+	Title         string
+	Comment       string
+	CreatedByUUID string
+	CreatedAt     int64
+}
+
+// CreatedByUUIDString satisfies the services helper to transform db auditfields to grpc auditfields
+func (r *DBPostRevision) CreatedByUUIDString() string {
+	return r.CreatedByUUID
+}
+
+// CreatedAtUnixInt satisfies the services helper to transform db auditfields to grpc auditfields
+func (r *DBPostRevision) CreatedAtUnixInt() int64 {
+	return r.CreatedAt
+}
+
+// UpdatedByUUIDNullString satisfies the services helper to transform db auditfields to grpc auditfields,
+// revisions are never updated
+func (r *DBPostRevision) UpdatedByUUIDNullString() sql.NullString {
+	return sql.NullString{}
+}
+
+// UpdatedAtUnixNullInt satisfies the services helper to transform db auditfields to grpc auditfields,
+// revisions are never updated
+func (r *DBPostRevision) UpdatedAtUnixNullInt() sql.NullInt64 {
+	return sql.NullInt64{}
+}
+
+// ToGRPC transforms the db revision to proto revision
+func (r *DBPostRevision) ToGRPC() (*postspb.PostRevision, error) {
+	id, err := uuid.FromString(r.UUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform uuid: %s", r.UUID)
+	}
+	postid, err := uuid.FromString(r.PostUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform post uuid: %s", r.UUID)
+	}
+	auditFields, err := proto.DBAuditFieldsToGRPC(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to transform auditfields")
+	}
+	return &postspb.PostRevision{
+		Uuid:     id.Bytes(),
+		PostUuid: postid.Bytes(),
+		Revision: r.Revision,
+		Comment: &sharedpb.Post_PostComment{
+			Title:          r.Title,
+			PrimaryContent: r.Comment,
+		},
+		AuditFields: auditFields,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	postspb "github.com/srcabl/protos/posts"
+	sharedpb "github.com/srcabl/protos/shared"
+)
+
+// DBReaction is the database model of a user's reaction to a post
+type DBReaction struct {
+	UUID      string
+	PostUUID  string
+	UserUUID  string
+	Kind      string
+	CreatedAt int64
+}
+
+// ToGRPC transforms the dbreaction to proto reaction
+func (r *DBReaction) ToGRPC() (*postspb.Reaction, error) {
+	postid, err := uuid.FromString(r.PostUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform post uuid: %s", r.PostUUID)
+	}
+	userid, err := uuid.FromString(r.UserUUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to transform user uuid: %s", r.UserUUID)
+	}
+	return &postspb.Reaction{
+		PostUuid:  postid.Bytes(),
+		UserUuid:  userid.Bytes(),
+		Kind:      r.Kind,
+		CreatedAt: r.CreatedAt,
+	}, nil
+}
+
+// HydrateReactionModelForAdd creates a db reaction from a proto add reaction request
+func HydrateReactionModelForAdd(req *postspb.AddReactionRequest) (*DBReaction, error) {
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate uuid for reaction")
+	}
+	postid, err := uuid.FromBytes(req.PostUuid)
+	if err != nil {
+		return nil, invalidUUID("post_uuid")
+	}
+	userid, err := uuid.FromBytes(req.UserUuid)
+	if err != nil {
+		return nil, invalidUUID("user_uuid")
+	}
+	return &DBReaction{
+		UUID:      newUUID.String(),
+		PostUUID:  postid.String(),
+		UserUUID:  userid.String(),
+		Kind:      req.Kind,
+		CreatedAt: time.Now().Unix(),
+	}, nil
+}
+
+// DBReactionCount is the database model of how many of a kind of reaction a post has
+type DBReactionCount struct {
+	Kind  string
+	Count int64
+}
+
+// ToGRPC transforms the dbreactioncount to proto reaction count
+func (c *DBReactionCount) ToGRPC() *sharedpb.ReactionCount {
+	return &sharedpb.ReactionCount{
+		Kind:  c.Kind,
+		Count: c.Count,
+	}
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	postspb "github.com/srcabl/protos/posts"
+)
+
+// DBTagCount is the database model of how many posts have a tag
+type DBTagCount struct {
+	Tag       string
+	PostCount int64
+}
+
+// ToGRPC transforms the dbtagcount to proto trending tag
+func (t *DBTagCount) ToGRPC() *postspb.TrendingTag {
+	return &postspb.TrendingTag{
+		Tag:       t.Tag,
+		PostCount: t.PostCount,
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/keyset"
+	"github.com/srcabl/posts/internal/search"
+	"github.com/srcabl/services/pkg/db/mysql"
+)
+
+// SearchIndex finds the posts matching a search
+type SearchIndex interface {
+	// Index adds a post to the index, replacing what was indexed for it before
+	Index(context.Context, *search.Document) error
+	// Remove takes a post out of the index
+	Remove(context.Context, string) error
+	// Search finds the page of posts matching a query
+	Search(context.Context, *search.Query) (*search.Result, error)
+}
+
+// storedSearchIndex is a search index that searches the stored posts themselves,
+// so posts need not be read back to build documents for it
+type storedSearchIndex interface {
+	searchesStorage()
+}
+
+// mysqlSearchIndex searches posts with the FULLTEXT indexes on posts and link_metadata
+type mysqlSearchIndex struct {
+	db *mysql.Client
+}
+
+// NewMySQLSearchIndex news up a search index backed by MySQL FULLTEXT indexes
+func NewMySQLSearchIndex(db *mysql.Client) SearchIndex {
+	return &mysqlSearchIndex{db: db}
+}
+
+// searchesStorage marks the index as searching the stored posts
+func (si *mysqlSearchIndex) searchesStorage() {}
+
+// Index is a no-op since MySQL keeps FULLTEXT indexes up to date itself
+func (si *mysqlSearchIndex) Index(ctx context.Context, doc *search.Document) error {
+	return nil
+}
+
+// Remove is a no-op since deleted posts are filtered out when searching
+func (si *mysqlSearchIndex) Remove(ctx context.Context, postUUID string) error {
+	return nil
+}
+
+const searchPostsQuery = `
+SELECT
+	p.uuid,
+	MATCH(p.title, p.comment) AGAINST(? IN BOOLEAN MODE)
+		+ COALESCE(MATCH(lm.title, lm.description) AGAINST(? IN BOOLEAN MODE), 0) AS score
+FROM
+	posts p
+INNER JOIN
+	links l
+ON
+	p.link_uuid=l.uuid
+LEFT JOIN
+	link_metadata lm
+ON
+	l.uuid=lm.link_uuid
+WHERE
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+AND
+	p.visibility='public'
+AND
+	(MATCH(p.title, p.comment) AGAINST(? IN BOOLEAN MODE) OR MATCH(lm.title, lm.description) AGAINST(? IN BOOLEAN MODE))
+`
+
+// linkHostExpression extracts the host from a link's canonical url
+const linkHostExpression = `SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(l.canonical_url, '/', 3), '/', -1), '?', 1)`
+
+// Search finds the page of posts matching a query
+func (si *mysqlSearchIndex) Search(ctx context.Context, q *search.Query) (*search.Result, error) {
+	if q.Empty() {
+		return &search.Result{}, nil
+	}
+	against := booleanModeQuery(q)
+	query := searchPostsQuery
+	params := []interface{}{against, against, against, against}
+	if q.UserUUID != "" {
+		query += " AND p.user_uuid=?"
+		params = append(params, q.UserUUID)
+	}
+	if q.SourceUUID != "" {
+		query += " AND " + sourceHeadLinksWhere
+		params = append(params, q.SourceUUID)
+	}
+	if q.Domain != "" {
+		query += fmt.Sprintf(" AND %s=?", linkHostExpression)
+		params = append(params, q.Domain)
+	}
+	if q.CreatedAfter != 0 {
+		query += " AND p.created_at>=?"
+		params = append(params, q.CreatedAfter)
+	}
+	if q.CreatedBefore != 0 {
+		query += " AND p.created_at<?"
+		params = append(params, q.CreatedBefore)
+	}
+	if q.Order == search.OrderRelevance {
+		query += " ORDER BY score DESC, p.created_at DESC, p.uuid DESC"
+	} else {
+		query += " ORDER BY p.created_at DESC, p.uuid DESC"
+	}
+	// one row past the page is fetched to know if there are more
+	query += " LIMIT ? OFFSET ?"
+	params = append(params, q.Limit+1, q.Offset)
+
+	rows, err := si.db.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to search posts for %s", against)
+	}
+	defer rows.Close()
+	result := &search.Result{}
+	for rows.Next() {
+		var postUUID string
+		var score float64
+		if err := rows.Scan(&postUUID, &score); err != nil {
+			return nil, errors.Wrap(err, "failed to scan a row of search results")
+		}
+		result.PostUUIDs = append(result.PostUUIDs, postUUID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate search results")
+	}
+	if len(result.PostUUIDs) > q.Limit {
+		result.PostUUIDs = result.PostUUIDs[:q.Limit]
+		result.HasMore = true
+	}
+	return result, nil
+}
+
+// booleanModeQuery builds the boolean mode search requiring every term and phrase,
+// the terms and phrases are already tokenized so they hold no boolean operators
+func booleanModeQuery(q *search.Query) string {
+	var parts []string
+	for _, term := range q.Terms {
+		parts = append(parts, "+"+term)
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `+"`+phrase+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// SearchablePostLister is a data repository that can list the posts a search index holds,
+// so that an index kept in memory can be rebuilt from storage when the service starts
+type SearchablePostLister interface {
+	// ListSearchablePosts lists the keys of the public, published posts created after a key, oldest first
+	ListSearchablePosts(ctx context.Context, after keyset.Key, limit int) ([]keyset.Key, error)
+}
+
+const listSearchablePostsQuery = `
+SELECT
+	p.created_at,
+	p.uuid
+FROM
+	posts p
+WHERE
+	p.deleted_at IS NULL
+AND
+	p.draft=0
+AND
+	p.visibility='public'
+AND
+	(p.created_at>? OR (p.created_at=? AND p.uuid>?))
+ORDER BY
+	p.created_at ASC,
+	p.uuid ASC
+LIMIT ?
+`
+
+// ListSearchablePosts lists the keys of the public, published posts created after a key, oldest first
+func (dr *dataRepository) ListSearchablePosts(ctx context.Context, after keyset.Key, limit int) ([]keyset.Key, error) {
+	rows, err := dr.db().QueryContext(ctx, listSearchablePostsQuery, after.Value, after.Value, after.UUID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query searchable posts")
+	}
+	defer rows.Close()
+	var keys []keyset.Key
+	for rows.Next() {
+		key := keyset.Key{}
+		if err := rows.Scan(&key.Value, &key.UUID); err != nil {
+			return nil, errors.Wrap(err, "failed to scan a row of searchable posts")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate searchable posts")
+	}
+	return keys, nil
+}
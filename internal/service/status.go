@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusError maps an error to the status clients get, typed errors become their code along with the resource or
+// field they are about, as do database errors for unique keys another request got to first and for a database that
+// cannot be reached; anything else is logged and only reaches clients as an internal error, so the queries and
+// rows internal errors describe never leave the service
+func statusError(err error) error {
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return err
+	}
+	var resource *resourceError
+	var resourceName string
+	if errors.As(err, &resource) {
+		resourceName = resource.name
+	}
+	var notFound *NotFoundError
+	var alreadyExists *AlreadyExistsError
+	var conflict *ConflictError
+	var precondition *PreconditionError
+	var permission *PermissionError
+	var unavailable *UnavailableError
+	var validation *ValidationError
+	var field *FieldError
+	switch {
+	case errors.As(err, &notFound):
+		return resourceStatus(codes.NotFound, notFound.Resource, resourceName, notFound.Description)
+	case errors.As(err, &alreadyExists):
+		return resourceStatus(codes.AlreadyExists, alreadyExists.Resource, resourceName, alreadyExists.Description)
+	case errors.As(err, &conflict):
+		return resourceStatus(codes.Aborted, conflict.Resource, resourceName, conflict.Description)
+	case errors.As(err, &permission):
+		return resourceStatus(codes.PermissionDenied, permission.Resource, resourceName, permission.Description)
+	case errors.As(err, &precondition):
+		return preconditionStatus(precondition.Resource, resourceName, precondition.Description)
+	case errors.As(err, &validation):
+		return badRequestStatus(validation.Error(), validation.Violations...)
+	case errors.As(err, &field):
+		return badRequestStatus(field.Error(), field)
+	case errors.As(err, &unavailable):
+		log.Printf("Unavailable: %+v\n", err)
+		return status.Error(codes.Unavailable, unavailable.Dependency+" is unavailable")
+	case resource != nil && errors.Is(err, sql.ErrNoRows):
+		return resourceStatus(codes.NotFound, resource.resource, resourceName, resource.resource+" not found")
+	case duplicateKey(err):
+		resourceType := "resource"
+		if resource != nil {
+			resourceType = resource.resource
+		}
+		return resourceStatus(codes.AlreadyExists, resourceType, resourceName, resourceType+" already exists")
+	case unreachable(err), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Unavailable: %+v\n", err)
+		return status.Error(codes.Unavailable, "database is unavailable")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request was canceled")
+	}
+	log.Printf("Internal error: %+v\n", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// resourceStatus is a status about a resource, with the resource attached as details
+func resourceStatus(code codes.Code, resourceType string, resourceName string, description string) error {
+	st := status.New(code, description)
+	detailed, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Description:  description,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// preconditionStatus is a status about a resource that is not in the state a mutation needs,
+// with the failed precondition attached as details
+func preconditionStatus(resourceType string, resourceName string, description string) error {
+	st := status.New(codes.FailedPrecondition, description)
+	detailed, err := st.WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "STATE",
+			Subject:     resourceType + ":" + resourceName,
+			Description: description,
+		}},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// badRequestStatus is a status about request fields that are not valid, with the field violations attached as details
+func badRequestStatus(message string, fields ...*FieldError) error {
+	st := status.New(codes.InvalidArgument, message)
+	badRequest := &errdetails.BadRequest{}
+	for _, field := range fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field.Field,
+			Description: field.Description,
+		})
+	}
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
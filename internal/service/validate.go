@@ -0,0 +1,319 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/srcabl/posts/internal/hashtag"
+	"github.com/srcabl/posts/internal/search"
+	pb "github.com/srcabl/protos/posts"
+	"github.com/srcabl/protos/shared"
+)
+
+// validate checks a request against the rules for its fields before it is hydrated,
+// every field that is not valid is returned at once rather than only the first to fail
+func (h *Handler) validate(req interface{}) error {
+	return violated(h.rules(req))
+}
+
+// validateUpdate checks an update keeps the fields creating the post required, e.g. so a quote post cannot be
+// blanked into a plain repost, which would get around the one plain repost per user rule
+func (h *Handler) validateUpdate(post *DBPost, req *pb.UpdatePostRequest) error {
+	reply, repost := post.ParentPostUUID.Valid, post.RepostOfUUID.Valid
+	quote := repost && (post.Title != "" || post.Comment != "")
+	return violated([]*FieldError{
+		check("title", req.Title != "" || reply || repost, "is required"),
+		check("comment", req.Title != "" || req.Comment != "" || !reply, "is required on a reply without a title"),
+		check("comment", req.Title != "" || req.Comment != "" || !quote, "is required on a quote post without a title"),
+	})
+}
+
+// violated is the status of the rules that are violated, it is nil when every rule holds
+func violated(rules []*FieldError) error {
+	var violations []*FieldError
+	for _, violation := range rules {
+		if violation != nil {
+			violations = append(violations, violation)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return statusError(&ValidationError{Violations: violations})
+}
+
+// rules checks the fields of a request, each rule is nil when its field is valid
+func (h *Handler) rules(req interface{}) []*FieldError {
+	switch r := req.(type) {
+	case *pb.GetPostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.GetLinkRequest:
+		return []*FieldError{
+			check("get_by", r.GetBy == pb.GetLinkRequest_UUID || r.GetBy == pb.GetLinkRequest_URL, "must be UUID or URL"),
+			when(r.GetBy == pb.GetLinkRequest_UUID, uuidField("link_uuid", r.LinkUuid)),
+			when(r.GetBy == pb.GetLinkRequest_URL, h.urlField("url", r.Url)),
+		}
+	case *pb.BatchGetPostsRequest:
+		return []*FieldError{
+			uuidsField("post_uuids", r.PostUuids, h.config.MaxBatchSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.BatchGetLinksRequest:
+		return []*FieldError{
+			uuidsField("link_uuids", r.LinkUuids, h.config.MaxBatchSize),
+		}
+	case *pb.ListUsersPostsRequest:
+		return []*FieldError{
+			uuidField("user_uuid", r.UserUuid),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListPostsForLinkRequest:
+		return []*FieldError{
+			when(r.GetBy == pb.ListPostsForLinkRequest_UUID, uuidField("link_uuid", r.LinkUuid)),
+			when(r.GetBy == pb.ListPostsForLinkRequest_URL, h.urlField("url", r.Url)),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListLinksBySourceRequest:
+		return []*FieldError{
+			uuidField("source_uuid", r.SourceUuid),
+			pageSizeField(r.PageSize),
+		}
+	case *pb.ListPostsBySourceRequest:
+		return []*FieldError{
+			uuidField("source_uuid", r.SourceUuid),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListHomeFeedRequest:
+		return []*FieldError{
+			uuidField("user_uuid", r.UserUuid),
+			uuidsField("followed_user_uuids", r.FollowedUserUuids, h.config.MaxFeedFollows),
+			uuidsField("followed_source_uuids", r.FollowedSourceUuids, h.config.MaxFeedFollows),
+			pageSizeField(r.PageSize),
+		}
+	case *pb.ListPostsByTagRequest:
+		return []*FieldError{
+			check("tag", hashtag.Valid(hashtag.Normalize(r.Tag)), fmt.Sprintf("%q is not a valid tag", r.Tag)),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListPostsMentioningUserRequest:
+		return []*FieldError{
+			uuidField("user_uuid", r.UserUuid),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListRepliesRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			check("max_depth", r.MaxDepth >= 0, "must not be negative"),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.ListTrendingTagsRequest:
+		return []*FieldError{
+			check("window_seconds", r.WindowSeconds >= 0, "must not be negative"),
+			check("limit", r.Limit >= 0, "must not be negative"),
+		}
+	case *pb.SearchPostsRequest:
+		return []*FieldError{
+			check("query", !search.ParseQuery(r.Query).Empty(), "search query has no words"),
+			optionalUUIDField("user_uuid", r.UserUuid),
+			optionalUUIDField("source_uuid", r.SourceUuid),
+			check("created_before", r.CreatedBefore == 0 || r.CreatedBefore > r.CreatedAfter, "must be after created_after"),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.AddReactionRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("user_uuid", r.UserUuid),
+			h.reactionKindField(r.Kind),
+		}
+	case *pb.RemoveReactionRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("user_uuid", r.UserUuid),
+			h.reactionKindField(r.Kind),
+		}
+	case *pb.ListReactionsRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			when(r.Kind != "", h.reactionKindField(r.Kind)),
+			pageSizeField(r.PageSize),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.BookmarkPostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("user_uuid", r.UserUuid),
+		}
+	case *pb.UnbookmarkPostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("user_uuid", r.UserUuid),
+		}
+	case *pb.ListBookmarksRequest:
+		return []*FieldError{
+			uuidField("user_uuid", r.UserUuid),
+			pageSizeField(r.PageSize),
+		}
+	case *pb.ListDeadLinksRequest:
+		return []*FieldError{
+			pageSizeField(r.PageSize),
+		}
+	case *pb.CreateLinkRequest:
+		return []*FieldError{
+			h.urlField("url", r.Url),
+			uuidsField("source_head_uuids", r.SourceHeadUuids, h.config.MaxSourceHeads),
+		}
+	case *pb.CreatePostRequest:
+		reply, repost := len(r.ParentPostUuid) > 0, len(r.RepostOfUuid) > 0
+		return []*FieldError{
+			uuidField("user_uuid", r.UserUuid),
+			// a reply without a link is about its parent's link and a repost is about the reposted post's link
+			when(!repost && (len(r.LinkUuid) > 0 || !reply), uuidField("link_uuid", r.LinkUuid)),
+			optionalUUIDField("parent_post_uuid", r.ParentPostUuid),
+			optionalUUIDField("repost_of_uuid", r.RepostOfUuid),
+			check("repost_of_uuid", !reply || !repost, "a post cannot both reply to and repost a post"),
+			check("title", r.Title != "" || reply || repost, "is required"),
+			check("comment", r.Title != "" || r.Comment != "" || !reply, "is required on a reply without a title"),
+			textField("title", r.Title, h.config.MaxTitleLength),
+			textField("comment", r.Comment, h.config.MaxCommentLength),
+			visibilityField(r.Visibility),
+			check("draft", !r.Draft || (!reply && !repost), "a reply or repost cannot be a draft"),
+		}
+	case *pb.CreatePostWithLinkRequest:
+		return []*FieldError{
+			h.urlField("url", r.Url),
+			uuidsField("source_head_uuids", r.SourceHeadUuids, h.config.MaxSourceHeads),
+			uuidField("user_uuid", r.UserUuid),
+			check("title", r.Title != "", "is required"),
+			textField("title", r.Title, h.config.MaxTitleLength),
+			textField("comment", r.Comment, h.config.MaxCommentLength),
+			visibilityField(r.Visibility),
+		}
+	case *pb.UpdatePostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("updated_by_uuid", r.UpdatedByUuid),
+			textField("title", r.Title, h.config.MaxTitleLength),
+			textField("comment", r.Comment, h.config.MaxCommentLength),
+			check("expected_version", r.ExpectedVersion >= 0, "must not be negative"),
+		}
+	case *pb.ListPostRevisionsRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			optionalUUIDField("viewer_uuid", r.ViewerUuid),
+		}
+	case *pb.DeletePostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("deleted_by_uuid", r.DeletedByUuid),
+			check("expected_version", r.ExpectedVersion >= 0, "must not be negative"),
+		}
+	case *pb.RestorePostRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("restored_by_uuid", r.RestoredByUuid),
+		}
+	case *pb.PublishDraftRequest:
+		return []*FieldError{
+			uuidField("post_uuid", r.PostUuid),
+			uuidField("published_by_uuid", r.PublishedByUuid),
+			check("expected_version", r.ExpectedVersion >= 0, "must not be negative"),
+		}
+	}
+	return nil
+}
+
+// check is a violation of a field unless ok
+func check(field string, ok bool, description string) *FieldError {
+	if ok {
+		return nil
+	}
+	return &FieldError{Field: field, Description: description}
+}
+
+// when only applies a rule when a condition holds, e.g. a field is only required by some requests
+func when(condition bool, rule *FieldError) *FieldError {
+	if !condition {
+		return nil
+	}
+	return rule
+}
+
+// uuidField requires a field to hold a uuid
+func uuidField(field string, raw []byte) *FieldError {
+	return check(field, len(raw) == uuid.Size, uuidDescription)
+}
+
+// optionalUUIDField requires a field to be empty or hold a uuid
+func optionalUUIDField(field string, raw []byte) *FieldError {
+	return check(field, len(raw) == 0 || len(raw) == uuid.Size, uuidDescription)
+}
+
+// uuidsField requires every item of a field to hold a uuid and the field to have at most max items
+func uuidsField(field string, raws [][]byte, max int) *FieldError {
+	if len(raws) > max {
+		return &FieldError{Field: field, Description: fmt.Sprintf("must have at most %d items but has %d", max, len(raws))}
+	}
+	for i, raw := range raws {
+		if len(raw) != uuid.Size {
+			return &FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Description: uuidDescription}
+		}
+	}
+	return nil
+}
+
+// textField requires a field to be utf-8 text of at most max characters
+func textField(field string, value string, max int) *FieldError {
+	if !utf8.ValidString(value) {
+		return &FieldError{Field: field, Description: "must be utf-8 text"}
+	}
+	return check(field, utf8.RuneCountInString(value) <= max, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// pageSizeField requires the page size of a list request not to be negative, sizes over the max are clamped
+func pageSizeField(size int32) *FieldError {
+	return check("page_size", size >= 0, "must not be negative")
+}
+
+// visibilityField requires a field to be a known visibility
+func visibilityField(visibility shared.Visibility) *FieldError {
+	_, err := visibilityFromGRPC(visibility)
+	return check("visibility", err == nil, fmt.Sprintf("%d is not a visibility", visibility))
+}
+
+// reactionKindField requires the kind of a reaction to be one of the configured reaction kinds
+func (h *Handler) reactionKindField(kind string) *FieldError {
+	return check("kind", h.reactionKind(kind), fmt.Sprintf("%q is not a reaction kind", kind))
+}
+
+// urlField requires a field to be an absolute url with one of the allowed schemes, no longer than the max url length
+func (h *Handler) urlField(field string, value string) *FieldError {
+	if value == "" {
+		return &FieldError{Field: field, Description: "is required"}
+	}
+	if len(value) > h.config.MaxURLLength {
+		return &FieldError{Field: field, Description: fmt.Sprintf("must be at most %d bytes", h.config.MaxURLLength)}
+	}
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return &FieldError{Field: field, Description: "must be an absolute url"}
+	}
+	for _, scheme := range h.config.AllowedURLSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return nil
+		}
+	}
+	return &FieldError{Field: field, Description: fmt.Sprintf("must have one of the schemes %s", strings.Join(h.config.AllowedURLSchemes, ", "))}
+}
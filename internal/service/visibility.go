@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	sharedpb "github.com/srcabl/protos/shared"
+)
+
+const (
+	// VisibilityPublic posts can be seen by anyone and are listed everywhere
+	VisibilityPublic = "public"
+	// VisibilityUnlisted posts can be seen by anyone who has them but are only listed for their author
+	VisibilityUnlisted = "unlisted"
+	// VisibilityFollowers posts can only be seen by their author and the users following them
+	VisibilityFollowers = "followers"
+	// VisibilityPrivate posts can only be seen by their author
+	VisibilityPrivate = "private"
+)
+
+// Viewer is who posts are read for, a nil viewer sees every post and is for the service's own reads
+type Viewer struct {
+	// UserUUID is the viewing user, it is empty for anonymous viewers
+	UserUUID string
+	// FollowingUUIDs are the users the viewer follows, whose followers only posts the viewer can see
+	FollowingUUIDs []string
+	// OwnDrafts is whether lists include the viewer's own drafts, drafts are never listed for anyone else
+	OwnDrafts bool
+}
+
+// visibleWhere builds the condition matching the posts of alias a viewer can see, listed is whether the
+// posts are being listed rather than got directly, which leaves out other users' unlisted posts and,
+// unless the viewer asks for them, the viewer's own drafts
+func visibleWhere(alias string, viewer *Viewer, listed bool) (string, []interface{}) {
+	if viewer == nil {
+		return "1=1", nil
+	}
+	visibilities := fmt.Sprintf("'%s'", VisibilityPublic)
+	if !listed {
+		visibilities = fmt.Sprintf("'%s', '%s'", VisibilityPublic, VisibilityUnlisted)
+	}
+	cond := fmt.Sprintf("%s.visibility IN (%s)", alias, visibilities)
+	var params []interface{}
+	if len(viewer.FollowingUUIDs) > 0 {
+		cond = fmt.Sprintf("%s OR (%s.visibility='%s' AND %s.user_uuid IN (%s))", cond, alias, VisibilityFollowers, alias, placeholders(len(viewer.FollowingUUIDs)))
+		params = append(params, stringArgs(viewer.FollowingUUIDs)...)
+	}
+	cond = fmt.Sprintf("(%s.draft=0 AND (%s))", alias, cond)
+	if viewer.UserUUID != "" {
+		own := fmt.Sprintf("%s.user_uuid=?", alias)
+		if listed && !viewer.OwnDrafts {
+			own = fmt.Sprintf("(%s AND %s.draft=0)", own, alias)
+		}
+		cond = fmt.Sprintf("(%s OR %s)", cond, own)
+		params = append(params, viewer.UserUUID)
+	}
+	return cond, params
+}
+
+// sees is whether the viewer can see a post, it is visibleWhere for posts that are not stored in sql
+func (v *Viewer) sees(post *DBPost, listed bool) bool {
+	if v == nil {
+		return true
+	}
+	if v.UserUUID != "" && post.UserUUID == v.UserUUID {
+		return !listed || v.OwnDrafts || !post.Draft
+	}
+	if post.Draft {
+		return false
+	}
+	switch post.Visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilityUnlisted:
+		return !listed
+	case VisibilityFollowers:
+		for _, following := range v.FollowingUUIDs {
+			if following == post.UserUUID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// visibilityToGRPC transforms a stored visibility to its proto enum
+func visibilityToGRPC(visibility string) sharedpb.Visibility {
+	switch visibility {
+	case VisibilityUnlisted:
+		return sharedpb.Visibility_UNLISTED
+	case VisibilityFollowers:
+		return sharedpb.Visibility_FOLLOWERS
+	case VisibilityPrivate:
+		return sharedpb.Visibility_PRIVATE
+	default:
+		return sharedpb.Visibility_PUBLIC
+	}
+}
+
+// visibilityFromGRPC transforms a proto visibility enum to how it is stored
+func visibilityFromGRPC(visibility sharedpb.Visibility) (string, error) {
+	switch visibility {
+	case sharedpb.Visibility_PUBLIC:
+		return VisibilityPublic, nil
+	case sharedpb.Visibility_UNLISTED:
+		return VisibilityUnlisted, nil
+	case sharedpb.Visibility_FOLLOWERS:
+		return VisibilityFollowers, nil
+	case sharedpb.Visibility_PRIVATE:
+		return VisibilityPrivate, nil
+	default:
+		return "", errors.Errorf("unknown visibility %d", visibility)
+	}
+}
@@ -0,0 +1,36 @@
+package sqlite
+
+import (
+	"regexp"
+	"sync"
+)
+
+var (
+	// forUpdate locks the rows a MySQL query reads, SQLite transactions lock the whole database instead
+	forUpdate = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE\b`)
+	// insertIgnore skips rows that would violate a unique key
+	insertIgnore = regexp.MustCompile(`(?i)\bINSERT\s+IGNORE\b`)
+	// onDuplicateKey starts the updates MySQL makes to the row an insert collides with
+	onDuplicateKey = regexp.MustCompile(`(?i)\bON\s+DUPLICATE\s+KEY\s+UPDATE\b`)
+	// insertedValue is the value an insert tried to put in a column, used in the updates to a collided row
+	insertedValue = regexp.MustCompile(`(?i)\bVALUES\((\w+)\)`)
+)
+
+// rewritten caches statements already rewritten, the data repository runs the same few statements over and over
+var rewritten sync.Map
+
+// Rewrite rewrites a statement written for MySQL into SQLite; aggregates such as GROUP_CONCAT with ORDER BY,
+// CONCAT and ? placeholders are the same in both so only locking reads and upserts need rewriting
+func Rewrite(query string) string {
+	if cached, ok := rewritten.Load(query); ok {
+		return cached.(string)
+	}
+	rewrite := forUpdate.ReplaceAllString(query, "")
+	rewrite = insertIgnore.ReplaceAllString(rewrite, "INSERT OR IGNORE")
+	if loc := onDuplicateKey.FindStringIndex(rewrite); loc != nil {
+		updates := insertedValue.ReplaceAllString(rewrite[loc[1]:], "excluded.$1")
+		rewrite = rewrite[:loc[0]] + "ON CONFLICT DO UPDATE SET" + updates
+	}
+	rewritten.Store(query, rewrite)
+	return rewrite
+}
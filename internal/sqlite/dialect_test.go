@@ -0,0 +1,43 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/srcabl/posts/internal/sqlite"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "locking read",
+			query: "SELECT p.version FROM posts p WHERE p.uuid=?\nFOR UPDATE\n",
+			want:  "SELECT p.version FROM posts p WHERE p.uuid=?\n",
+		},
+		{
+			name:  "insert ignore",
+			query: "INSERT IGNORE INTO bookmarks (uuid) VALUES (?)",
+			want:  "INSERT OR IGNORE INTO bookmarks (uuid) VALUES (?)",
+		},
+		{
+			name:  "upsert",
+			query: "INSERT INTO post_reaction_counts (post_uuid, kind, count) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE count=count+VALUES(count)",
+			want:  "INSERT INTO post_reaction_counts (post_uuid, kind, count) VALUES (?, ?, ?) ON CONFLICT DO UPDATE SET count=count+excluded.count",
+		},
+		{
+			name:  "aggregates are left alone",
+			query: "SELECT GROUP_CONCAT(CONCAT(prc.kind, ':', prc.count) ORDER BY prc.kind) FROM post_reaction_counts prc",
+			want:  "SELECT GROUP_CONCAT(CONCAT(prc.kind, ':', prc.count) ORDER BY prc.kind) FROM post_reaction_counts prc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlite.Rewrite(tt.query); got != tt.want {
+				t.Errorf("Rewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
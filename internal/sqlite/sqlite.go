@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Client is a SQLite database, like the mysql client it only opens the database once it connects
+type Client struct {
+	DB   *sql.DB
+	path string
+}
+
+// New news up a client for the SQLite database file at path
+func New(path string) (*Client, error) {
+	if path == "" {
+		return nil, errors.New("sqlite database path is required")
+	}
+	return &Client{path: path}, nil
+}
+
+// Connect opens the database, the returned func closes it
+func (c *Client) Connect() (func() error, error) {
+	db := sql.OpenDB(&connector{
+		dsn:    dsn(c.path),
+		driver: &sqlite3.SQLiteDriver{},
+	})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "failed to open sqlite database %s", c.path)
+	}
+	c.DB = db
+	return db.Close, nil
+}
+
+// dsn enforces foreign keys and takes the write lock when a transaction begins rather than when it first writes,
+// so transactions that read a row before updating it are serialized like they are by MySQL's FOR UPDATE
+func dsn(path string) string {
+	return fmt.Sprintf("file:%s?_foreign_keys=on&_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL", path)
+}
+
+// connector opens connections to SQLite that run statements written for MySQL
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+// Connect opens a connection
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	raw, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{SQLiteConn: raw.(*sqlite3.SQLiteConn)}, nil
+}
+
+// Driver is the SQLite driver
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// conn is a SQLite connection that rewrites statements written for MySQL before running them
+type conn struct {
+	*sqlite3.SQLiteConn
+}
+
+// Prepare prepares a statement written for MySQL
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(Rewrite(query))
+}
+
+// PrepareContext prepares a statement written for MySQL
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, Rewrite(query))
+}
+
+// ExecContext runs a statement written for MySQL
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, Rewrite(query), args)
+}
+
+// QueryContext runs a query written for MySQL
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.SQLiteConn.QueryContext(ctx, Rewrite(query), args)
+}
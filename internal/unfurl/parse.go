@@ -0,0 +1,212 @@
+package unfurl
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// publishedTimeLayouts are the layouts pages commonly publish dates in
+var publishedTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// document holds every candidate value found in a page, keyed by where it was found
+type document struct {
+	openGraph map[string]string
+	twitter   map[string]string
+	html      map[string]string
+	jsonLD    map[string]string
+	title     string
+	canonical string
+	oembedURL string
+	base      *url.URL
+}
+
+func parse(r io.Reader, base *url.URL) (*document, error) {
+	doc := &document{
+		openGraph: map[string]string{},
+		twitter:   map[string]string{},
+		html:      map[string]string{},
+		jsonLD:    map[string]string{},
+		base:      base,
+	}
+	z := html.NewTokenizer(r)
+	var inTitle, inJSONLD bool
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return doc, nil
+			}
+			return nil, errors.Wrap(z.Err(), "failed to tokenize html")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.DataAtom {
+			case atom.Title:
+				inTitle = doc.title == ""
+			case atom.Meta:
+				doc.addMeta(attrs(tok))
+			case atom.Link:
+				doc.addLink(attrs(tok))
+			case atom.Script:
+				inJSONLD = strings.EqualFold(attrs(tok)["type"], "application/ld+json")
+			}
+		case html.EndTagToken:
+			inTitle = false
+			inJSONLD = false
+		case html.TextToken:
+			if inTitle {
+				doc.title = strings.TrimSpace(string(z.Text()))
+			}
+			if inJSONLD {
+				doc.addJSONLD(z.Text())
+			}
+		}
+	}
+}
+
+func attrs(tok html.Token) map[string]string {
+	a := map[string]string{}
+	for _, attr := range tok.Attr {
+		a[strings.ToLower(attr.Key)] = attr.Val
+	}
+	return a
+}
+
+// setFirst keeps the first value seen for a key since pages list the preferred value first
+func setFirst(m map[string]string, key string, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+func (d *document) addMeta(a map[string]string) {
+	content := a["content"]
+	if property := strings.ToLower(a["property"]); property != "" {
+		switch {
+		case strings.HasPrefix(property, "og:"):
+			setFirst(d.openGraph, strings.TrimPrefix(property, "og:"), content)
+		case property == "article:published_time":
+			setFirst(d.openGraph, "published_time", content)
+		case strings.HasPrefix(property, "twitter:"):
+			// some sites publish twitter cards with property instead of name
+			setFirst(d.twitter, strings.TrimPrefix(property, "twitter:"), content)
+		}
+	}
+	if name := strings.ToLower(a["name"]); name != "" {
+		switch {
+		case strings.HasPrefix(name, "twitter:"):
+			setFirst(d.twitter, strings.TrimPrefix(name, "twitter:"), content)
+		case name == "description", name == "application-name":
+			setFirst(d.html, name, content)
+		}
+	}
+}
+
+func (d *document) addLink(a map[string]string) {
+	rels := strings.Fields(strings.ToLower(a["rel"]))
+	for _, rel := range rels {
+		switch {
+		case rel == "canonical" && d.canonical == "":
+			d.canonical = resolve(d.base, a["href"])
+		case rel == "alternate" && strings.EqualFold(a["type"], "application/json+oembed") && d.oembedURL == "":
+			d.oembedURL = resolve(d.base, a["href"])
+		}
+	}
+}
+
+func (d *document) addJSONLD(raw []byte) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		// malformed structured data is common and the rest of the page is still useful
+		return
+	}
+	d.walkJSONLD(v)
+}
+
+func (d *document) walkJSONLD(v interface{}) {
+	switch node := v.(type) {
+	case []interface{}:
+		for _, n := range node {
+			d.walkJSONLD(n)
+		}
+	case map[string]interface{}:
+		if graph, ok := node["@graph"]; ok {
+			d.walkJSONLD(graph)
+		}
+		setFirst(d.jsonLD, "title", jsonLDString(node["headline"]))
+		setFirst(d.jsonLD, "title", jsonLDString(node["name"]))
+		setFirst(d.jsonLD, "description", jsonLDString(node["description"]))
+		setFirst(d.jsonLD, "published_time", jsonLDString(node["datePublished"]))
+		setFirst(d.jsonLD, "image", jsonLDString(node["image"]))
+		if publisher, ok := node["publisher"].(map[string]interface{}); ok {
+			setFirst(d.jsonLD, "site_name", jsonLDString(publisher["name"]))
+		}
+	}
+}
+
+// jsonLDString reads a value that may be a string, an object with a url or a list of either
+func jsonLDString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case map[string]interface{}:
+		return jsonLDString(value["url"])
+	case []interface{}:
+		for _, item := range value {
+			if s := jsonLDString(item); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// first returns the first non empty value in order of preference
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (d *document) metadata() *Metadata {
+	meta := &Metadata{
+		Title:        first(d.openGraph["title"], d.twitter["title"], d.jsonLD["title"], d.title),
+		Description:  first(d.openGraph["description"], d.twitter["description"], d.jsonLD["description"], d.html["description"]),
+		CanonicalURL: first(resolve(d.base, d.openGraph["url"]), d.canonical),
+		SiteName:     first(d.openGraph["site_name"], d.jsonLD["site_name"], d.html["application-name"]),
+		ImageURL: resolve(d.base, first(
+			d.openGraph["image"],
+			d.openGraph["image:url"],
+			d.twitter["image"],
+			d.twitter["image:src"],
+			d.jsonLD["image"],
+		)),
+	}
+	published := first(d.openGraph["published_time"], d.jsonLD["published_time"])
+	for _, layout := range publishedTimeLayouts {
+		if t, err := time.Parse(layout, published); err == nil {
+			meta.PublishedAt = t
+			break
+		}
+	}
+	return meta
+}
@@ -0,0 +1,142 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/srcabl/posts/internal/fetch"
+)
+
+const defaultMaxBodyBytes = 2 << 20
+
+// Metadata is what a page says about itself in its markup
+type Metadata struct {
+	Title        string
+	Description  string
+	CanonicalURL string
+	SiteName     string
+	ImageURL     string
+	PublishedAt  time.Time
+}
+
+// Unfurler fetches pages and extracts their metadata
+type Unfurler struct {
+	client       *http.Client
+	maxBodyBytes int64
+}
+
+// New news up an unfurler that fetches pages with the client
+func New(client *http.Client) *Unfurler {
+	return &Unfurler{
+		client:       client,
+		maxBodyBytes: defaultMaxBodyBytes,
+	}
+}
+
+// Unfurl fetches a page and extracts its metadata from OpenGraph, Twitter card, JSON-LD and html tags,
+// filling anything still missing from the page's oEmbed endpoint
+func (u *Unfurler) Unfurl(ctx context.Context, pageURL string) (*Metadata, error) {
+	req, err := fetch.NewRequest(ctx, http.MethodGet, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", pageURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("failed to fetch %s: status %d", pageURL, resp.StatusCode)
+	}
+	if !isHTML(resp.Header.Get("Content-Type")) {
+		return nil, errors.Errorf("failed to unfurl %s: content type %s is not html", pageURL, resp.Header.Get("Content-Type"))
+	}
+	doc, err := parse(io.LimitReader(resp.Body, u.maxBodyBytes), resp.Request.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", pageURL)
+	}
+	meta := doc.metadata()
+	if doc.oembedURL != "" && (meta.Title == "" || meta.SiteName == "" || meta.ImageURL == "") {
+		// oembed only fills gaps so a failure to fetch it still leaves usable metadata
+		if oembed, err := u.fetchOEmbed(ctx, doc.oembedURL); err == nil {
+			meta.fillFromOEmbed(oembed)
+		}
+	}
+	return meta, nil
+}
+
+type oembedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (u *Unfurler) fetchOEmbed(ctx context.Context, oembedURL string) (*oembedResponse, error) {
+	req, err := fetch.NewRequest(ctx, http.MethodGet, oembedURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch oembed %s", oembedURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("failed to fetch oembed %s: status %d", oembedURL, resp.StatusCode)
+	}
+	oembed := oembedResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, u.maxBodyBytes)).Decode(&oembed); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode oembed %s", oembedURL)
+	}
+	return &oembed, nil
+}
+
+func (m *Metadata) fillFromOEmbed(oembed *oembedResponse) {
+	if m.Title == "" {
+		m.Title = strings.TrimSpace(oembed.Title)
+	}
+	if m.SiteName == "" {
+		m.SiteName = strings.TrimSpace(oembed.ProviderName)
+	}
+	if m.ImageURL == "" {
+		m.ImageURL = strings.TrimSpace(oembed.ThumbnailURL)
+	}
+}
+
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		// servers that do not say are assumed to serve html
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// resolve makes a possibly relative reference absolute against the page url
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base == nil {
+		return refURL.String()
+	}
+	return base.ResolveReference(refURL).String()
+}
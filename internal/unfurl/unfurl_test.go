@@ -0,0 +1,114 @@
+package unfurl_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/srcabl/posts/internal/unfurl"
+)
+
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir("testdata")))
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnfurl(t *testing.T) {
+	srv := newFixtureServer(t)
+	u := unfurl.New(srv.Client())
+
+	tests := []struct {
+		name string
+		path string
+		want unfurl.Metadata
+	}{
+		{
+			name: "opengraph tags are preferred",
+			path: "/opengraph.html",
+			want: unfurl.Metadata{
+				Title:        "Rivers Are Rising",
+				Description:  "A report on rising rivers.",
+				CanonicalURL: srv.URL + "/news/rivers-are-rising",
+				SiteName:     "Example News",
+				ImageURL:     srv.URL + "/images/river.jpg",
+				PublishedAt:  time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+			},
+		},
+		{
+			name: "twitter cards and canonical link",
+			path: "/twitter.html",
+			want: unfurl.Metadata{
+				Title:        "Card Title",
+				Description:  "Card description.",
+				CanonicalURL: "https://example.com/card",
+				ImageURL:     "https://cdn.example.com/card.png",
+			},
+		},
+		{
+			name: "json-ld graph",
+			path: "/jsonld.html",
+			want: unfurl.Metadata{
+				Title:       "Structured Headline",
+				Description: "Structured description.",
+				SiteName:    "Structured Press",
+				ImageURL:    "https://example.com/structured.jpg",
+				PublishedAt: time.Date(2020, 12, 24, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "html title",
+			path: "/title.html",
+			want: unfurl.Metadata{
+				Title: "Only A Title",
+			},
+		},
+		{
+			name: "oembed fills gaps",
+			path: "/oembed.html",
+			want: unfurl.Metadata{
+				Title:    "Video Page",
+				SiteName: "VideoSite",
+				ImageURL: "https://videos.example.com/thumb.jpg",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.Unfurl(context.Background(), srv.URL+tt.path)
+			if err != nil {
+				t.Fatalf("Unfurl() error = %v", err)
+			}
+			if !got.PublishedAt.Equal(tt.want.PublishedAt) {
+				t.Errorf("PublishedAt = %v, want %v", got.PublishedAt, tt.want.PublishedAt)
+			}
+			got.PublishedAt, tt.want.PublishedAt = time.Time{}, time.Time{}
+			if *got != tt.want {
+				t.Errorf("Unfurl() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnfurlErrors(t *testing.T) {
+	srv := newFixtureServer(t)
+	u := unfurl.New(srv.Client())
+
+	for _, path := range []string{"/missing", "/image"} {
+		if _, err := u.Unfurl(context.Background(), srv.URL+path); err == nil {
+			t.Errorf("Unfurl(%s) expected an error", path)
+		}
+	}
+}
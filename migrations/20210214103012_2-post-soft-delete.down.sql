@@ -0,0 +1,5 @@
+DROP INDEX posts_deleted_at_idx ON posts;
+
+ALTER TABLE posts
+    DROP COLUMN deleted_at,
+    DROP COLUMN deleted_by_uuid;
@@ -0,0 +1,6 @@
+-- Posts are soft deleted so they can be restored within a grace window
+ALTER TABLE posts
+    ADD COLUMN deleted_at INT(11) NULL, -- UNIX time
+    ADD COLUMN deleted_by_uuid VARCHAR(36) NULL;
+
+CREATE INDEX posts_deleted_at_idx ON posts (deleted_at);
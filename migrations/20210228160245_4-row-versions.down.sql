@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    DROP COLUMN version;
+
+ALTER TABLE links
+    DROP COLUMN version;
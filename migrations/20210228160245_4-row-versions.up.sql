@@ -0,0 +1,6 @@
+-- Versions are incremented on every mutation so concurrent writers can detect each other
+ALTER TABLE posts
+    ADD COLUMN version INT(11) NOT NULL DEFAULT 1;
+
+ALTER TABLE links
+    ADD COLUMN version INT(11) NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE links
+    DROP INDEX links_canonical_url_hash_idx,
+    DROP COLUMN canonical_url,
+    DROP COLUMN canonical_url_hash;
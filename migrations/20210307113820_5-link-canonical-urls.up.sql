@@ -0,0 +1,40 @@
+-- Links are deduplicated on the canonical form of their url
+-- The hash is indexed since the url is too long for a unique index
+-- Existing links are backfilled with their raw url as the canonical url, links sharing a url are merged into
+-- the oldest of them first; `make canonicalize-links` then canonicalizes the backfilled urls, which SQL cannot
+ALTER TABLE links
+    ADD COLUMN canonical_url VARCHAR(2048) NULL,
+    ADD COLUMN canonical_url_hash CHAR(64) NULL;
+
+UPDATE links SET canonical_url=url, canonical_url_hash=SHA2(url, 256);
+
+CREATE TEMPORARY TABLE link_merges (
+    duplicate_uuid VARCHAR(36) NOT NULL,
+    kept_uuid VARCHAR(36) NOT NULL,
+    PRIMARY KEY(duplicate_uuid)
+);
+
+INSERT INTO link_merges (duplicate_uuid, kept_uuid)
+SELECT
+    l.uuid,
+    (SELECT k.uuid FROM links k WHERE k.canonical_url_hash=l.canonical_url_hash ORDER BY k.created_at, k.uuid LIMIT 1)
+FROM
+    links l;
+
+DELETE FROM link_merges WHERE duplicate_uuid=kept_uuid;
+
+INSERT IGNORE INTO link_source_heads (link_uuid, source_uuid)
+SELECT m.kept_uuid, h.source_uuid FROM link_source_heads h INNER JOIN link_merges m ON h.link_uuid=m.duplicate_uuid;
+
+DELETE h FROM link_source_heads h INNER JOIN link_merges m ON h.link_uuid=m.duplicate_uuid;
+
+UPDATE posts p INNER JOIN link_merges m ON p.link_uuid=m.duplicate_uuid SET p.link_uuid=m.kept_uuid;
+
+DELETE l FROM links l INNER JOIN link_merges m ON l.uuid=m.duplicate_uuid;
+
+DROP TEMPORARY TABLE link_merges;
+
+ALTER TABLE links
+    MODIFY canonical_url VARCHAR(2048) NOT NULL,
+    MODIFY canonical_url_hash CHAR(64) NOT NULL,
+    ADD UNIQUE INDEX links_canonical_url_hash_idx (canonical_url_hash);
@@ -0,0 +1,8 @@
+DROP TABLE link_checks;
+
+ALTER TABLE links
+    DROP INDEX links_status_idx,
+    DROP INDEX links_status_checked_at_idx,
+    DROP COLUMN status,
+    DROP COLUMN status_checked_at,
+    DROP COLUMN consecutive_failures;
@@ -0,0 +1,21 @@
+-- The health of each link as last determined by the link health checker
+ALTER TABLE links
+    ADD COLUMN status TINYINT NOT NULL DEFAULT 0, -- 0 unknown, 1 alive, 2 redirected, 3 dead
+    ADD COLUMN status_checked_at INT(11) NULL, -- UNIX time
+    ADD COLUMN consecutive_failures INT(11) NOT NULL DEFAULT 0,
+    ADD INDEX links_status_checked_at_idx (status_checked_at),
+    ADD INDEX links_status_idx (status, status_checked_at);
+
+-- Every check of a link, kept as the link's status history
+CREATE TABLE IF NOT EXISTS link_checks (
+    uuid VARCHAR(36) NOT NULL UNIQUE,
+    link_uuid VARCHAR(36) NOT NULL,
+    checked_at INT(11) NOT NULL, -- UNIX time
+    status TINYINT NOT NULL,
+    http_status INT(11) NULL,
+    final_url VARCHAR(2048) NULL,
+    error VARCHAR(512) NULL,
+    PRIMARY KEY(uuid),
+    INDEX link_checks_link_idx (link_uuid, checked_at),
+    FOREIGN KEY(link_uuid) REFERENCES srcabl_posts.links(uuid)
+);
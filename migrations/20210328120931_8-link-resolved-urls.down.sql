@@ -0,0 +1,4 @@
+ALTER TABLE links
+    DROP INDEX links_resolved_url_hash_idx,
+    DROP COLUMN resolved_url,
+    DROP COLUMN resolved_url_hash;
@@ -0,0 +1,12 @@
+-- The canonical form of the url a link finally points at after following its redirects
+-- Existing links are backfilled as pointing at themselves
+ALTER TABLE links
+    ADD COLUMN resolved_url VARCHAR(2048) NULL,
+    ADD COLUMN resolved_url_hash CHAR(64) NULL;
+
+UPDATE links SET resolved_url=canonical_url, resolved_url_hash=canonical_url_hash;
+
+ALTER TABLE links
+    MODIFY resolved_url VARCHAR(2048) NOT NULL,
+    MODIFY resolved_url_hash CHAR(64) NOT NULL,
+    ADD INDEX links_resolved_url_hash_idx (resolved_url_hash);
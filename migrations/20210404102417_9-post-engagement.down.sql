@@ -0,0 +1,5 @@
+DROP INDEX posts_link_uuid_engagement_count_idx ON posts;
+DROP INDEX posts_link_uuid_created_at_idx ON posts;
+
+ALTER TABLE posts
+    DROP COLUMN engagement_count;
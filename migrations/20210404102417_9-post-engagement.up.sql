@@ -0,0 +1,6 @@
+-- Engagement on a post (replies, reactions, reposts) is counted so discussions can be sorted by it
+ALTER TABLE posts
+    ADD COLUMN engagement_count INT(11) NOT NULL DEFAULT 0;
+
+CREATE INDEX posts_link_uuid_created_at_idx ON posts (link_uuid, created_at);
+CREATE INDEX posts_link_uuid_engagement_count_idx ON posts (link_uuid, engagement_count);
@@ -0,0 +1,2 @@
+-- Links are looked up by their source heads for source profile pages
+CREATE INDEX link_source_heads_source_uuid_idx ON link_source_heads (source_uuid, link_uuid);
@@ -0,0 +1,2 @@
+-- Posts are listed newest first by user for user pages and home feeds
+CREATE INDEX posts_user_uuid_created_at_idx ON posts (user_uuid, created_at);
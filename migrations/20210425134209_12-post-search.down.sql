@@ -0,0 +1,2 @@
+DROP INDEX link_metadata_title_description_ft_idx ON link_metadata;
+DROP INDEX posts_title_comment_ft_idx ON posts;
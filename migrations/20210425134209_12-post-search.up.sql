@@ -0,0 +1,3 @@
+-- Posts are searched on their title and comment along with the metadata of their link
+CREATE FULLTEXT INDEX posts_title_comment_ft_idx ON posts (title, comment);
+CREATE FULLTEXT INDEX link_metadata_title_description_ft_idx ON link_metadata (title, description);
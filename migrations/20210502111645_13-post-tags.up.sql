@@ -0,0 +1,9 @@
+-- The normalized hashtags in each post's comment
+-- Tags are normalized before they are stored so they are compared byte for byte
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_uuid VARCHAR(36) NOT NULL,
+    tag VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+    PRIMARY KEY(post_uuid, tag),
+    INDEX post_tags_tag_idx (tag, post_uuid),
+    FOREIGN KEY(post_uuid) REFERENCES srcabl_posts.posts(uuid)
+);
@@ -0,0 +1,11 @@
+-- The users mentioned in each post's comment
+-- Offsets are the byte offsets of the mention in the comment including its @
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_uuid VARCHAR(36) NOT NULL,
+    user_uuid VARCHAR(36) NOT NULL,
+    start_offset INT(11) NOT NULL,
+    end_offset INT(11) NOT NULL,
+    PRIMARY KEY(post_uuid, start_offset),
+    INDEX post_mentions_user_uuid_idx (user_uuid, post_uuid),
+    FOREIGN KEY(post_uuid) REFERENCES srcabl_posts.posts(uuid)
+);
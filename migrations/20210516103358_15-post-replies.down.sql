@@ -0,0 +1,11 @@
+ALTER TABLE posts
+    DROP FOREIGN KEY posts_root_post_uuid_fk,
+    DROP FOREIGN KEY posts_parent_post_uuid_fk;
+
+DROP INDEX posts_root_post_uuid_created_at_idx ON posts;
+DROP INDEX posts_parent_post_uuid_created_at_idx ON posts;
+
+ALTER TABLE posts
+    DROP COLUMN reply_count,
+    DROP COLUMN root_post_uuid,
+    DROP COLUMN parent_post_uuid;
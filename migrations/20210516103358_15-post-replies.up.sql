@@ -0,0 +1,11 @@
+-- A post can reply to another post, the root is the post at the top of its thread
+-- Deleted posts are soft deleted so they stay in their threads as tombstones
+ALTER TABLE posts
+    ADD COLUMN parent_post_uuid VARCHAR(36) NULL,
+    ADD COLUMN root_post_uuid VARCHAR(36) NULL,
+    ADD COLUMN reply_count INT(11) NOT NULL DEFAULT 0,
+    ADD CONSTRAINT posts_parent_post_uuid_fk FOREIGN KEY(parent_post_uuid) REFERENCES srcabl_posts.posts(uuid),
+    ADD CONSTRAINT posts_root_post_uuid_fk FOREIGN KEY(root_post_uuid) REFERENCES srcabl_posts.posts(uuid);
+
+CREATE INDEX posts_parent_post_uuid_created_at_idx ON posts (parent_post_uuid, created_at);
+CREATE INDEX posts_root_post_uuid_created_at_idx ON posts (root_post_uuid, created_at);
@@ -0,0 +1,21 @@
+-- Each user can react to a post once with each kind of reaction
+CREATE TABLE IF NOT EXISTS post_reactions (
+    uuid VARCHAR(36) NOT NULL UNIQUE,
+    post_uuid VARCHAR(36) NOT NULL,
+    user_uuid VARCHAR(36) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    created_at INT(11) NOT NULL, -- UNIX time
+    PRIMARY KEY(post_uuid, user_uuid, kind),
+    INDEX post_reactions_post_uuid_created_at_idx (post_uuid, created_at),
+    FOREIGN KEY(post_uuid) REFERENCES srcabl_posts.posts(uuid),
+    FOREIGN KEY(user_uuid) REFERENCES srcabl_users.users(uuid)
+);
+
+-- Reactions are counted as they are added and removed so posts do not count them on every read
+CREATE TABLE IF NOT EXISTS post_reaction_counts (
+    post_uuid VARCHAR(36) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    count INT(11) NOT NULL DEFAULT 0,
+    PRIMARY KEY(post_uuid, kind),
+    FOREIGN KEY(post_uuid) REFERENCES srcabl_posts.posts(uuid)
+);
@@ -0,0 +1,8 @@
+ALTER TABLE posts
+    DROP FOREIGN KEY posts_repost_of_uuid_fk;
+
+DROP INDEX posts_repost_of_uuid_user_uuid_idx ON posts;
+
+ALTER TABLE posts
+    DROP COLUMN repost_count,
+    DROP COLUMN repost_of_uuid;
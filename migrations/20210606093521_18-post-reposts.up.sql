@@ -0,0 +1,7 @@
+-- A post can repost another post, a repost without a title or comment is a plain repost and one with them is a quote
+ALTER TABLE posts
+    ADD COLUMN repost_of_uuid VARCHAR(36) NULL,
+    ADD COLUMN repost_count INT(11) NOT NULL DEFAULT 0,
+    ADD CONSTRAINT posts_repost_of_uuid_fk FOREIGN KEY(repost_of_uuid) REFERENCES srcabl_posts.posts(uuid);
+
+CREATE INDEX posts_repost_of_uuid_user_uuid_idx ON posts (repost_of_uuid, user_uuid);
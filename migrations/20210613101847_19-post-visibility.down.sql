@@ -0,0 +1,5 @@
+DROP INDEX posts_visibility_draft_created_at_idx ON posts;
+
+ALTER TABLE posts
+    DROP COLUMN draft,
+    DROP COLUMN visibility;
@@ -0,0 +1,10 @@
+UPDATE posts p
+    INNER JOIN (
+        SELECT r.parent_post_uuid, COUNT(*) AS deleted_replies
+        FROM posts r
+        WHERE r.parent_post_uuid IS NOT NULL AND r.deleted_at IS NOT NULL
+        GROUP BY r.parent_post_uuid
+    ) d ON d.parent_post_uuid=p.uuid
+SET
+    p.reply_count=p.reply_count+d.deleted_replies,
+    p.engagement_count=p.engagement_count+d.deleted_replies;
@@ -0,0 +1,3 @@
+DROP TABLE link_source_heads;
+DROP TABLE posts;
+DROP TABLE links;
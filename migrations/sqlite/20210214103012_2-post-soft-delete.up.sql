@@ -0,0 +1,5 @@
+-- Posts are soft deleted so they can be restored within a grace window
+ALTER TABLE posts ADD COLUMN deleted_at INTEGER NULL; -- UNIX time
+ALTER TABLE posts ADD COLUMN deleted_by_uuid VARCHAR(36) NULL;
+
+CREATE INDEX posts_deleted_at_idx ON posts (deleted_at);
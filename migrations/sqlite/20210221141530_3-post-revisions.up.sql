@@ -0,0 +1,13 @@
+-- Each row is a prior version of a post, written when the post is updated
+CREATE TABLE IF NOT EXISTS post_revisions (
+    uuid VARCHAR(36) NOT NULL UNIQUE,
+    post_uuid VARCHAR(36) NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    comment TEXT NOT NULL,
+    created_at INTEGER NOT NULL, -- UNIX time
+    created_by_uuid VARCHAR(36) NOT NULL,
+    PRIMARY KEY(uuid),
+    UNIQUE(post_uuid, revision),
+    FOREIGN KEY(post_uuid) REFERENCES posts(uuid)
+);
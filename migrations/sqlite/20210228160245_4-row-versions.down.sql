@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN version;
+
+ALTER TABLE links DROP COLUMN version;
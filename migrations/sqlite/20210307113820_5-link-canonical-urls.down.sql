@@ -0,0 +1,4 @@
+DROP INDEX links_canonical_url_hash_idx;
+
+ALTER TABLE links DROP COLUMN canonical_url;
+ALTER TABLE links DROP COLUMN canonical_url_hash;
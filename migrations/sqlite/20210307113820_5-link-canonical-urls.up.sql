@@ -0,0 +1,8 @@
+-- Links are deduplicated on the canonical form of their url
+-- The hash is indexed since the url is too long for a unique index
+-- SQLite databases start at this schema's current version so there are no links to backfill,
+-- and SQLite cannot make a column NOT NULL after it is added so the columns default to empty
+ALTER TABLE links ADD COLUMN canonical_url VARCHAR(2048) NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN canonical_url_hash CHAR(64) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX links_canonical_url_hash_idx ON links (canonical_url_hash);
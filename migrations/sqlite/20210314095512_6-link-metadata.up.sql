@@ -0,0 +1,14 @@
+-- Metadata unfurled from the page a link points at
+-- Each link has at most one row, refreshed whenever the link is unfurled again
+CREATE TABLE IF NOT EXISTS link_metadata (
+    link_uuid VARCHAR(36) NOT NULL,
+    title VARCHAR(512) NOT NULL,
+    description TEXT NOT NULL,
+    canonical_url VARCHAR(2048) NOT NULL,
+    site_name VARCHAR(255) NOT NULL,
+    image_url VARCHAR(2048) NOT NULL,
+    published_at INTEGER NULL, -- UNIX time
+    fetched_at INTEGER NOT NULL, -- UNIX time
+    PRIMARY KEY(link_uuid),
+    FOREIGN KEY(link_uuid) REFERENCES links(uuid)
+);
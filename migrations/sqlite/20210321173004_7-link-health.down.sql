@@ -0,0 +1,8 @@
+DROP TABLE link_checks;
+
+DROP INDEX links_status_idx;
+DROP INDEX links_status_checked_at_idx;
+
+ALTER TABLE links DROP COLUMN status;
+ALTER TABLE links DROP COLUMN status_checked_at;
+ALTER TABLE links DROP COLUMN consecutive_failures;
@@ -0,0 +1,22 @@
+-- The health of each link as last determined by the link health checker
+ALTER TABLE links ADD COLUMN status INTEGER NOT NULL DEFAULT 0; -- 0 unknown, 1 alive, 2 redirected, 3 dead
+ALTER TABLE links ADD COLUMN status_checked_at INTEGER NULL; -- UNIX time
+ALTER TABLE links ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX links_status_checked_at_idx ON links (status_checked_at);
+CREATE INDEX links_status_idx ON links (status, status_checked_at);
+
+-- Every check of a link, kept as the link's status history
+CREATE TABLE IF NOT EXISTS link_checks (
+    uuid VARCHAR(36) NOT NULL UNIQUE,
+    link_uuid VARCHAR(36) NOT NULL,
+    checked_at INTEGER NOT NULL, -- UNIX time
+    status INTEGER NOT NULL,
+    http_status INTEGER NULL,
+    final_url VARCHAR(2048) NULL,
+    error VARCHAR(512) NULL,
+    PRIMARY KEY(uuid),
+    FOREIGN KEY(link_uuid) REFERENCES links(uuid)
+);
+
+CREATE INDEX link_checks_link_idx ON link_checks (link_uuid, checked_at);
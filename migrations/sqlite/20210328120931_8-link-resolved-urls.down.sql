@@ -0,0 +1,4 @@
+DROP INDEX links_resolved_url_hash_idx;
+
+ALTER TABLE links DROP COLUMN resolved_url;
+ALTER TABLE links DROP COLUMN resolved_url_hash;
@@ -0,0 +1,6 @@
+-- The canonical form of the url a link finally points at after following its redirects
+-- SQLite databases start at this schema's current version so there are no links to backfill
+ALTER TABLE links ADD COLUMN resolved_url VARCHAR(2048) NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN resolved_url_hash CHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX links_resolved_url_hash_idx ON links (resolved_url_hash);
@@ -0,0 +1,4 @@
+DROP INDEX posts_link_uuid_engagement_count_idx;
+DROP INDEX posts_link_uuid_created_at_idx;
+
+ALTER TABLE posts DROP COLUMN engagement_count;
@@ -0,0 +1 @@
+DROP INDEX link_source_heads_source_uuid_idx;
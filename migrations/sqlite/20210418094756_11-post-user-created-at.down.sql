@@ -0,0 +1 @@
+DROP INDEX posts_user_uuid_created_at_idx;
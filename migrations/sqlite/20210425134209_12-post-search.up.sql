@@ -0,0 +1,2 @@
+-- SQLite has no FULLTEXT indexes, posts stored in SQLite are searched with the service's search index instead
+SELECT 1;
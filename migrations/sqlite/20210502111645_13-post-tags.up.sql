@@ -0,0 +1,10 @@
+-- The normalized hashtags in each post's comment
+-- Tags are normalized before they are stored so they are compared byte for byte, which is SQLite's default
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_uuid VARCHAR(36) NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY(post_uuid, tag),
+    FOREIGN KEY(post_uuid) REFERENCES posts(uuid)
+);
+
+CREATE INDEX post_tags_tag_idx ON post_tags (tag, post_uuid);
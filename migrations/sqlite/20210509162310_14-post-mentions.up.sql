@@ -0,0 +1,12 @@
+-- The users mentioned in each post's comment
+-- Offsets are the byte offsets of the mention in the comment including its @
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_uuid VARCHAR(36) NOT NULL,
+    user_uuid VARCHAR(36) NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    PRIMARY KEY(post_uuid, start_offset),
+    FOREIGN KEY(post_uuid) REFERENCES posts(uuid)
+);
+
+CREATE INDEX post_mentions_user_uuid_idx ON post_mentions (user_uuid, post_uuid);
@@ -0,0 +1,6 @@
+DROP INDEX posts_root_post_uuid_created_at_idx;
+DROP INDEX posts_parent_post_uuid_created_at_idx;
+
+ALTER TABLE posts DROP COLUMN reply_count;
+ALTER TABLE posts DROP COLUMN root_post_uuid;
+ALTER TABLE posts DROP COLUMN parent_post_uuid;
@@ -0,0 +1,9 @@
+-- A post can reply to another post, the root is the post at the top of its thread
+-- Deleted posts are soft deleted so they stay in their threads as tombstones
+-- SQLite cannot drop a column with a foreign key so the parent and root are checked by the service instead
+ALTER TABLE posts ADD COLUMN parent_post_uuid VARCHAR(36) NULL;
+ALTER TABLE posts ADD COLUMN root_post_uuid VARCHAR(36) NULL;
+ALTER TABLE posts ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX posts_parent_post_uuid_created_at_idx ON posts (parent_post_uuid, created_at);
+CREATE INDEX posts_root_post_uuid_created_at_idx ON posts (root_post_uuid, created_at);
@@ -0,0 +1,11 @@
+-- Each user can bookmark a post once, bookmarks are listed newest first
+CREATE TABLE IF NOT EXISTS bookmarks (
+    uuid VARCHAR(36) NOT NULL UNIQUE,
+    user_uuid VARCHAR(36) NOT NULL,
+    post_uuid VARCHAR(36) NOT NULL,
+    created_at INTEGER NOT NULL, -- UNIX time
+    PRIMARY KEY(user_uuid, post_uuid),
+    FOREIGN KEY(post_uuid) REFERENCES posts(uuid)
+);
+
+CREATE INDEX bookmarks_user_uuid_created_at_idx ON bookmarks (user_uuid, created_at, uuid);
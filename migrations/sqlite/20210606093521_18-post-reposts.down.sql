@@ -0,0 +1,4 @@
+DROP INDEX posts_repost_of_uuid_user_uuid_idx;
+
+ALTER TABLE posts DROP COLUMN repost_count;
+ALTER TABLE posts DROP COLUMN repost_of_uuid;
@@ -0,0 +1,6 @@
+-- A post can repost another post, a repost without a title or comment is a plain repost and one with them is a quote
+-- SQLite cannot drop a column with a foreign key so the reposted post is checked by the service instead
+ALTER TABLE posts ADD COLUMN repost_of_uuid VARCHAR(36) NULL;
+ALTER TABLE posts ADD COLUMN repost_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX posts_repost_of_uuid_user_uuid_idx ON posts (repost_of_uuid, user_uuid);
@@ -0,0 +1,4 @@
+DROP INDEX posts_visibility_draft_created_at_idx;
+
+ALTER TABLE posts DROP COLUMN draft;
+ALTER TABLE posts DROP COLUMN visibility;
@@ -0,0 +1,5 @@
+-- A post is seen by who its visibility allows, a draft is only seen by its author until it is published
+ALTER TABLE posts ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'public';
+ALTER TABLE posts ADD COLUMN draft INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX posts_visibility_draft_created_at_idx ON posts (visibility, draft, created_at);
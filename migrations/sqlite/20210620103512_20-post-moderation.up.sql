@@ -0,0 +1,4 @@
+-- A post deleted by someone other than its author was removed by a moderator, only a moderator can restore it
+ALTER TABLE posts ADD COLUMN deleted_by_moderator INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET deleted_by_moderator=1 WHERE deleted_at IS NOT NULL AND deleted_by_uuid<>user_uuid;
@@ -0,0 +1,3 @@
+UPDATE posts SET
+    reply_count=reply_count+(SELECT COUNT(*) FROM posts r WHERE r.parent_post_uuid=posts.uuid AND r.deleted_at IS NOT NULL),
+    engagement_count=engagement_count+(SELECT COUNT(*) FROM posts r WHERE r.parent_post_uuid=posts.uuid AND r.deleted_at IS NOT NULL);
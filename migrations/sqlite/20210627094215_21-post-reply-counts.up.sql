@@ -0,0 +1,4 @@
+-- Reply counts leave out deleted replies, replies deleted before they did are uncounted from their parents
+UPDATE posts SET
+    reply_count=reply_count-(SELECT COUNT(*) FROM posts r WHERE r.parent_post_uuid=posts.uuid AND r.deleted_at IS NOT NULL),
+    engagement_count=engagement_count-(SELECT COUNT(*) FROM posts r WHERE r.parent_post_uuid=posts.uuid AND r.deleted_at IS NOT NULL);
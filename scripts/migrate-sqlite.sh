@@ -0,0 +1,3 @@
+#!/bin/bash
+
+migrate -source file://migrations/sqlite/ -database sqlite3://${SQLITE_PATH:-posts.db} up